@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token expired")
+	// ErrTokenNotYetValid indica que aún no llegó el nbf del token
+	ErrTokenNotYetValid = errors.New("token not yet valid")
+)
+
+// Claims son los campos registrados del JWT que usan los servicios
+type Claims struct {
+	Subject   string `json:"sub"`
+	Issuer    string `json:"iss,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	NotBefore int64  `json:"nbf,omitempty"`
+}
+
+// Expiry devuelve el vencimiento del token, o el instante cero si no vence
+func (c *Claims) Expiry() time.Time {
+	if c.ExpiresAt == 0 {
+		return time.Time{}
+	}
+	return time.Unix(c.ExpiresAt, 0)
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+}
+
+var encoding = base64.RawURLEncoding
+
+func sign(signingInput string, key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signingInput))
+	return mac.Sum(nil)
+}
+
+// Sign genera un JWT HS256 con los claims dados
+func Sign(claims Claims, key []byte) (string, error) {
+	h, err := json.Marshal(header{Alg: "HS256", Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	p, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := encoding.EncodeToString(h) + "." + encoding.EncodeToString(p)
+	return signingInput + "." + encoding.EncodeToString(sign(signingInput, key)), nil
+}
+
+// Verify comprueba la firma HS256, el vencimiento y el nbf del token. Solo acepta
+// HS256, para que un token con alg "none" no pueda saltarse la firma.
+func Verify(token string, key []byte, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil || h.Alg != "HS256" {
+		return nil, ErrInvalidToken
+	}
+	signature, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if !hmac.Equal(signature, sign(parts[0]+"."+parts[1], key)) {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil || claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+	if claims.ExpiresAt != 0 && !now.Before(claims.Expiry()) {
+		return nil, ErrTokenExpired
+	}
+	if claims.NotBefore != 0 && now.Before(time.Unix(claims.NotBefore, 0)) {
+		return nil, ErrTokenNotYetValid
+	}
+	return &claims, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := encoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
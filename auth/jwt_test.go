@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testKey = []byte("secret")
+
+// rawToken arma un token con el header y los claims dados, firmado con HS256
+func rawToken(t *testing.T, h interface{}, claims interface{}, key []byte) string {
+	t.Helper()
+	hj, err := json.Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cj, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingInput := encoding.EncodeToString(hj) + "." + encoding.EncodeToString(cj)
+	return signingInput + "." + encoding.EncodeToString(sign(signingInput, key))
+}
+
+func TestVerifyValid(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	want := Claims{Subject: "user-1", Issuer: "test", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix(), NotBefore: now.Unix()}
+	token, err := Sign(want, testKey)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	claims, err := Verify(token, testKey, now)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if *claims != want {
+		t.Errorf("Verify = %+v, want %+v", *claims, want)
+	}
+	if !claims.Expiry().Equal(now.Add(time.Hour)) {
+		t.Errorf("Expiry = %v, want %v", claims.Expiry(), now.Add(time.Hour))
+	}
+
+	// Sin exp ni nbf el token no vence
+	token, _ = Sign(Claims{Subject: "user-1"}, testKey)
+	claims, err = Verify(token, testKey, now)
+	if err != nil {
+		t.Fatalf("Verify without exp: %v", err)
+	}
+	if !claims.Expiry().IsZero() {
+		t.Errorf("Expiry = %v, want zero", claims.Expiry())
+	}
+}
+
+func TestVerifyTimes(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tests := []struct {
+		name   string
+		claims Claims
+		want   error
+	}{
+		{"expired", Claims{Subject: "u", ExpiresAt: now.Add(-time.Second).Unix()}, ErrTokenExpired},
+		{"expires now", Claims{Subject: "u", ExpiresAt: now.Unix()}, ErrTokenExpired},
+		{"not yet valid", Claims{Subject: "u", NotBefore: now.Add(time.Minute).Unix()}, ErrTokenNotYetValid},
+		{"valid from now", Claims{Subject: "u", NotBefore: now.Unix(), ExpiresAt: now.Add(time.Second).Unix()}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := Sign(tt.claims, testKey)
+			if err != nil {
+				t.Fatalf("Sign: %v", err)
+			}
+			if _, err := Verify(token, testKey, now); !errors.Is(err, tt.want) {
+				t.Errorf("Verify = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyInvalid(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	valid, err := Sign(Claims{Subject: "user-1"}, testKey)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	parts := strings.Split(valid, ".")
+	claims := Claims{Subject: "user-1"}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"wrong signature", rawToken(t, header{Alg: "HS256"}, claims, []byte("other"))},
+		{"tampered claims", parts[0] + "." + encoding.EncodeToString([]byte(`{"sub":"admin"}`)) + "." + parts[2]},
+		{"alg none", rawToken(t, header{Alg: "none"}, claims, testKey)},
+		{"alg none unsigned", encoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + parts[1] + "."},
+		{"alg HS512", rawToken(t, header{Alg: "HS512"}, claims, testKey)},
+		{"alg RS256", rawToken(t, header{Alg: "RS256"}, claims, testKey)},
+		{"missing sub", rawToken(t, header{Alg: "HS256"}, Claims{Issuer: "test"}, testKey)},
+		{"empty", ""},
+		{"two segments", parts[0] + "." + parts[1]},
+		{"four segments", valid + "." + parts[2]},
+		{"header not base64", "!!!." + parts[1] + "." + parts[2]},
+		{"header not json", encoding.EncodeToString([]byte("nope")) + "." + parts[1] + "." + parts[2]},
+		{"signature not base64", parts[0] + "." + parts[1] + ".!!!"},
+		{"claims not json", rawToken(t, header{Alg: "HS256"}, "not an object", testKey)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := Verify(tt.token, testKey, now)
+			if !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Verify = %+v, %v, want %v", claims, err, ErrInvalidToken)
+			}
+		})
+	}
+}
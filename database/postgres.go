@@ -1,9 +1,14 @@
 package database
 
 import (
-	"database/sql"
-	_ "github.com/lib/pq"
 	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
 	"platzi.com/go/cqrs/models"
 )
 
@@ -23,14 +28,188 @@ func (repo *PostgresRepository) Close() {
 	repo.db.Close()
 }
 
+// feedColumns are the columns read into a models.Feed by scanFeed, and
+// insertFeedColumns those written by feedArgs. created_at defaults to NOW()
+// and new feeds are never in the trash.
+const (
+	feedColumns       = "id, title, description, author, url, tags, body, language, status, publish_at, published_at, source_key, created_at, deleted_at"
+	insertFeedColumns = "id, title, description, author, url, tags, body, language, status, publish_at, published_at, source_key"
+)
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// queryer runs queries on the database or inside a transaction
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func scanFeed(row rowScanner) (*models.Feed, error) {
+	feed := &models.Feed{}
+	err := row.Scan(&feed.ID, &feed.Title, &feed.Description, &feed.Author, &feed.URL, pq.Array(&feed.Tags), &feed.Body, &feed.Language, &feed.Status, &feed.PublishAt, &feed.PublishedAt, &feed.SourceKey, &feed.CreatedAt, &feed.DeletedAt)
+	if err != nil {
+		return nil, err
+	}
+	return feed, nil
+}
+
+func feedArgs(feed *models.Feed) []interface{} {
+	return []interface{}{feed.ID, feed.Title, feed.Description, feed.Author, feed.URL, pq.Array(tagsOrEmpty(feed.Tags)), feed.Body, feed.Language, feed.Status, feed.PublishAt, feed.PublishedAt, feed.SourceKey}
+}
+
+// tagsOrEmpty avoids inserting NULL into the NOT NULL tags column
+func tagsOrEmpty(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
+
+// InsertFeed inserts feed together with its first revision
 func (repo *PostgresRepository) InsertFeed(ctx context.Context, feed *models.Feed) error {
-	query := "INSERT INTO feeds (id, title, description) VALUES ($1, $2, $3)"
-	_, err := repo.db.ExecContext(ctx, query, feed.ID, feed.Title, feed.Description)
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "INSERT INTO feeds (" + insertFeedColumns + ") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)"
+	if _, err := tx.ExecContext(ctx, query, feedArgs(feed)...); err != nil {
+		return err
+	}
+	if err := insertRevisions(ctx, tx, []*models.FeedRevision{firstRevision(feed)}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// firstRevision is the revision stored with a new feed. Its author is the
+// author of the feed and every field that has a value counts as changed.
+func firstRevision(feed *models.Feed) *models.FeedRevision {
+	return models.NewFeedRevision(feed, 1, feed.Author, models.FeedContent{}, feed.CreatedAt)
+}
+
+// insertRevisionParams is the number of bind parameters per revision row
+const insertRevisionParams = 6
+
+// insertRevisions inserts revisions with a single multi-row INSERT
+func insertRevisions(ctx context.Context, tx *sql.Tx, revisions []*models.FeedRevision) error {
+	var query strings.Builder
+	query.WriteString("INSERT INTO feed_revisions (feed_id, number, author, changed_fields, content, created_at) VALUES ")
+	args := make([]interface{}, 0, len(revisions)*insertRevisionParams)
+	for i, revision := range revisions {
+		content, err := json.Marshal(revision.Content)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString("(")
+		for j := 1; j <= insertRevisionParams; j++ {
+			if j > 1 {
+				query.WriteString(", ")
+			}
+			fmt.Fprintf(&query, "$%d", i*insertRevisionParams+j)
+		}
+		query.WriteString(")")
+		args = append(args, revision.FeedID, revision.Number, revision.Author, pq.Array(revision.ChangedFields), content, revision.CreatedAt)
+	}
+	_, err := tx.ExecContext(ctx, query.String(), args...)
 	return err
 } 
 
+// insertFeedsChunk is the number of rows per multi-row INSERT, well below
+// the 65535 bind parameters Postgres allows per statement. Each row takes
+// insertFeedsParams parameters: feedArgs plus created_at.
+const (
+	insertFeedsChunk  = 500
+	insertFeedsParams = 13
+)
+
+// InsertFeeds inserts the feeds and their first revisions in a single
+// transaction using multi-row INSERTs, so either every feed is stored or
+// none is. Feeds whose source_key is already taken, even by a feed inserted
+// concurrently, are skipped; the returned map has the ID of the existing
+// feed for each of their source keys.
+func (repo *PostgresRepository) InsertFeeds(ctx context.Context, feeds []*models.Feed) (map[string]string, error) {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var skipped []string
+	for start := 0; start < len(feeds); start += insertFeedsChunk {
+		end := start + insertFeedsChunk
+		if end > len(feeds) {
+			end = len(feeds)
+		}
+		var query strings.Builder
+		query.WriteString("INSERT INTO feeds (" + insertFeedColumns + ", created_at) VALUES ")
+		args := make([]interface{}, 0, (end-start)*insertFeedsParams)
+		for i, feed := range feeds[start:end] {
+			if i > 0 {
+				query.WriteString(", ")
+			}
+			query.WriteString("(")
+			for j := 1; j <= insertFeedsParams; j++ {
+				if j > 1 {
+					query.WriteString(", ")
+				}
+				fmt.Fprintf(&query, "$%d", i*insertFeedsParams+j)
+			}
+			query.WriteString(")")
+			args = append(append(args, feedArgs(feed)...), feed.CreatedAt)
+		}
+		query.WriteString(" ON CONFLICT (source_key) WHERE source_key <> '' DO NOTHING RETURNING id")
+		inserted, err := queryIDs(ctx, tx, query.String(), args...)
+		if err != nil {
+			return nil, err
+		}
+		revisions := make([]*models.FeedRevision, 0, end-start)
+		for _, feed := range feeds[start:end] {
+			if inserted[feed.ID] {
+				revisions = append(revisions, firstRevision(feed))
+			} else {
+				skipped = append(skipped, feed.SourceKey)
+			}
+		}
+		if len(revisions) > 0 {
+			if err := insertRevisions(ctx, tx, revisions); err != nil {
+				return nil, err
+			}
+		}
+	}
+	duplicates, err := findFeedsBySourceKey(ctx, tx, skipped)
+	if err != nil {
+		return nil, err
+	}
+	return duplicates, tx.Commit()
+}
+
+// queryIDs runs a query returning a column of IDs
+func queryIDs(ctx context.Context, q queryer, query string, args ...interface{}) (map[string]bool, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+// ListFeeds returns every feed that is not in the trash
 func (repo *PostgresRepository) ListFeeds(ctx context.Context) ([]*models.Feed, error) {
-	query := "SELECT id, title, description, created_at FROM feeds"
+	query := "SELECT " + feedColumns + " FROM feeds WHERE deleted_at IS NULL"
 	rows, err := repo.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
@@ -39,11 +218,535 @@ func (repo *PostgresRepository) ListFeeds(ctx context.Context) ([]*models.Feed,
 
 	var feeds []*models.Feed
 	for rows.Next() {
-		feed := &models.Feed{}
-		if err := rows.Scan(&feed.ID, &feed.Title, &feed.Description, &feed.CreatedAt); err != nil {
+		feed, err := scanFeed(rows)
+		if err != nil {
 			return nil, err
 		}
 		feeds = append(feeds,  feed)
 	}
 	return feeds, nil
-}
\ No newline at end of file
+}
+
+// streamFeedsBatch is the number of rows fetched from the cursor at a time
+const streamFeedsBatch = 500
+
+// StreamFeeds calls fn for every feed matching filter that is not in the
+// trash, oldest first. Rows are
+// read from a server-side cursor in batches, so memory use does not grow
+// with the table. Cancelling ctx stops the stream.
+func (repo *PostgresRepository) StreamFeeds(ctx context.Context, filter models.FeedFilter, fn func(*models.Feed) error) error {
+	tx, err := repo.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "DECLARE feeds_cursor NO SCROLL CURSOR FOR SELECT " + feedColumns + " FROM feeds WHERE deleted_at IS NULL"
+	var args []interface{}
+	if !filter.Since.IsZero() {
+		args = append(args, filter.Since)
+		query += fmt.Sprintf(" AND created_at >= $%d", len(args))
+	}
+	if !filter.Until.IsZero() {
+		args = append(args, filter.Until)
+		query += fmt.Sprintf(" AND created_at < $%d", len(args))
+	}
+	if len(filter.Tags) > 0 {
+		args = append(args, pq.Array(filter.Tags))
+		query += fmt.Sprintf(" AND tags @> $%d", len(args))
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		query += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+	query += " ORDER BY created_at, id"
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+
+	fetch := fmt.Sprintf("FETCH FORWARD %d FROM feeds_cursor", streamFeedsBatch)
+	for {
+		rows, err := tx.QueryContext(ctx, fetch)
+		if err != nil {
+			return err
+		}
+		n := 0
+		for rows.Next() {
+			feed, err := scanFeed(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			n++
+			if err := fn(feed); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if n < streamFeedsBatch {
+			return nil
+		}
+	}
+}
+
+// GetFeed returns the feed with id, or nil if it does not exist. Unlike
+// ListFeeds it also returns feeds in the trash.
+func (repo *PostgresRepository) GetFeed(ctx context.Context, id string) (*models.Feed, error) {
+	query := "SELECT " + feedColumns + " FROM feeds WHERE id = $1"
+	feed, err := scanFeed(repo.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return feed, err
+}
+
+// FindFeedsBySourceKey returns the IDs of the feeds imported with any of
+// keys, by key, including feeds in the trash
+func (repo *PostgresRepository) FindFeedsBySourceKey(ctx context.Context, keys []string) (map[string]string, error) {
+	return findFeedsBySourceKey(ctx, repo.db, keys)
+}
+
+func findFeedsBySourceKey(ctx context.Context, q queryer, keys []string) (map[string]string, error) {
+	ids := make(map[string]string)
+	if len(keys) == 0 {
+		return ids, nil
+	}
+	rows, err := q.QueryContext(ctx, "SELECT source_key, id FROM feeds WHERE source_key = ANY($1)", pq.Array(keys))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key, id string
+		if err := rows.Scan(&key, &id); err != nil {
+			return nil, err
+		}
+		ids[key] = id
+	}
+	return ids, rows.Err()
+}
+
+// ScheduleFeed sets a draft or scheduled feed to be published at publishAt.
+// It returns nil if the feed does not exist or was already published.
+func (repo *PostgresRepository) ScheduleFeed(ctx context.Context, id string, publishAt time.Time) (*models.Feed, error) {
+	query := `UPDATE feeds SET status = 'scheduled', publish_at = $2
+		WHERE id = $1 AND status IN ('draft', 'scheduled') AND deleted_at IS NULL
+		RETURNING ` + feedColumns
+	feed, err := scanFeed(repo.db.QueryRowContext(ctx, query, id, publishAt))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return feed, err
+}
+
+// PublishDueFeeds publishes up to limit scheduled feeds whose publish_at is
+// not after now and stores a published_feed event for each in the
+// feed_events outbox in the same transaction. Rows are locked with SKIP
+// LOCKED, so concurrent callers never claim the same feed.
+func (repo *PostgresRepository) PublishDueFeeds(ctx context.Context, now time.Time, limit int) (int, error) {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE feeds SET status = 'published', published_at = $1
+		WHERE id IN (
+			SELECT id FROM feeds
+			WHERE status = 'scheduled' AND publish_at <= $1 AND deleted_at IS NULL
+			ORDER BY publish_at, id
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + feedColumns
+	rows, err := tx.QueryContext(ctx, query, now, limit)
+	if err != nil {
+		return 0, err
+	}
+	var feeds []*models.Feed
+	for rows.Next() {
+		feed, err := scanFeed(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		feeds = append(feeds, feed)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(feeds) == 0 {
+		return 0, nil
+	}
+	feedEvents := make([]*models.FeedEvent, len(feeds))
+	for i, feed := range feeds {
+		feedEvents[i] = &models.FeedEvent{Type: models.FeedEventPublished, Feed: feed, CreatedAt: now}
+	}
+	if err := insertFeedEvents(ctx, tx, feedEvents); err != nil {
+		return 0, err
+	}
+	return len(feeds), tx.Commit()
+}
+
+// insertFeedEvents stores events in the feed_events outbox with a single
+// multi-row INSERT
+func insertFeedEvents(ctx context.Context, tx *sql.Tx, feedEvents []*models.FeedEvent) error {
+	var query strings.Builder
+	query.WriteString("INSERT INTO feed_events (type, feed, revision, created_at) VALUES ")
+	args := make([]interface{}, 0, len(feedEvents)*4)
+	for i, event := range feedEvents {
+		feed, err := json.Marshal(event.Feed)
+		if err != nil {
+			return err
+		}
+		var revision []byte
+		if event.Revision != nil {
+			if revision, err = json.Marshal(event.Revision); err != nil {
+				return err
+			}
+		}
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		fmt.Fprintf(&query, "($%d, $%d, $%d, $%d)", i*4+1, i*4+2, i*4+3, i*4+4)
+		args = append(args, event.Type, feed, revision, event.CreatedAt)
+	}
+	_, err := tx.ExecContext(ctx, query.String(), args...)
+	return err
+}
+
+// feedEventsLock is the advisory lock taken by RelayFeedEvents
+const feedEventsLock = 4825
+
+// RelayFeedEvents calls fn with up to limit events from the feed_events
+// outbox, oldest first, and deletes them if fn succeeds. An advisory lock
+// lets a single caller relay at a time, so events are sent in order; the
+// others return 0. A failure after fn sent the events but before the commit
+// sends them again on the next call, so delivery is at least once.
+func (repo *PostgresRepository) RelayFeedEvents(ctx context.Context, limit int, fn func([]*models.FeedEvent) error) (int, error) {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRowContext(ctx, "SELECT pg_try_advisory_xact_lock($1)", feedEventsLock).Scan(&locked); err != nil {
+		return 0, err
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, type, feed, revision, created_at FROM feed_events ORDER BY id LIMIT $1", limit)
+	if err != nil {
+		return 0, err
+	}
+	var feedEvents []*models.FeedEvent
+	ids := make([]int64, 0, limit)
+	for rows.Next() {
+		event := &models.FeedEvent{}
+		var feed, revision []byte
+		if err := rows.Scan(&event.ID, &event.Type, &feed, &revision, &event.CreatedAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if err := json.Unmarshal(feed, &event.Feed); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("feed event %d: %w", event.ID, err)
+		}
+		if revision != nil {
+			if err := json.Unmarshal(revision, &event.Revision); err != nil {
+				rows.Close()
+				return 0, fmt.Errorf("feed event %d: %w", event.ID, err)
+			}
+		}
+		feedEvents = append(feedEvents, event)
+		ids = append(ids, event.ID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(feedEvents) == 0 {
+		return 0, nil
+	}
+	if err := fn(feedEvents); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM feed_events WHERE id = ANY($1)", pq.Array(ids)); err != nil {
+		return 0, err
+	}
+	return len(feedEvents), tx.Commit()
+}
+
+// UpdateFeed calls update with the feed with id locked and stores the
+// changes it makes to the editable fields as a new revision by author. It
+// returns nil if the feed does not exist or is in the trash, and a nil
+// revision if update changed nothing. An error from update is returned as is.
+// The updated_feed event for the revision is stored in the feed_events
+// outbox in the same transaction.
+func (repo *PostgresRepository) UpdateFeed(ctx context.Context, id, author string, updatedAt time.Time, update func(*models.Feed) error) (*models.Feed, *models.FeedRevision, error) {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	// Locking the row serializes concurrent updates, so revision numbers
+	// are assigned in order without gaps
+	feed, err := scanFeed(tx.QueryRowContext(ctx, "SELECT "+feedColumns+" FROM feeds WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", id))
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	previous := feed.Content()
+	if err := update(feed); err != nil {
+		return nil, nil, err
+	}
+	if len(feed.Content().ChangedFields(previous)) == 0 {
+		return feed, nil, nil
+	}
+
+	query := `UPDATE feeds SET title = $2, description = $3, author = $4, url = $5, tags = $6, body = $7, language = $8
+		WHERE id = $1`
+	_, err = tx.ExecContext(ctx, query, feed.ID, feed.Title, feed.Description, feed.Author, feed.URL, pq.Array(tagsOrEmpty(feed.Tags)), feed.Body, feed.Language)
+	if err != nil {
+		return nil, nil, err
+	}
+	var number int
+	err = tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(number), 0) + 1 FROM feed_revisions WHERE feed_id = $1", id).Scan(&number)
+	if err != nil {
+		return nil, nil, err
+	}
+	revision := models.NewFeedRevision(feed, number, author, previous, updatedAt)
+	if err := insertRevisions(ctx, tx, []*models.FeedRevision{revision}); err != nil {
+		return nil, nil, err
+	}
+	event := &models.FeedEvent{Type: models.FeedEventUpdated, Feed: feed, Revision: revision, CreatedAt: updatedAt}
+	if err := insertFeedEvents(ctx, tx, []*models.FeedEvent{event}); err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	return feed, revision, nil
+}
+
+// TrashFeed moves the feed with id to the trash and stores a deleted_feed
+// event in the feed_events outbox in the same transaction. It returns nil if
+// the feed does not exist or is already in the trash.
+func (repo *PostgresRepository) TrashFeed(ctx context.Context, id string, deletedAt time.Time) (*models.Feed, error) {
+	query := "UPDATE feeds SET deleted_at = $2 WHERE id = $1 AND deleted_at IS NULL RETURNING " + feedColumns
+	return repo.changeFeed(ctx, models.FeedEventDeleted, deletedAt, query, id, deletedAt)
+}
+
+// RestoreFeed takes the feed with id out of the trash and stores a
+// restored_feed event in the feed_events outbox in the same transaction. It
+// returns nil if the feed does not exist or is not in the trash.
+func (repo *PostgresRepository) RestoreFeed(ctx context.Context, id string) (*models.Feed, error) {
+	query := "UPDATE feeds SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL RETURNING " + feedColumns
+	return repo.changeFeed(ctx, models.FeedEventRestored, time.Now().UTC(), query, id)
+}
+
+// changeFeed runs query, which must return the changed feed, and stores an
+// eventType event for it in the same transaction. It returns nil if query
+// matches no feed.
+func (repo *PostgresRepository) changeFeed(ctx context.Context, eventType string, at time.Time, query string, args ...interface{}) (*models.Feed, error) {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	feed, err := scanFeed(tx.QueryRowContext(ctx, query, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	event := &models.FeedEvent{Type: eventType, Feed: feed, CreatedAt: at}
+	if err := insertFeedEvents(ctx, tx, []*models.FeedEvent{event}); err != nil {
+		return nil, err
+	}
+	return feed, tx.Commit()
+}
+
+// ListTrashedFeeds returns the feeds in the trash, most recently deleted first
+func (repo *PostgresRepository) ListTrashedFeeds(ctx context.Context) ([]*models.Feed, error) {
+	query := "SELECT " + feedColumns + " FROM feeds WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, id"
+	rows, err := repo.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	feeds := []*models.Feed{}
+	for rows.Next() {
+		feed, err := scanFeed(rows)
+		if err != nil {
+			return nil, err
+		}
+		feeds = append(feeds, feed)
+	}
+	return feeds, rows.Err()
+}
+
+// PurgeTrashedFeeds permanently deletes the feeds moved to the trash before
+// the given time, along with their revisions, and returns how many it deleted
+func (repo *PostgresRepository) PurgeTrashedFeeds(ctx context.Context, before time.Time) (int64, error) {
+	result, err := repo.db.ExecContext(ctx, "DELETE FROM feeds WHERE deleted_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const feedRevisionColumns = "feed_id, number, author, changed_fields, content, created_at"
+
+func scanFeedRevision(row rowScanner) (*models.FeedRevision, error) {
+	revision := &models.FeedRevision{}
+	var content []byte
+	err := row.Scan(&revision.FeedID, &revision.Number, &revision.Author, pq.Array(&revision.ChangedFields), &content, &revision.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &revision.Content); err != nil {
+		return nil, fmt.Errorf("invalid content in revision %d of feed %s: %w", revision.Number, revision.FeedID, err)
+	}
+	return revision, nil
+}
+
+// ListFeedRevisions returns the revisions of a feed, oldest first
+func (repo *PostgresRepository) ListFeedRevisions(ctx context.Context, feedID string) ([]*models.FeedRevision, error) {
+	query := "SELECT " + feedRevisionColumns + " FROM feed_revisions WHERE feed_id = $1 ORDER BY number"
+	rows, err := repo.db.QueryContext(ctx, query, feedID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*models.FeedRevision{}
+	for rows.Next() {
+		revision, err := scanFeedRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+// GetFeedRevision returns a revision of a feed, or nil if it does not exist
+func (repo *PostgresRepository) GetFeedRevision(ctx context.Context, feedID string, number int) (*models.FeedRevision, error) {
+	query := "SELECT " + feedRevisionColumns + " FROM feed_revisions WHERE feed_id = $1 AND number = $2"
+	revision, err := scanFeedRevision(repo.db.QueryRowContext(ctx, query, feedID, number))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return revision, err
+}
+
+func (repo *PostgresRepository) InsertSavedSearch(ctx context.Context, savedSearch *models.SavedSearch) error {
+	query := "INSERT INTO saved_searches (id, owner_id, query, created_at) VALUES ($1, $2, $3, $4)"
+	_, err := repo.db.ExecContext(ctx, query, savedSearch.ID, savedSearch.OwnerID, savedSearch.Query, savedSearch.CreatedAt)
+	return err
+}
+
+func (repo *PostgresRepository) GetSavedSearch(ctx context.Context, id string) (*models.SavedSearch, error) {
+	query := "SELECT id, owner_id, query, created_at FROM saved_searches WHERE id = $1"
+	savedSearch := &models.SavedSearch{}
+	err := repo.db.QueryRowContext(ctx, query, id).Scan(&savedSearch.ID, &savedSearch.OwnerID, &savedSearch.Query, &savedSearch.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return savedSearch, nil
+}
+
+func (repo *PostgresRepository) ListSavedSearches(ctx context.Context, ownerID string) ([]*models.SavedSearch, error) {
+	query := "SELECT id, owner_id, query, created_at FROM saved_searches WHERE owner_id = $1 ORDER BY created_at"
+	rows, err := repo.db.QueryContext(ctx, query, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	savedSearches := []*models.SavedSearch{}
+	for rows.Next() {
+		savedSearch := &models.SavedSearch{}
+		if err := rows.Scan(&savedSearch.ID, &savedSearch.OwnerID, &savedSearch.Query, &savedSearch.CreatedAt); err != nil {
+			return nil, err
+		}
+		savedSearches = append(savedSearches, savedSearch)
+	}
+	return savedSearches, rows.Err()
+}
+
+func (repo *PostgresRepository) DeleteSavedSearch(ctx context.Context, id string) error {
+	query := "DELETE FROM saved_searches WHERE id = $1"
+	_, err := repo.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// ReserveIdempotencyKey inserts key unless a record that has not expired
+// already exists, in which case it returns that record. A nil record means
+// the caller owns the key and must complete or delete it.
+func (repo *PostgresRepository) ReserveIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) (*models.IdempotencyKey, error) {
+	query := `INSERT INTO idempotency_keys (key, request_hash, created_at, expires_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (key) DO UPDATE SET request_hash = EXCLUDED.request_hash, status_code = NULL,
+			content_type = NULL, response_body = NULL, created_at = EXCLUDED.created_at, expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= EXCLUDED.created_at
+		RETURNING key`
+	var reserved string
+	err := repo.db.QueryRowContext(ctx, query, key.Key, key.RequestHash, key.CreatedAt, key.ExpiresAt).Scan(&reserved)
+	if err == nil {
+		return nil, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	query = "SELECT key, request_hash, status_code, content_type, response_body, created_at, expires_at FROM idempotency_keys WHERE key = $1"
+	existing := &models.IdempotencyKey{}
+	var statusCode sql.NullInt64
+	var contentType sql.NullString
+	err = repo.db.QueryRowContext(ctx, query, key.Key).Scan(&existing.Key, &existing.RequestHash, &statusCode, &contentType, &existing.ResponseBody, &existing.CreatedAt, &existing.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	existing.StatusCode = int(statusCode.Int64)
+	existing.ContentType = contentType.String
+	return existing, nil
+}
+
+func (repo *PostgresRepository) CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, contentType string, body []byte) error {
+	query := "UPDATE idempotency_keys SET status_code = $2, content_type = $3, response_body = $4 WHERE key = $1"
+	_, err := repo.db.ExecContext(ctx, query, key, statusCode, contentType, body)
+	return err
+}
+
+func (repo *PostgresRepository) DeleteIdempotencyKey(ctx context.Context, key string) error {
+	query := "DELETE FROM idempotency_keys WHERE key = $1"
+	_, err := repo.db.ExecContext(ctx, query, key)
+	return err
+}
+
+func (repo *PostgresRepository) PurgeExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error) {
+	query := "DELETE FROM idempotency_keys WHERE expires_at <= $1"
+	result, err := repo.db.ExecContext(ctx, query, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
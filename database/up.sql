@@ -1,8 +1,111 @@
+DROP TABLE IF EXISTS feed_revisions;
 DROP TABLE IF EXISTS feeds;
 
 CREATE TABLE feeds (
     id VARCHAR(32) PRIMARY KEY,
     title VARCHAR(255) NOT NULL,
     description VARCHAR(255) NOT NULL,
+    author VARCHAR(255) NOT NULL DEFAULT '',
+    url VARCHAR(2048) NOT NULL DEFAULT '',
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    body TEXT NOT NULL DEFAULT '',
+    language VARCHAR(35) NOT NULL DEFAULT '',
+    status VARCHAR(16) NOT NULL DEFAULT 'published' CHECK (status IN ('draft', 'scheduled', 'published', 'archived')),
+    publish_at TIMESTAMP,
+    published_at TIMESTAMP,
+    source_key VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    deleted_at TIMESTAMP,
+    search_vector TSVECTOR,
+    CHECK (status <> 'scheduled' OR publish_at IS NOT NULL)
+);
+
+CREATE INDEX feeds_tags_idx ON feeds USING GIN (tags);
+
+-- feeds_publish_at_idx lets the feed-service scheduler find the scheduled
+-- feeds that are due without scanning the table.
+CREATE INDEX feeds_publish_at_idx ON feeds (publish_at) WHERE status = 'scheduled';
+
+-- source_key identifies the entry an imported feed came from, so importing
+-- the same entry again is reported as a duplicate instead of creating a feed.
+CREATE UNIQUE INDEX feeds_source_key_idx ON feeds (source_key) WHERE source_key <> '';
+
+-- Deleting a feed only sets deleted_at (moves it to the trash); feeds in the
+-- trash are hidden everywhere and purged after the retention period.
+CREATE INDEX feeds_deleted_at_idx ON feeds (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- search_vector backs the Postgres full-text search fallback used when
+-- Elasticsearch is unavailable. Titles weigh more than descriptions, and
+-- descriptions more than the body.
+CREATE OR REPLACE FUNCTION feeds_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector('simple', coalesce(NEW.title, '')), 'A') ||
+        setweight(to_tsvector('simple', coalesce(NEW.description, '')), 'B') ||
+        setweight(to_tsvector('simple', coalesce(NEW.body, '')), 'C');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER feeds_search_vector_trigger
+    BEFORE INSERT OR UPDATE ON feeds
+    FOR EACH ROW EXECUTE PROCEDURE feeds_search_vector_update();
+
+CREATE INDEX feeds_search_vector_idx ON feeds USING GIN (search_vector);
+
+-- feed_revisions keeps every version of the editable fields of a feed.
+-- Revision 1 is the content the feed was created with; content holds the
+-- full snapshot and changed_fields the fields that differ from the previous
+-- revision.
+CREATE TABLE feed_revisions (
+    feed_id VARCHAR(32) NOT NULL REFERENCES feeds (id) ON DELETE CASCADE,
+    number INTEGER NOT NULL,
+    author VARCHAR(255) NOT NULL DEFAULT '',
+    changed_fields TEXT[] NOT NULL DEFAULT '{}',
+    content JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (feed_id, number)
+);
+
+DROP TABLE IF EXISTS feed_events;
+
+-- feed_events is the outbox of the events about feeds. Each row is written in
+-- the same transaction as the change it announces and feed-service relays it
+-- to NATS and deletes it afterwards, so an event is neither lost when NATS is
+-- down nor sent for a change that rolled back. feed and revision hold the
+-- models.Feed and models.FeedRevision the event carries.
+CREATE TABLE feed_events (
+    id BIGSERIAL PRIMARY KEY,
+    type VARCHAR(32) NOT NULL,
+    feed JSONB NOT NULL,
+    revision JSONB,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+DROP TABLE IF EXISTS saved_searches;
+
+CREATE TABLE saved_searches (
+    id VARCHAR(32) PRIMARY KEY,
+    owner_id VARCHAR(255) NOT NULL,
+    query VARCHAR(255) NOT NULL,
     created_at TIMESTAMP NOT NULL DEFAULT NOW()
-); 
\ No newline at end of file
+);
+
+CREATE INDEX saved_searches_owner_id_idx ON saved_searches (owner_id);
+
+DROP TABLE IF EXISTS idempotency_keys;
+
+-- idempotency_keys stores the response to each POST sent with an
+-- Idempotency-Key header so retries replay it instead of creating a new feed.
+-- status_code is NULL while the original request is still being processed.
+CREATE TABLE idempotency_keys (
+    key VARCHAR(255) PRIMARY KEY,
+    request_hash CHAR(64) NOT NULL,
+    status_code INTEGER,
+    content_type VARCHAR(255),
+    response_body BYTEA,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
@@ -9,8 +9,16 @@ import (
 type EventStore interface {
 	Close() error
 	PublishCreatedFeed(ctx context.Context, feed *models.Feed) error
+	PublishCreatedFeeds(ctx context.Context, feeds []*models.Feed) error
 	SubscribeCreatedFeed(ctx context.Context) (<-chan CreatedFeedMessage, error)
 	OnCreatedFeed(f func(CreatedFeedMessage)) error
+	PublishFeedEvents(ctx context.Context, feedEvents []*models.FeedEvent) error
+	OnPublishedFeed(f func(PublishedFeedMessage)) error
+	OnUpdatedFeed(f func(UpdatedFeedMessage)) error
+	OnDeletedFeed(f func(DeletedFeedMessage)) error
+	OnRestoredFeed(f func(RestoredFeedMessage)) error
+	PublishSavedSearchMatched(ctx context.Context, msg SavedSearchMatchedMessage) error
+	OnSavedSearchMatched(f func(SavedSearchMatchedMessage)) error
 }
 
 var eventStore EventStore
@@ -27,6 +35,10 @@ func PublishCreatedFeed(ctx context.Context, feed *models.Feed) error {
 	return eventStore.PublishCreatedFeed(ctx, feed)
 }
 
+func PublishCreatedFeeds(ctx context.Context, feeds []*models.Feed) error {
+	return eventStore.PublishCreatedFeeds(ctx, feeds)
+}
+
 func SubscribeCreatedFeed(ctx context.Context) (<-chan CreatedFeedMessage, error) {
 	return eventStore.SubscribeCreatedFeed(ctx)
 }
@@ -34,3 +46,31 @@ func SubscribeCreatedFeed(ctx context.Context) (<-chan CreatedFeedMessage, error
 func OnCreatedFeed(f func(CreatedFeedMessage)) error {
 	return eventStore.OnCreatedFeed(f)
 }
+
+func PublishFeedEvents(ctx context.Context, feedEvents []*models.FeedEvent) error {
+	return eventStore.PublishFeedEvents(ctx, feedEvents)
+}
+
+func OnPublishedFeed(f func(PublishedFeedMessage)) error {
+	return eventStore.OnPublishedFeed(f)
+}
+
+func OnUpdatedFeed(f func(UpdatedFeedMessage)) error {
+	return eventStore.OnUpdatedFeed(f)
+}
+
+func OnDeletedFeed(f func(DeletedFeedMessage)) error {
+	return eventStore.OnDeletedFeed(f)
+}
+
+func OnRestoredFeed(f func(RestoredFeedMessage)) error {
+	return eventStore.OnRestoredFeed(f)
+}
+
+func PublishSavedSearchMatched(ctx context.Context, msg SavedSearchMatchedMessage) error {
+	return eventStore.PublishSavedSearchMatched(ctx, msg)
+}
+
+func OnSavedSearchMatched(f func(SavedSearchMatchedMessage)) error {
+	return eventStore.OnSavedSearchMatched(f)
+}
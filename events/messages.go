@@ -1,18 +1,167 @@
 package events
 
-import "time"
+import (
+	"fmt"
+	"time"
+
+	"platzi.com/go/cqrs/models"
+)
 
 type Message interface{
 	Type() string
 }
 
 type CreatedFeedMessage struct {
-	ID          string `json:"id"`
-	Title       string `json:"title"`
-	Description string    `json:"description"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID          string     `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Author      string     `json:"author"`
+	URL         string     `json:"url"`
+	Tags        []string   `json:"tags"`
+	Body        string     `json:"body"`
+	Language    string     `json:"language"`
+	Status      string     `json:"status"`
+	PublishAt   *time.Time `json:"publish_at"`
+	PublishedAt *time.Time `json:"published_at"`
+	CreatedAt   time.Time  `json:"created_at"`
 }
 
 func (m CreatedFeedMessage) Type() string {
 	return "created_feed" 
-}
\ No newline at end of file
+}
+
+// NewCreatedFeedMessage builds the event published when feed is created
+func NewCreatedFeedMessage(feed *models.Feed) CreatedFeedMessage {
+	return CreatedFeedMessage{
+		ID:          feed.ID,
+		Title:       feed.Title,
+		Description: feed.Description,
+		Author:      feed.Author,
+		URL:         feed.URL,
+		Tags:        feed.Tags,
+		Body:        feed.Body,
+		Language:    feed.Language,
+		Status:      feed.Status,
+		PublishAt:   feed.PublishAt,
+		PublishedAt: feed.PublishedAt,
+		CreatedAt:   feed.CreatedAt,
+	}
+}
+
+// Feed returns the feed carried by the event
+func (m CreatedFeedMessage) Feed() *models.Feed {
+	return &models.Feed{
+		ID:          m.ID,
+		Title:       m.Title,
+		Description: m.Description,
+		Author:      m.Author,
+		URL:         m.URL,
+		Tags:        m.Tags,
+		Body:        m.Body,
+		Language:    m.Language,
+		Status:      m.Status,
+		PublishAt:   m.PublishAt,
+		PublishedAt: m.PublishedAt,
+		CreatedAt:   m.CreatedAt,
+	}
+}
+
+// PublishedFeedMessage is published when a draft or scheduled feed becomes
+// published. Feeds published on creation only emit a CreatedFeedMessage.
+type PublishedFeedMessage struct {
+	CreatedFeedMessage
+}
+
+func (m PublishedFeedMessage) Type() string {
+	return "published_feed"
+}
+
+// NewPublishedFeedMessage builds the event published when feed is published
+func NewPublishedFeedMessage(feed *models.Feed) PublishedFeedMessage {
+	return PublishedFeedMessage{NewCreatedFeedMessage(feed)}
+}
+
+// NewFeedEventMessage builds the message for an event from the feed_events
+// outbox
+func NewFeedEventMessage(event *models.FeedEvent) (Message, error) {
+	switch event.Type {
+	case models.FeedEventPublished:
+		return NewPublishedFeedMessage(event.Feed), nil
+	case models.FeedEventUpdated:
+		if event.Revision == nil {
+			return nil, fmt.Errorf("%s event without a revision", event.Type)
+		}
+		return NewUpdatedFeedMessage(event.Feed, event.Revision), nil
+	case models.FeedEventDeleted:
+		return NewDeletedFeedMessage(event.Feed), nil
+	case models.FeedEventRestored:
+		return RestoredFeedMessage{NewCreatedFeedMessage(event.Feed)}, nil
+	}
+	return nil, fmt.Errorf("unknown feed event type %q", event.Type)
+}
+
+// UpdatedFeedMessage is published when the content of a feed changes,
+// including when an old revision is restored
+type UpdatedFeedMessage struct {
+	CreatedFeedMessage
+	Revision      int       `json:"revision"`
+	ChangedFields []string  `json:"changed_fields"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func (m UpdatedFeedMessage) Type() string {
+	return "updated_feed"
+}
+
+// NewUpdatedFeedMessage builds the event published when revision changes feed
+func NewUpdatedFeedMessage(feed *models.Feed, revision *models.FeedRevision) UpdatedFeedMessage {
+	return UpdatedFeedMessage{
+		CreatedFeedMessage: NewCreatedFeedMessage(feed),
+		Revision:           revision.Number,
+		ChangedFields:      revision.ChangedFields,
+		UpdatedAt:          revision.CreatedAt,
+	}
+}
+
+// DeletedFeedMessage is published when a feed is moved to the trash
+type DeletedFeedMessage struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Status    string    `json:"status"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+func (m DeletedFeedMessage) Type() string {
+	return "deleted_feed"
+}
+
+// NewDeletedFeedMessage builds the event published when feed is trashed
+func NewDeletedFeedMessage(feed *models.Feed) DeletedFeedMessage {
+	msg := DeletedFeedMessage{ID: feed.ID, Title: feed.Title, Status: feed.Status}
+	if feed.DeletedAt != nil {
+		msg.DeletedAt = *feed.DeletedAt
+	}
+	return msg
+}
+
+// RestoredFeedMessage is published when a feed is taken out of the trash
+type RestoredFeedMessage struct {
+	CreatedFeedMessage
+}
+
+func (m RestoredFeedMessage) Type() string {
+	return "restored_feed"
+}
+
+type SavedSearchMatchedMessage struct {
+	SavedSearchID string    `json:"saved_search_id"`
+	OwnerID       string    `json:"owner_id"`
+	Query         string    `json:"query"`
+	FeedID        string    `json:"feed_id"`
+	FeedTitle     string    `json:"feed_title"`
+	MatchedAt     time.Time `json:"matched_at"`
+}
+
+func (m SavedSearchMatchedMessage) Type() string {
+	return "saved_search_matched"
+}
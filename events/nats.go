@@ -12,9 +12,14 @@ import (
 )
 
 type NatsEventStore struct {
-	conn            *nats.Conn
-	feedCreatedSub  *nats.Subscription
-	feedCreatedChan chan CreatedFeedMessage
+	conn             *nats.Conn
+	feedCreatedSub   *nats.Subscription
+	feedCreatedChan  chan CreatedFeedMessage
+	feedPublishedSub *nats.Subscription
+	feedUpdatedSub   *nats.Subscription
+	feedDeletedSub   *nats.Subscription
+	feedRestoredSub  *nats.Subscription
+	savedSearchSub   *nats.Subscription
 }
 
 func NewNats(url string) (*NatsEventStore, error) {
@@ -46,6 +51,11 @@ func NewNats(url string) (*NatsEventStore, error) {
 	return store, nil
 }
 
+// Conn expone la conexión para los servicios que necesitan subjects propios
+func (n *NatsEventStore) Conn() *nats.Conn {
+	return n.conn
+}
+
 // Cierra la conexión y libera recursos
 func (n *NatsEventStore) Close() error {
 	var errs []error
@@ -61,11 +71,41 @@ func (n *NatsEventStore) Close() error {
 			errs = append(errs, fmt.Errorf("error al desuscribirse de feedCreated: %w", err))
 		}
 	}
+	if n.feedPublishedSub != nil {
+		if err := n.feedPublishedSub.Unsubscribe(); err != nil {
+			errs = append(errs, fmt.Errorf("error al desuscribirse de feedPublished: %w", err))
+		}
+	}
+	if n.feedUpdatedSub != nil {
+		if err := n.feedUpdatedSub.Unsubscribe(); err != nil {
+			errs = append(errs, fmt.Errorf("error al desuscribirse de feedUpdated: %w", err))
+		}
+	}
+	if n.feedDeletedSub != nil {
+		if err := n.feedDeletedSub.Unsubscribe(); err != nil {
+			errs = append(errs, fmt.Errorf("error al desuscribirse de feedDeleted: %w", err))
+		}
+	}
+	if n.feedRestoredSub != nil {
+		if err := n.feedRestoredSub.Unsubscribe(); err != nil {
+			errs = append(errs, fmt.Errorf("error al desuscribirse de feedRestored: %w", err))
+		}
+	}
+	if n.savedSearchSub != nil {
+		if err := n.savedSearchSub.Unsubscribe(); err != nil {
+			errs = append(errs, fmt.Errorf("error al desuscribirse de savedSearchMatched: %w", err))
+		}
+	}
 	if n.conn != nil && !n.conn.IsClosed() {
 		n.conn.Close()
 	}
 	n.feedCreatedSub = nil
 	n.feedCreatedChan = nil
+	n.feedPublishedSub = nil
+	n.feedUpdatedSub = nil
+	n.feedDeletedSub = nil
+	n.feedRestoredSub = nil
+	n.savedSearchSub = nil
 	n.conn = nil
 	if len(errs) > 0 {
 		return fmt.Errorf("errores cerrando NATS event store: %v", errs)
@@ -85,12 +125,7 @@ func (n *NatsEventStore) encodeMessage(msg Message) ([]byte, error) {
 
 // PublishCreatedFeed publishes a CreatedFeedMessage to NATS
 func (n *NatsEventStore) PublishCreatedFeed(ctx context.Context, feed *models.Feed) error {
-	msg := CreatedFeedMessage{
-		ID:          feed.ID,
-		Title:       feed.Title,
-		Description: feed.Description,
-		CreatedAt:   feed.CreatedAt,
-	}
+	msg := NewCreatedFeedMessage(feed)
 	data, err := n.encodeMessage(msg)
 	if err != nil {
 		return err
@@ -98,22 +133,120 @@ func (n *NatsEventStore) PublishCreatedFeed(ctx context.Context, feed *models.Fe
 	return n.conn.Publish(msg.Type(), data)
 }
 
+// PublishCreatedFeeds publishes a CreatedFeedMessage per feed and flushes the
+// connection once, so a batch costs a single round-trip to the server
+func (n *NatsEventStore) PublishCreatedFeeds(ctx context.Context, feeds []*models.Feed) error {
+	for _, feed := range feeds {
+		msg := NewCreatedFeedMessage(feed)
+		data, err := n.encodeMessage(msg)
+		if err != nil {
+			return err
+		}
+		if err := n.conn.Publish(msg.Type(), data); err != nil {
+			return err
+		}
+	}
+	return n.flush(ctx)
+}
+
+// PublishFeedEvents publishes the events relayed from the feed_events outbox,
+// in order, and waits until the server has received them
+func (n *NatsEventStore) PublishFeedEvents(ctx context.Context, feedEvents []*models.FeedEvent) error {
+	for _, event := range feedEvents {
+		msg, err := NewFeedEventMessage(event)
+		if err != nil {
+			return err
+		}
+		data, err := n.encodeMessage(msg)
+		if err != nil {
+			return err
+		}
+		if err := n.conn.Publish(msg.Type(), data); err != nil {
+			return err
+		}
+	}
+	return n.flush(ctx)
+}
+
+func (n *NatsEventStore) flush(ctx context.Context) error {
+	// FlushWithContext requires a deadline; requests usually have none
+	if _, ok := ctx.Deadline(); !ok {
+		return n.conn.Flush()
+	}
+	return n.conn.FlushWithContext(ctx)
+}
+
 // decodeMessage deserializes a byte slice into the provided Message using gob decoding
 func (n *NatsEventStore) decodeMessage(data []byte, m interface{}) error {
 	b := bytes.Buffer{}
 	b.Write(data)
 	return gob.NewDecoder(&b).Decode(m)
 }
+
 // OnCreatedFeed sets up a subscription to listen for CreatedFeedMessage events on callback style
 func (n *NatsEventStore) OnCreatedFeed(f func(CreatedFeedMessage)) (err error) {
-	msg := CreatedFeedMessage{}
-	n.feedCreatedSub, err = n.conn.Subscribe(msg.Type(), func(m *nats.Msg) {
+	n.feedCreatedSub, err = n.conn.Subscribe(CreatedFeedMessage{}.Type(), func(m *nats.Msg) {
+		// gob omits zero values, so decoding into a reused message would keep
+		// fields from the previous one
+		var msg CreatedFeedMessage
 		n.decodeMessage(m.Data, &msg)
 		f(msg)
 	})
 	return err
 }
 
+// OnPublishedFeed sets up a subscription to listen for PublishedFeedMessage events on callback style
+func (n *NatsEventStore) OnPublishedFeed(f func(PublishedFeedMessage)) (err error) {
+	n.feedPublishedSub, err = n.conn.Subscribe(PublishedFeedMessage{}.Type(), func(m *nats.Msg) {
+		var msg PublishedFeedMessage
+		if err := n.decodeMessage(m.Data, &msg); err != nil {
+			fmt.Printf("NATS: error decodificando published_feed: %v\n", err)
+			return
+		}
+		f(msg)
+	})
+	return err
+}
+
+// OnUpdatedFeed sets up a subscription to listen for UpdatedFeedMessage events on callback style
+func (n *NatsEventStore) OnUpdatedFeed(f func(UpdatedFeedMessage)) (err error) {
+	n.feedUpdatedSub, err = n.conn.Subscribe(UpdatedFeedMessage{}.Type(), func(m *nats.Msg) {
+		var msg UpdatedFeedMessage
+		if err := n.decodeMessage(m.Data, &msg); err != nil {
+			fmt.Printf("NATS: error decodificando updated_feed: %v\n", err)
+			return
+		}
+		f(msg)
+	})
+	return err
+}
+
+// OnDeletedFeed sets up a subscription to listen for DeletedFeedMessage events on callback style
+func (n *NatsEventStore) OnDeletedFeed(f func(DeletedFeedMessage)) (err error) {
+	n.feedDeletedSub, err = n.conn.Subscribe(DeletedFeedMessage{}.Type(), func(m *nats.Msg) {
+		var msg DeletedFeedMessage
+		if err := n.decodeMessage(m.Data, &msg); err != nil {
+			fmt.Printf("NATS: error decodificando deleted_feed: %v\n", err)
+			return
+		}
+		f(msg)
+	})
+	return err
+}
+
+// OnRestoredFeed sets up a subscription to listen for RestoredFeedMessage events on callback style
+func (n *NatsEventStore) OnRestoredFeed(f func(RestoredFeedMessage)) (err error) {
+	n.feedRestoredSub, err = n.conn.Subscribe(RestoredFeedMessage{}.Type(), func(m *nats.Msg) {
+		var msg RestoredFeedMessage
+		if err := n.decodeMessage(m.Data, &msg); err != nil {
+			fmt.Printf("NATS: error decodificando restored_feed: %v\n", err)
+			return
+		}
+		f(msg)
+	})
+	return err
+}
+
 // SubscribeCreatedFeed sets up a subscription to listen for CreatedFeedMessage events and returns a channel
 func (n *NatsEventStore) SubscribeCreatedFeed(ctx context.Context) (<-chan CreatedFeedMessage, error) {
 	msg := CreatedFeedMessage{}
@@ -132,4 +265,26 @@ func (n *NatsEventStore) SubscribeCreatedFeed(ctx context.Context) (<-chan Creat
     	}
 	}()
 	return (<-chan CreatedFeedMessage)(n.feedCreatedChan), nil
-}
\ No newline at end of file
+}
+
+// PublishSavedSearchMatched publishes a SavedSearchMatchedMessage to NATS
+func (n *NatsEventStore) PublishSavedSearchMatched(ctx context.Context, msg SavedSearchMatchedMessage) error {
+	data, err := n.encodeMessage(msg)
+	if err != nil {
+		return err
+	}
+	return n.conn.Publish(msg.Type(), data)
+}
+
+// OnSavedSearchMatched sets up a subscription to listen for SavedSearchMatchedMessage events on callback style
+func (n *NatsEventStore) OnSavedSearchMatched(f func(SavedSearchMatchedMessage)) (err error) {
+	n.savedSearchSub, err = n.conn.Subscribe(SavedSearchMatchedMessage{}.Type(), func(m *nats.Msg) {
+		var msg SavedSearchMatchedMessage
+		if err := n.decodeMessage(m.Data, &msg); err != nil {
+			fmt.Printf("NATS: error decodificando saved_search_matched: %v\n", err)
+			return
+		}
+		f(msg)
+	})
+	return err
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type createFeedRequest struct {
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Author      string     `json:"author,omitempty"`
+	URL         string     `json:"url,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+	SourceKey   string     `json:"source_key"`
+}
+
+type batchItemResult struct {
+	Index  int    `json:"index"`
+	Status string `json:"status"`
+	ID     string `json:"id"`
+	Detail string `json:"detail"`
+	Errors []struct {
+		Field   string `json:"field"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+type batchResponse struct {
+	Created    int               `json:"created"`
+	Invalid    int               `json:"invalid"`
+	Duplicated int               `json:"duplicated"`
+	Results    []batchItemResult `json:"results"`
+}
+
+// FeedClient crea feeds a través de la API de feed-service
+type FeedClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewFeedClient(baseURL string, client *http.Client) *FeedClient {
+	return &FeedClient{baseURL: strings.TrimRight(baseURL, "/"), client: client}
+}
+
+// CreateFeeds envía un lote a POST /feeds/batch. Cada feed lleva la clave de
+// su entrada como source_key, así que feed-service no vuelve a crear las ya
+// importadas aunque se pierda el archivo de estado. La Idempotency-Key se
+// deriva de las mismas claves, así que reintentar el lote repite la respuesta.
+func (c *FeedClient) CreateFeeds(ctx context.Context, feeds []createFeedRequest, keys []string) (*batchResponse, error) {
+	body, err := json.Marshal(feeds)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/feeds/batch", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(strings.Join(keys, "\n")))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", "feed-importer-"+hex.EncodeToString(sum[:]))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("feed-service responded %s: %s", resp.Status, bytes.TrimSpace(detail))
+	}
+	response := &batchResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return nil, fmt.Errorf("invalid response from feed-service: %w", err)
+	}
+	if len(response.Results) != len(feeds) {
+		return nil, fmt.Errorf("feed-service returned %d results for %d feeds", len(response.Results), len(feeds))
+	}
+	return response, nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Importer deduplica las entradas por su Key y las envía por lotes
+type Importer struct {
+	client    *FeedClient
+	seen      map[string]bool
+	state     io.Writer
+	batchSize int
+	dryRun    bool
+}
+
+type ImportStats struct {
+	Created    int
+	Duplicated int
+	Invalid    int
+}
+
+func (im *Importer) Import(ctx context.Context, entries []*Entry) (ImportStats, error) {
+	var stats ImportStats
+	var batch []*Entry
+	for _, entry := range entries {
+		key := entry.Key()
+		if im.seen[key] {
+			stats.Duplicated++
+			continue
+		}
+		if entry.Title == "" {
+			log.Printf("Skipping entry %s without title", key)
+			stats.Invalid++
+			continue
+		}
+		// También evita repetir entradas dentro del mismo documento
+		im.seen[key] = true
+		batch = append(batch, entry)
+		if len(batch) == im.batchSize {
+			if err := im.send(ctx, batch, &stats); err != nil {
+				return stats, err
+			}
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		if err := im.send(ctx, batch, &stats); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+func (im *Importer) send(ctx context.Context, batch []*Entry, stats *ImportStats) error {
+	requests := make([]createFeedRequest, len(batch))
+	keys := make([]string, len(batch))
+	for i, entry := range batch {
+		requests[i] = createFeedRequest{
+			Title:       truncate(entry.Title, maxTitleLength),
+			Description: truncate(entry.Description, maxDescriptionLength),
+			Author:      truncate(entry.Author, maxAuthorLength),
+			URL:         entryURL(entry.Link),
+			Tags:        entryTags(entry.Categories),
+			PublishedAt: entryPublished(entry.Published, time.Now()),
+			SourceKey:   entry.Key(),
+		}
+		keys[i] = requests[i].SourceKey
+	}
+	if im.dryRun {
+		for i, req := range requests {
+			fmt.Printf("%s\t%s\t%s\n", keys[i], req.Title, req.Description)
+		}
+		stats.Created += len(requests)
+		return nil
+	}
+
+	response, err := im.client.CreateFeeds(ctx, requests, keys)
+	if err != nil {
+		// Las entradas del lote se podrán reintentar en la próxima ejecución
+		for _, key := range keys {
+			delete(im.seen, key)
+		}
+		return err
+	}
+	for _, result := range response.Results {
+		if result.Index < 0 || result.Index >= len(keys) {
+			return fmt.Errorf("feed-service returned a result for unknown index %d", result.Index)
+		}
+		key := keys[result.Index]
+		switch result.Status {
+		case "created":
+			stats.Created++
+		case "duplicate":
+			// Se importó en otra ejecución cuyo estado no se guardó
+			stats.Duplicated++
+		default:
+			log.Printf("Entry %s rejected: %s", key, describeErrors(result))
+			stats.Invalid++
+			continue
+		}
+		if _, err := fmt.Fprintln(im.state, key); err != nil {
+			return fmt.Errorf("failed to write state: %w", err)
+		}
+	}
+	return nil
+}
+
+func describeErrors(result batchItemResult) string {
+	messages := make([]string, 0, len(result.Errors)+1)
+	if result.Detail != "" {
+		messages = append(messages, result.Detail)
+	}
+	for _, e := range result.Errors {
+		messages = append(messages, e.Field+" "+e.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// entryURL descarta los enlaces que feed-service rechazaría, para no perder
+// la entrada completa por un enlace relativo o demasiado largo
+func entryURL(link string) string {
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(link) > maxURLLength {
+		return ""
+	}
+	return link
+}
+
+// entryPublished devuelve la fecha de publicación a enviar, o nil si la
+// entrada no la tiene o es futura, que feed-service rechazaría
+func entryPublished(published, now time.Time) *time.Time {
+	if published.IsZero() || published.After(now) {
+		return nil
+	}
+	return &published
+}
+
+// entryTags convierte las categorías en etiquetas, saltándose las que
+// exceden el largo permitido y quedándose con las primeras maxTags
+func entryTags(categories []string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, category := range categories {
+		tag := strings.ToLower(category)
+		if tag == "" || seen[tag] || utf8.RuneCountInString(tag) > maxTagLength {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+		if len(tags) == maxTags {
+			break
+		}
+	}
+	return tags
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeFeedService imita POST /feeds/batch: rechaza los feeds sin título e
+// informa como duplicados los source_key que ya vio
+type fakeFeedService struct {
+	mutex    sync.Mutex
+	keys     map[string]string
+	requests [][]createFeedRequest
+	fail     bool
+}
+
+func (s *fakeFeedService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if r.Method != http.MethodPost || r.URL.Path != "/feeds/batch" || !strings.HasPrefix(r.Header.Get("Idempotency-Key"), "feed-importer-") {
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+		return
+	}
+	if s.fail {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	var feeds []createFeedRequest
+	if err := json.NewDecoder(r.Body).Decode(&feeds); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.requests = append(s.requests, feeds)
+
+	response := batchResponse{}
+	for i, feed := range feeds {
+		result := batchItemResult{Index: i}
+		if id, ok := s.keys[feed.SourceKey]; ok {
+			result.Status, result.ID = "duplicate", id
+			response.Duplicated++
+		} else if feed.Title == "rechazada" {
+			result.Status, result.Detail = "invalid", "rejected by the test"
+			response.Invalid++
+		} else {
+			result.Status, result.ID = "created", fmt.Sprintf("feed-%d", len(s.keys))
+			s.keys[feed.SourceKey] = result.ID
+			response.Created++
+		}
+		response.Results = append(response.Results, result)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func newTestImporter(t *testing.T) (*Importer, *fakeFeedService, *bytes.Buffer) {
+	t.Helper()
+	service := &fakeFeedService{keys: make(map[string]string)}
+	server := httptest.NewServer(service)
+	t.Cleanup(server.Close)
+	state := &bytes.Buffer{}
+	return &Importer{
+		client:    NewFeedClient(server.URL+"/", server.Client()),
+		seen:      make(map[string]bool),
+		state:     state,
+		batchSize: 2,
+	}, service, state
+}
+
+func stateKeys(state *bytes.Buffer) []string {
+	return strings.Fields(state.String())
+}
+
+func TestImport(t *testing.T) {
+	im, service, state := newTestImporter(t)
+	entries := parseFile(t, "testdata/rss.xml")
+
+	stats, err := im.Import(context.Background(), entries)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	// La cuarta entrada repite el GUID de la primera
+	if stats != (ImportStats{Created: 3, Duplicated: 1}) {
+		t.Errorf("stats = %+v, want 3 created and 1 duplicated", stats)
+	}
+	if len(service.requests) != 2 || len(service.requests[0]) != 2 || len(service.requests[1]) != 1 {
+		t.Fatalf("requests = %+v, want batches of 2 and 1 feeds", service.requests)
+	}
+
+	first := service.requests[0][0]
+	published := time.Date(2024, 8, 13, 7, 30, 0, 0, time.UTC)
+	if first.SourceKey != entries[0].Key() || first.PublishedAt == nil || !first.PublishedAt.Equal(published) {
+		t.Errorf("first feed = %+v, want source_key %q and published_at %v", first, entries[0].Key(), published)
+	}
+	if first.Title != "Go 1.23 & los iteradores" || first.URL != "https://example.com/posts/go-1-23" || strings.Join(first.Tags, ",") != "go,release" {
+		t.Errorf("first feed = %+v, want the fields of the entry", first)
+	}
+	if third := service.requests[1][0]; third.PublishedAt != nil || !strings.HasPrefix(third.SourceKey, "sha256:") {
+		t.Errorf("third feed = %+v, want no published_at and a hashed source_key", third)
+	}
+	want := []string{entries[0].Key(), entries[1].Key(), entries[2].Key()}
+	if got := stateKeys(state); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("state = %q, want %q", got, want)
+	}
+
+	// Lo ya importado no se vuelve a enviar
+	stats, err = im.Import(context.Background(), entries)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if stats != (ImportStats{Duplicated: 4}) || len(service.requests) != 2 {
+		t.Errorf("second import: stats = %+v after %d requests, want 4 duplicated and no request", stats, len(service.requests))
+	}
+}
+
+func TestImportLostState(t *testing.T) {
+	im, service, _ := newTestImporter(t)
+	entries := parseFile(t, "testdata/atom.xml")
+	if _, err := im.Import(context.Background(), entries); err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+
+	// Sin el estado local, feed-service reconoce las entradas por su source_key
+	im.seen = make(map[string]bool)
+	state := &bytes.Buffer{}
+	im.state = state
+	stats, err := im.Import(context.Background(), entries)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if stats != (ImportStats{Duplicated: 2}) {
+		t.Errorf("stats = %+v, want 2 duplicated", stats)
+	}
+	if len(service.keys) != 2 {
+		t.Errorf("feed-service has %d feeds, want 2", len(service.keys))
+	}
+	if got := stateKeys(state); len(got) != 2 {
+		t.Errorf("state = %q, want the duplicated keys recorded", got)
+	}
+}
+
+func TestImportInvalidAndFailures(t *testing.T) {
+	im, service, state := newTestImporter(t)
+	entries := []*Entry{
+		{GUID: "sin-titulo"},
+		{GUID: "rechazada", Title: "rechazada"},
+		{GUID: "futura", Title: "futura", Published: time.Now().Add(time.Hour)},
+	}
+	stats, err := im.Import(context.Background(), entries)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if stats != (ImportStats{Created: 1, Invalid: 2}) {
+		t.Errorf("stats = %+v, want 1 created and 2 invalid", stats)
+	}
+	if got := stateKeys(state); len(got) != 1 || got[0] != "futura" {
+		t.Errorf("state = %q, want only futura", got)
+	}
+	if future := service.requests[0][1]; future.PublishedAt != nil {
+		t.Errorf("feed with a future date has published_at %v, want none", future.PublishedAt)
+	}
+
+	// Si feed-service falla, las entradas se reintentan en la siguiente llamada
+	service.fail = true
+	retry := []*Entry{{GUID: "reintento", Title: "reintento"}}
+	if _, err := im.Import(context.Background(), retry); err == nil {
+		t.Fatal("Import succeeded with feed-service failing")
+	}
+	service.fail = false
+	stats, err = im.Import(context.Background(), retry)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if stats.Created != 1 {
+		t.Errorf("stats after retrying = %+v, want 1 created", stats)
+	}
+}
@@ -0,0 +1,146 @@
+// feed-importer importa las entradas de documentos RSS 2.0 y Atom como feeds.
+// Los crea a través de POST /feeds/batch de feed-service, así que los eventos
+// llegan a query-service y pusher-service igual que con POST /feeds.
+//
+//	feed-importer -feed-service http://localhost:8080 blog.xml https://example.com/atom.xml
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Límites de los campos de un feed en feed-service
+const (
+	maxTitleLength       = 255
+	maxDescriptionLength = 255
+	maxAuthorLength      = 255
+	maxURLLength         = 2048
+	maxTags              = 20
+	maxTagLength         = 50
+	maxSourceKeyLength   = 255
+)
+
+func main() {
+	feedService := flag.String("feed-service", envOr("FEED_SERVICE_URL", "http://localhost:8080"), "base URL of feed-service")
+	statePath := flag.String("state", "feed-importer.state", "file with the keys of the entries already imported")
+	batchSize := flag.Int("batch-size", 500, "feeds per request to /feeds/batch (at most 1000)")
+	timeout := flag.Duration("timeout", 30*time.Second, "timeout of each HTTP request")
+	dryRun := flag.Bool("dry-run", false, "print the entries instead of importing them")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] file-or-url...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *batchSize < 1 || *batchSize > 1000 {
+		log.Fatalf("-batch-size must be between 1 and 1000")
+	}
+
+	seen, err := loadState(*statePath)
+	if err != nil {
+		log.Fatalf("Failed to load state: %s", err)
+	}
+	httpClient := &http.Client{Timeout: *timeout}
+	importer := &Importer{
+		client:    NewFeedClient(*feedService, httpClient),
+		seen:      seen,
+		batchSize: *batchSize,
+		dryRun:    *dryRun,
+	}
+	if !*dryRun {
+		state, err := os.OpenFile(*statePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			log.Fatalf("Failed to open state file: %s", err)
+		}
+		defer state.Close()
+		importer.state = state
+	}
+
+	ctx := context.Background()
+	failed := false
+	for _, source := range flag.Args() {
+		entries, err := readSource(ctx, httpClient, source)
+		if err != nil {
+			log.Printf("Skipping %s: %s", source, err)
+			failed = true
+			continue
+		}
+		stats, err := importer.Import(ctx, entries)
+		log.Printf("%s: %d entries, %d created, %d already imported, %d invalid", source, len(entries), stats.Created, stats.Duplicated, stats.Invalid)
+		if err != nil {
+			log.Printf("Failed to import %s: %s", source, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// readSource lee un documento de un archivo o de una URL http(s)
+func readSource(ctx context.Context, client *http.Client, source string) ([]*Entry, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return Parse(f)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/xml;q=0.9, */*;q=0.8")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return Parse(io.LimitReader(resp.Body, 32<<20))
+}
+
+// loadState lee las claves ya importadas, una por línea
+func loadState(path string) (map[string]bool, error) {
+	seen := make(map[string]bool)
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return seen, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		if key := scanner.Text(); key != "" {
+			seen[key] = true
+		}
+	}
+	return seen, scanner.Err()
+}
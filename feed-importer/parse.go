@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Entry es un elemento de un documento RSS o Atom
+type Entry struct {
+	GUID        string
+	Link        string
+	Title       string
+	Description string
+	Author      string
+	Categories  []string
+	Published   time.Time
+}
+
+// Key identifica la entrada para no importarla dos veces: el GUID (o id de
+// Atom), el enlace o, si no tiene ninguno, un hash del título y la
+// descripción. Las claves que no caben en el source_key de feed-service
+// también se reemplazan por su hash.
+func (e *Entry) Key() string {
+	key := e.GUID
+	if key == "" {
+		key = e.Link
+	}
+	if key == "" {
+		key = e.Title + "\n" + e.Description
+	} else if len(key) <= maxSourceKeyLength {
+		return key
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+type rssDocument struct {
+	Channel struct {
+		Items []struct {
+			GUID        string   `xml:"guid"`
+			Link        string   `xml:"link"`
+			Title       string   `xml:"title"`
+			Description string   `xml:"description"`
+			Author      string   `xml:"author"`
+			Creator     string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+			Categories  []string `xml:"category"`
+			PubDate     string   `xml:"pubDate"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+type atomDocument struct {
+	Entries []struct {
+		ID    string `xml:"id"`
+		Title string `xml:"title"`
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+		Authors []struct {
+			Name string `xml:"name"`
+		} `xml:"author"`
+		Categories []struct {
+			Term string `xml:"term,attr"`
+		} `xml:"category"`
+		Summary   string `xml:"summary"`
+		Content   string `xml:"content"`
+		Published string `xml:"published"`
+		Updated   string `xml:"updated"`
+	} `xml:"entry"`
+}
+
+// Parse lee un documento RSS 2.0 o Atom según su elemento raíz
+func Parse(r io.Reader) ([]*Entry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	root, err := rootElement(data)
+	if err != nil {
+		return nil, err
+	}
+	switch root {
+	case "rss":
+		return parseRSS(data)
+	case "feed":
+		return parseAtom(data)
+	default:
+		return nil, fmt.Errorf("unsupported document with root element <%s>", root)
+	}
+}
+
+func newDecoder(data []byte) *xml.Decoder {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = charsetReader
+	return decoder
+}
+
+func rootElement(data []byte) (string, error) {
+	decoder := newDecoder(data)
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", fmt.Errorf("invalid XML document: %w", err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local, nil
+		}
+	}
+}
+
+func parseRSS(data []byte) ([]*Entry, error) {
+	var doc rssDocument
+	if err := newDecoder(data).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid RSS document: %w", err)
+	}
+	entries := make([]*Entry, 0, len(doc.Channel.Items))
+	for _, item := range doc.Channel.Items {
+		entry := &Entry{
+			GUID:        strings.TrimSpace(item.GUID),
+			Link:        strings.TrimSpace(item.Link),
+			Title:       cleanText(item.Title),
+			Description: cleanText(item.Description),
+			Author:      cleanText(item.Creator),
+			Published:   parseTime(item.PubDate, time.RFC1123Z, time.RFC1123, "Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST"),
+		}
+		// <author> de RSS suele ser un correo, así que se prefiere dc:creator
+		if entry.Author == "" {
+			entry.Author = cleanText(item.Author)
+		}
+		for _, category := range item.Categories {
+			entry.Categories = append(entry.Categories, cleanText(category))
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func parseAtom(data []byte) ([]*Entry, error) {
+	var doc atomDocument
+	if err := newDecoder(data).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid Atom document: %w", err)
+	}
+	entries := make([]*Entry, 0, len(doc.Entries))
+	for _, item := range doc.Entries {
+		entry := &Entry{
+			GUID:        strings.TrimSpace(item.ID),
+			Title:       cleanText(item.Title),
+			Description: cleanText(item.Summary),
+			Published:   parseTime(item.Published, time.RFC3339),
+		}
+		if entry.Description == "" {
+			entry.Description = cleanText(item.Content)
+		}
+		if len(item.Authors) > 0 {
+			entry.Author = cleanText(item.Authors[0].Name)
+		}
+		for _, category := range item.Categories {
+			entry.Categories = append(entry.Categories, cleanText(category.Term))
+		}
+		if entry.Published.IsZero() {
+			entry.Published = parseTime(item.Updated, time.RFC3339)
+		}
+		// El enlace principal es rel="alternate", que es el valor por defecto
+		for _, link := range item.Links {
+			if link.Rel == "" || link.Rel == "alternate" {
+				entry.Link = strings.TrimSpace(link.Href)
+				break
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func parseTime(value string, layouts ...string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+var tagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// cleanText quita el HTML de títulos y descripciones y junta los espacios,
+// incluidos los &nbsp;
+func cleanText(s string) string {
+	s = tagPattern.ReplaceAllString(s, " ")
+	s = html.UnescapeString(s)
+	s = strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return ' '
+		}
+		return r
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// truncate corta s a max caracteres, terminando en "…" si hizo falta
+func truncate(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:max-1])) + "…"
+}
+
+// charsetReader admite, además de UTF-8, los documentos en ISO-8859-1 que
+// todavía publican algunos sitios
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "utf-8", "us-ascii", "ascii":
+		return input, nil
+	case "iso-8859-1", "latin1", "latin-1":
+		data, err := io.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return strings.NewReader(string(runes)), nil
+	default:
+		return nil, fmt.Errorf("unsupported charset %q", charset)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func parseFile(t *testing.T, path string) []*Entry {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	defer f.Close()
+	entries, err := Parse(f)
+	if err != nil {
+		t.Fatalf("Parse(%s): %v", path, err)
+	}
+	return entries
+}
+
+func TestParseRSS(t *testing.T) {
+	entries := parseFile(t, "testdata/rss.xml")
+	want := []*Entry{
+		{
+			GUID:        "tag:example.com,2024:go-1-23",
+			Link:        "https://example.com/posts/go-1-23",
+			Title:       "Go 1.23 & los iteradores",
+			Description: "Los iteradores llegan a Go. Más <detalles> dentro.",
+			Author:      "Ana Pérez",
+			Categories:  []string{"Go", "Release"},
+			Published:   time.Date(2024, 8, 13, 7, 30, 0, 0, time.UTC),
+		},
+		{
+			Link:        "https://example.com/posts/sin-guid",
+			Title:       "Sin GUID",
+			Description: "Solo tiene enlace",
+			Author:      "luis@example.com",
+			Published:   time.Date(2024, 8, 5, 18, 0, 0, 0, time.UTC),
+		},
+		{
+			Title:       "Sin GUID ni enlace",
+			Description: "Se identifica por su contenido",
+		},
+		{
+			GUID:  "tag:example.com,2024:go-1-23",
+			Link:  "https://example.com/posts/go-1-23",
+			Title: "Go 1.23 & los iteradores (repetida)",
+		},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("Parse returned %d entries, want %d", len(entries), len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(entries[i], want[i]) {
+			t.Errorf("entry %d = %+v, want %+v", i, entries[i], want[i])
+		}
+	}
+}
+
+func TestParseAtom(t *testing.T) {
+	entries := parseFile(t, "testdata/atom.xml")
+	want := []*Entry{
+		{
+			GUID:        "urn:uuid:1225c695-cfb8-4ebb-aaaa-80da344efa6a",
+			Link:        "https://example.com/posts/generics",
+			Title:       "Generics en la práctica",
+			Description: "Un resumen",
+			Author:      "Ana Pérez",
+			Categories:  []string{"go", "generics"},
+			Published:   time.Date(2024, 8, 1, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			GUID:        "urn:uuid:5c6b1a7e-1a2b-4c3d-9e8f-0a1b2c3d4e5f",
+			Link:        "https://example.com/posts/contenido",
+			Title:       "Solo contenido",
+			Description: "Sin resumen",
+			Published:   time.Date(2024, 8, 3, 12, 0, 0, 0, time.UTC),
+		},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("Parse returned %d entries, want %d", len(entries), len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(entries[i], want[i]) {
+			t.Errorf("entry %d = %+v, want %+v", i, entries[i], want[i])
+		}
+	}
+}
+
+func TestParseLatin1(t *testing.T) {
+	entries := parseFile(t, "testdata/latin1.xml")
+	if len(entries) != 1 {
+		t.Fatalf("Parse returned %d entries, want 1", len(entries))
+	}
+	entry := entries[0]
+	if entry.Title != "Año nuevo, versión nueva" || entry.Description != "Pequeños cambios en la compilación" {
+		t.Errorf("entry = %+v, want the ISO-8859-1 text decoded", entry)
+	}
+	if !reflect.DeepEqual(entry.Categories, []string{"Señales"}) {
+		t.Errorf("Categories = %q, want [Señales]", entry.Categories)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"not XML":         "not xml at all",
+		"unknown root":    `<?xml version="1.0"?><html><body/></html>`,
+		"unknown charset": `<?xml version="1.0" encoding="Shift_JIS"?><rss><channel/></rss>`,
+		"broken RSS":      `<rss><channel><item><title>sin cerrar</channel></rss>`,
+	}
+	for name, doc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if entries, err := Parse(strings.NewReader(doc)); err == nil {
+				t.Errorf("Parse = %+v, want an error", entries)
+			}
+		})
+	}
+}
+
+func TestEntryKey(t *testing.T) {
+	long := "https://example.com/" + strings.Repeat("a", maxSourceKeyLength)
+	tests := []struct {
+		name  string
+		entry Entry
+		want  string
+	}{
+		{"GUID", Entry{GUID: "guid-1", Link: "https://example.com/1"}, "guid-1"},
+		{"Link", Entry{Link: "https://example.com/1"}, "https://example.com/1"},
+		{"Content", Entry{Title: "a", Description: "b"}, "sha256:7e18f737311b2dc3b2f269dd78396b0351f14fb66efa879f768cb23181883c78"},
+		{"LongLink", Entry{Link: long}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := tt.entry.Key()
+			if tt.want != "" && key != tt.want {
+				t.Errorf("Key() = %q, want %q", key, tt.want)
+			}
+			if len(key) > maxSourceKeyLength {
+				t.Errorf("Key() has %d bytes, more than the %d source_key allows", len(key), maxSourceKeyLength)
+			}
+		})
+	}
+
+	// Las claves largas son estables y distintas entre sí
+	a, b := Entry{Link: long}, Entry{Link: long + "b"}
+	if a.Key() != (&Entry{Link: long}).Key() || a.Key() == b.Key() {
+		t.Errorf("keys of long links are not stable and distinct: %q, %q", a.Key(), b.Key())
+	}
+}
+
+func TestCleanText(t *testing.T) {
+	tests := map[string]string{
+		"plain":                        "plain",
+		"  spaced \n\t out  ":          "spaced out",
+		"<p>Hola <b>mundo</b></p>":     "Hola mundo",
+		"a &amp; b &lt;c&gt; &#233;":   "a & b <c> é",
+		"&lt;b&gt;escaped&lt;/b&gt;":   "<b>escaped</b>",
+		"line\x00break\x7fhere":        "line break here",
+		"non&nbsp;breaking\u00a0space": "non breaking space",
+		"":                             "",
+	}
+	for in, want := range tests {
+		if got := cleanText(in); got != want {
+			t.Errorf("cleanText(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		in   string
+		max  int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"exactly10!", 10, "exactly10!"},
+		{"this is too long", 10, "this is t…"},
+		{"trailing space here", 9, "trailing…"},
+		{"ñandú ñandú ñandú", 8, "ñandú ñ…"},
+	}
+	for _, tt := range tests {
+		got := truncate(tt.in, tt.max)
+		if got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.in, tt.max, got, tt.want)
+		}
+		if n := len([]rune(got)); n > tt.max {
+			t.Errorf("truncate(%q, %d) has %d characters", tt.in, tt.max, n)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/segmentio/ksuid"
+	"platzi.com/go/cqrs/events"
+	"platzi.com/go/cqrs/models"
+	"platzi.com/go/cqrs/problem"
+	"platzi.com/go/cqrs/repository"
+)
+
+const (
+	maxBatchSize      = 1000
+	maxBatchBodyBytes = 32 << 20
+	ndjsonContentType = "application/x-ndjson"
+)
+
+var errBatchTooLarge = fmt.Errorf("a batch must have at most %d feeds", maxBatchSize)
+
+// Estados de cada elemento de un lote
+const (
+	batchItemCreated   = "created"
+	batchItemInvalid   = "invalid"
+	batchItemDuplicate = "duplicate"
+)
+
+type batchItemResult struct {
+	Index  int                  `json:"index"`
+	Status string               `json:"status"`
+	ID     string               `json:"id,omitempty"`
+	Detail string               `json:"detail,omitempty"`
+	Errors []problem.FieldError `json:"errors,omitempty"`
+}
+
+type batchResponse struct {
+	Created    int               `json:"created"`
+	Invalid    int               `json:"invalid"`
+	Duplicated int               `json:"duplicated"`
+	Results    []batchItemResult `json:"results"`
+}
+
+// createFeedsBatchHandler crea varios feeds en una sola transacción. Acepta
+// un array JSON o, con Content-Type application/x-ndjson, un feed por línea.
+// Los elementos inválidos no se insertan y se informan en su resultado, igual
+// que los que tienen el source_key de un feed ya importado (o de otro elemento
+// del lote), que se informan como duplicados con el ID de ese feed.
+func createFeedsBatchHandler(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	items, err := decodeBatch(http.MaxBytesReader(w, r.Body, maxBatchBodyBytes), mediaType == ndjsonContentType)
+	if errors.Is(err, errBatchTooLarge) {
+		problem.Error(w, r, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+	if err != nil {
+		problem.FromDecodeError(err).Write(w, r)
+		return
+	}
+	if len(items) == 0 {
+		problem.Error(w, r, http.StatusBadRequest, "A batch must have at least one feed")
+		return
+	}
+
+	response := batchResponse{Results: make([]batchItemResult, len(items))}
+	feeds := make([]*models.Feed, 0, len(items))
+	// indexes es la posición en el lote de cada feed
+	indexes := make([]int, 0, len(items))
+	createdAt := time.Now().UTC()
+	for i, raw := range items {
+		result := &response.Results[i]
+		result.Index = i
+
+		var req createFeedRequest
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&req); err != nil {
+			p := problem.FromDecodeError(err)
+			result.Status, result.Detail, result.Errors = batchItemInvalid, p.Detail, p.Errors
+			continue
+		}
+		if errs := req.validate(); len(errs) > 0 {
+			result.Status, result.Errors = batchItemInvalid, errs
+			continue
+		}
+
+		id, err := ksuid.NewRandom()
+		if err != nil {
+			problem.Error(w, r, http.StatusInternalServerError, "Failed to generate feed ID")
+			return
+		}
+		result.Status, result.ID = batchItemCreated, id.String()
+		feeds = append(feeds, req.feed(id.String(), createdAt))
+		indexes = append(indexes, i)
+	}
+
+	// Un feed que repite el source_key de otro anterior del lote es un
+	// duplicado de ese; los que ya están en la base los omite InsertFeeds
+	type repeat struct {
+		index int
+		key   string
+	}
+	var repeats []repeat
+	firstIDs := make(map[string]string)
+	kept, keptIndexes := feeds[:0], indexes[:0]
+	for i, feed := range feeds {
+		if feed.SourceKey != "" {
+			if _, ok := firstIDs[feed.SourceKey]; ok {
+				repeats = append(repeats, repeat{indexes[i], feed.SourceKey})
+				continue
+			}
+			firstIDs[feed.SourceKey] = feed.ID
+		}
+		kept, keptIndexes = append(kept, feed), append(keptIndexes, indexes[i])
+	}
+	feeds, indexes = kept, keptIndexes
+
+	existing := map[string]string{}
+	if len(feeds) > 0 {
+		existing, err = repository.InsertFeeds(r.Context(), feeds)
+		if err != nil {
+			log.Printf("Failed to insert %d feeds: %v", len(feeds), err)
+			problem.Error(w, r, http.StatusInternalServerError, "Failed to insert feeds")
+			return
+		}
+	}
+	created := feeds[:0]
+	for i, feed := range feeds {
+		if id, ok := existing[feed.SourceKey]; ok {
+			result := &response.Results[indexes[i]]
+			result.Status, result.ID = batchItemDuplicate, id
+			response.Duplicated++
+			continue
+		}
+		created = append(created, feed)
+	}
+	for _, rep := range repeats {
+		id, ok := existing[rep.key]
+		if !ok {
+			id = firstIDs[rep.key]
+		}
+		result := &response.Results[rep.index]
+		result.Status, result.ID = batchItemDuplicate, id
+		response.Duplicated++
+	}
+	response.Created = len(created)
+	response.Invalid = len(items) - response.Created - response.Duplicated
+
+	if len(created) > 0 {
+		if err := events.PublishCreatedFeeds(r.Context(), created); err != nil {
+			log.Printf("Failed to publish created feed events: %v", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// decodeBatch separa el cuerpo en los elementos del lote sin decodificarlos,
+// para poder validar cada uno por separado
+func decodeBatch(body io.Reader, ndjson bool) ([]json.RawMessage, error) {
+	decoder := json.NewDecoder(body)
+	var items []json.RawMessage
+	if ndjson {
+		for {
+			var raw json.RawMessage
+			err := decoder.Decode(&raw)
+			if err == io.EOF {
+				return items, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			if len(items) == maxBatchSize {
+				return nil, errBatchTooLarge
+			}
+			items = append(items, raw)
+		}
+	}
+
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if token != json.Delim('[') {
+		return nil, errors.New("request body must be a JSON array of feeds")
+	}
+	for decoder.More() {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return nil, err
+		}
+		if len(items) == maxBatchSize {
+			return nil, errBatchTooLarge
+		}
+		items = append(items, raw)
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("request body must contain a single JSON array")
+	}
+	return items, nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"platzi.com/go/cqrs/models"
+)
+
+// InsertFeeds omite los feeds cuyo source_key ya existe, como el ON CONFLICT
+// DO NOTHING de Postgres, y devuelve el ID guardado de cada clave omitida
+func (r *fakeRepository) InsertFeeds(ctx context.Context, feeds []*models.Feed) (map[string]string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	skipped := make(map[string]string)
+	for _, feed := range feeds {
+		if id, ok := r.sourceKeys[feed.SourceKey]; ok && feed.SourceKey != "" {
+			skipped[feed.SourceKey] = id
+			continue
+		}
+		r.insert(feed)
+	}
+	return skipped, nil
+}
+
+func postBatch(t *testing.T, contentType, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/feeds/batch", strings.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	createFeedsBatchHandler(rec, r)
+	return rec
+}
+
+func TestCreateFeedsBatch(t *testing.T) {
+	items := []string{
+		`{"title":"Go","source_key":"new"}`,
+		`{"title":""}`,
+		`{"title":"Go","votes":1}`,
+		`{"title":"Go again","source_key":"new"}`,
+		`{"title":"Imported","source_key":"taken"}`,
+		`{"title":"Imported again","source_key":"taken"}`,
+		`{"title":"No key"}`,
+	}
+	want := []struct {
+		status string
+		id     string
+	}{
+		{batchItemCreated, ""},
+		{batchItemInvalid, ""},
+		{batchItemInvalid, ""},
+		{batchItemDuplicate, "0"},
+		{batchItemDuplicate, "feed-0"},
+		{batchItemDuplicate, "feed-0"},
+		{batchItemCreated, ""},
+	}
+	forms := []struct {
+		name, contentType, body string
+	}{
+		{"array", "application/json", "[" + strings.Join(items, ",") + "]"},
+		{"ndjson", ndjsonContentType + "; charset=utf-8", strings.Join(items, "\n") + "\n"},
+	}
+	for _, form := range forms {
+		t.Run(form.name, func(t *testing.T) {
+			repo, store := setupFakes(t)
+			repo.sourceKeys["taken"] = "feed-0"
+
+			rec := postBatch(t, form.contentType, form.body)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+			var response batchResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if response.Created != 2 || response.Invalid != 2 || response.Duplicated != 3 {
+				t.Errorf("counts = %d created, %d invalid, %d duplicated, want 2, 2 and 3", response.Created, response.Invalid, response.Duplicated)
+			}
+			if len(response.Results) != len(want) {
+				t.Fatalf("got %d results, want %d", len(response.Results), len(want))
+			}
+			for i, result := range response.Results {
+				w := want[i]
+				// "0" es el ID asignado al primer elemento del lote
+				if w.id == "0" {
+					w.id = response.Results[0].ID
+				}
+				if result.Index != i || result.Status != w.status || (w.id != "" && result.ID != w.id) {
+					t.Errorf("result %d = %+v, want %s %s", i, result, w.status, w.id)
+				}
+			}
+			if len(response.Results[1].Errors) == 0 || response.Results[2].Detail == "" {
+				t.Errorf("invalid results without details: %+v, %+v", response.Results[1], response.Results[2])
+			}
+			if len(store.created) != 2 || len(repo.feeds) != 2 {
+				t.Errorf("stored %d feeds and published %d events, want 2 and 2", len(repo.feeds), len(store.created))
+			}
+		})
+	}
+}
+
+func TestCreateFeedsBatchRejected(t *testing.T) {
+	tooMany := "[" + strings.TrimSuffix(strings.Repeat(`{"title":"Go"},`, maxBatchSize+1), ",") + "]"
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"empty", "[]", http.StatusBadRequest},
+		{"object", `{"title":"Go"}`, http.StatusBadRequest},
+		{"malformed", `[{"title":`, http.StatusBadRequest},
+		{"too many feeds", tooMany, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, _ := setupFakes(t)
+			rec := postBatch(t, "application/json", tt.body)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if len(repo.feeds) != 0 {
+				t.Errorf("stored %d feeds", len(repo.feeds))
+			}
+		})
+	}
+}
+
+func TestDecodeBatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		ndjson bool
+		want   int
+		err    bool
+	}{
+		{"array", `[{"title":"a"}, {"title":"b"}]`, false, 2, false},
+		{"empty array", `[]`, false, 0, false},
+		{"array with spaces", " [ {} ] \n", false, 1, false},
+		{"not an array", `{"title":"a"}`, false, 0, true},
+		{"trailing data", `[{}] [{}]`, false, 0, true},
+		{"unterminated array", `[{}`, false, 0, true},
+		{"ndjson", "{\"title\":\"a\"}\n{\"title\":\"b\"}\n{}", true, 3, false},
+		{"ndjson blank lines", "\n{}\n\n{}\n", true, 2, false},
+		{"ndjson empty", "", true, 0, false},
+		{"ndjson malformed", "{}\n{\"title\":", true, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := decodeBatch(strings.NewReader(tt.body), tt.ndjson)
+			if (err != nil) != tt.err {
+				t.Fatalf("decodeBatch error = %v, want error %v", err, tt.err)
+			}
+			if len(items) != tt.want {
+				t.Errorf("decodeBatch returned %d items, want %d", len(items), tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeBatchTooLarge(t *testing.T) {
+	for _, ndjson := range []bool{false, true} {
+		body := strings.Repeat("{}\n", maxBatchSize+1)
+		if !ndjson {
+			body = "[" + strings.TrimSuffix(strings.Repeat("{},", maxBatchSize+1), ",") + "]"
+		}
+		if _, err := decodeBatch(strings.NewReader(body), ndjson); !errors.Is(err, errBatchTooLarge) {
+			t.Errorf("decodeBatch(ndjson=%v) error = %v, want %v", ndjson, err, errBatchTooLarge)
+		}
+		body = strings.Repeat("{}\n", maxBatchSize)
+		if !ndjson {
+			body = "[" + strings.TrimSuffix(strings.Repeat("{},", maxBatchSize), ",") + "]"
+		}
+		if items, err := decodeBatch(strings.NewReader(body), ndjson); err != nil || len(items) != maxBatchSize {
+			t.Errorf("decodeBatch(ndjson=%v) of %d items = %d, %v", ndjson, maxBatchSize, len(items), err)
+		}
+	}
+}
@@ -2,51 +2,277 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
 	"time"
-	"log"
 
+	"github.com/gorilla/mux"
 	"github.com/segmentio/ksuid"
 	"platzi.com/go/cqrs/events"
 	"platzi.com/go/cqrs/models"
+	"platzi.com/go/cqrs/problem"
 	"platzi.com/go/cqrs/repository"
 )
 
+// Límites de los campos de un feed, iguales a las columnas de la tabla feeds
+const (
+	maxTitleLength       = 255
+	maxDescriptionLength = 255
+	maxAuthorLength      = 255
+	maxURLLength         = 2048
+	maxBodyLength        = 100000
+	maxTags              = 20
+	maxTagLength         = 50
+	maxSourceKeyLength   = 255
+	maxFeedBodyBytes     = 512 << 10
+)
+
+// languagePattern acepta etiquetas de idioma BCP 47 como "es" o "pt-BR"
+var languagePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// feedContentFields son los campos editables de un feed en las peticiones
+type feedContentFields struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Author      string   `json:"author"`
+	URL         string   `json:"url"`
+	Tags        []string `json:"tags"`
+	Body        string   `json:"body"`
+	Language    string   `json:"language"`
+}
+
+// validate recorta y normaliza los campos y agrega sus errores a v
+func (c *feedContentFields) validate(v *problem.Validator) {
+	c.Title = strings.TrimSpace(c.Title)
+	c.Description = strings.TrimSpace(c.Description)
+	c.Author = strings.TrimSpace(c.Author)
+	c.URL = strings.TrimSpace(c.URL)
+	c.Body = strings.TrimSpace(c.Body)
+	c.Language = strings.TrimSpace(c.Language)
+
+	v.Required("title", c.Title)
+	v.MaxLength("title", c.Title, maxTitleLength)
+	v.SingleLine("title", c.Title)
+	v.MaxLength("description", c.Description, maxDescriptionLength)
+	v.Text("description", c.Description)
+	v.MaxLength("author", c.Author, maxAuthorLength)
+	v.SingleLine("author", c.Author)
+	if c.URL != "" {
+		v.MaxLength("url", c.URL, maxURLLength)
+		u, err := url.Parse(c.URL)
+		v.Check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "url", "must be an absolute http or https URL")
+	}
+	v.MaxLength("body", c.Body, maxBodyLength)
+	v.Text("body", c.Body)
+	if c.Language != "" {
+		v.Check(len(c.Language) <= 35 && languagePattern.MatchString(c.Language), "language", "must be a language tag such as es or pt-BR")
+	}
+	c.Tags = normalizeTags(c.Tags)
+	v.Check(len(c.Tags) <= maxTags, "tags", fmt.Sprintf("must have at most %d tags", maxTags))
+	for _, tag := range c.Tags {
+		v.MaxLength("tags", tag, maxTagLength)
+		v.SingleLine("tags", tag)
+	}
+}
+
+func (c *feedContentFields) content() models.FeedContent {
+	return models.FeedContent{
+		Title:       c.Title,
+		Description: c.Description,
+		Author:      c.Author,
+		URL:         c.URL,
+		Tags:        c.Tags,
+		Body:        c.Body,
+		Language:    c.Language,
+	}
+}
+
 type createFeedRequest struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
+	feedContentFields
+	Status    string     `json:"status"`
+	PublishAt *time.Time `json:"publish_at"`
+	// PublishedAt y SourceKey los envían los importadores: la fecha original
+	// de la entrada y la clave que evita importarla dos veces
+	PublishedAt *time.Time `json:"published_at"`
+	SourceKey   string     `json:"source_key"`
+}
+
+// validate recorta y normaliza los campos y devuelve los errores de validación
+func (req *createFeedRequest) validate() []problem.FieldError {
+	req.Status = strings.TrimSpace(req.Status)
+	if req.Status == "" {
+		req.Status = models.FeedStatusPublished
+	}
+	req.SourceKey = strings.TrimSpace(req.SourceKey)
+
+	var v problem.Validator
+	req.feedContentFields.validate(&v)
+	v.MaxLength("source_key", req.SourceKey, maxSourceKeyLength)
+	v.SingleLine("source_key", req.SourceKey)
+	if req.PublishedAt != nil {
+		v.Check(req.Status == models.FeedStatusPublished && req.PublishAt == nil, "published_at", "is only allowed for feeds published when created")
+		v.Check(!req.PublishedAt.After(time.Now()), "published_at", "must not be in the future")
+	}
+	switch req.Status {
+	case models.FeedStatusDraft, models.FeedStatusArchived:
+		v.Check(req.PublishAt == nil, "publish_at", "must be empty for draft or archived feeds")
+	case models.FeedStatusScheduled:
+		v.Check(req.PublishAt != nil, "publish_at", "is required for scheduled feeds")
+	case models.FeedStatusPublished:
+	default:
+		v.Check(false, "status", "must be one of draft, scheduled, published or archived")
+	}
+	return v.Errors
+}
+
+// feed crea el feed con los campos de la petición ya validados. Un feed con
+// publish_at futuro queda programado; si publish_at ya pasó, se publica al
+// crearlo. Un feed publicado conserva el published_at de la petición.
+func (req *createFeedRequest) feed(id string, createdAt time.Time) *models.Feed {
+	feed := &models.Feed{
+		ID:        id,
+		Status:    req.Status,
+		SourceKey: req.SourceKey,
+		CreatedAt: createdAt,
+	}
+	feed.SetContent(req.content())
+	if req.PublishAt != nil {
+		publishAt := req.PublishAt.UTC()
+		feed.PublishAt = &publishAt
+		feed.Status = models.FeedStatusScheduled
+		if !publishAt.After(createdAt) {
+			feed.Status = models.FeedStatusPublished
+		}
+	}
+	if feed.Status == models.FeedStatusPublished {
+		publishedAt := createdAt
+		if req.PublishedAt != nil {
+			publishedAt = req.PublishedAt.UTC()
+		}
+		feed.PublishedAt = &publishedAt
+	}
+	return feed
+}
+
+// normalizeTags pasa las etiquetas a minúsculas y quita las vacías y repetidas
+func normalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
 }
 
 // CreateFeedHandler maneja la creación de feeds
 func createFeedHandler(w http.ResponseWriter, r *http.Request) {
 	var req createFeedRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Failed to decode request", http.StatusBadRequest)
+	if !problem.DecodeJSON(w, r, &req, maxFeedBodyBytes) {
+		return
+	}
+	if errs := req.validate(); len(errs) > 0 {
+		problem.Invalid(w, r, errs)
 		return
 	}
 
+	if req.SourceKey != "" {
+		existing, err := repository.FindFeedsBySourceKey(r.Context(), []string{req.SourceKey})
+		if err != nil {
+			log.Printf("Failed to look up source key: %v", err)
+			problem.Error(w, r, http.StatusInternalServerError, "Failed to insert feed")
+			return
+		}
+		if id, ok := existing[req.SourceKey]; ok {
+			problem.Error(w, r, http.StatusConflict, fmt.Sprintf("Feed %s was already imported with this source_key", id))
+			return
+		}
+	}
+
 	createdAt := time.Now().UTC()
 	id, err := ksuid.NewRandom()
 	if err != nil {
-		http.Error(w, "Failed to generate feed ID", http.StatusInternalServerError)
+		problem.Error(w, r, http.StatusInternalServerError, "Failed to generate feed ID")
 		return
 	}
 
-	feed := &models.Feed{
-		ID:          id.String(),
-		Title:       req.Title,
-		Description: req.Description,
-		CreatedAt:   createdAt,
-	}
+	feed := req.feed(id.String(), createdAt)
 	if err := repository.InsertFeed(r.Context(), feed); err != nil {
-		http.Error(w, "Failed to insert feed", http.StatusInternalServerError)
-		return	
+		log.Printf("Failed to insert feed: %v", err)
+		problem.Error(w, r, http.StatusInternalServerError, "Failed to insert feed")
+		return
 	}
+	// El feed ya está guardado: responder 5xx haría que el cliente lo
+	// creara otra vez al reintentar
 	if err := events.PublishCreatedFeed(r.Context(), feed); err != nil {
-		log.Printf("Failed to publish created feed event: %v", err)
-		return
+		log.Printf("Warning: feed %s created but its created feed event was not published: %v", feed.ID, err)
 	}
-	w.WriteHeader(http.StatusCreated)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(feed) 
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(feed)
+}
+
+const errNotPublishable = "Only draft or scheduled feeds can be published"
+
+type publishFeedRequest struct {
+	PublishAt *time.Time `json:"publish_at"`
+}
+
+// publishFeedHandler programa un borrador (o reprograma un feed programado)
+// para publish_at, o para ahora si no se indica. La publicación la hace el
+// Scheduler, así que responde 202 con el feed en estado scheduled.
+func publishFeedHandler(scheduler *Scheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req publishFeedRequest
+		if r.ContentLength != 0 && !problem.DecodeJSON(w, r, &req, maxFeedBodyBytes) {
+			return
+		}
+		now := time.Now().UTC()
+		publishAt := now
+		if req.PublishAt != nil {
+			publishAt = req.PublishAt.UTC()
+		}
+
+		id := mux.Vars(r)["id"]
+		feed, err := repository.GetFeed(r.Context(), id)
+		if err != nil {
+			log.Printf("Failed to get feed %s: %v", id, err)
+			problem.Error(w, r, http.StatusInternalServerError, "Failed to get feed")
+			return
+		}
+		// Los feeds en la papelera no se pueden publicar
+		if feed == nil || feed.DeletedAt != nil {
+			problem.Error(w, r, http.StatusNotFound, "Feed not found")
+			return
+		}
+		if feed.Status != models.FeedStatusDraft && feed.Status != models.FeedStatusScheduled {
+			problem.Error(w, r, http.StatusConflict, errNotPublishable)
+			return
+		}
+		feed, err = repository.ScheduleFeed(r.Context(), id, publishAt)
+		if err != nil {
+			log.Printf("Failed to schedule feed %s: %v", id, err)
+			problem.Error(w, r, http.StatusInternalServerError, "Failed to schedule feed")
+			return
+		}
+		// nil si el Scheduler lo publicó después de leerlo
+		if feed == nil {
+			problem.Error(w, r, http.StatusConflict, errNotPublishable)
+			return
+		}
+		if !publishAt.After(now) {
+			scheduler.Wake()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(feed)
+	}
 }
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"platzi.com/go/cqrs/events"
+	"platzi.com/go/cqrs/models"
+	"platzi.com/go/cqrs/problem"
+	"platzi.com/go/cqrs/repository"
+)
+
+// fakeRepository guarda los feeds en memoria. El Repository embebido es nil,
+// así que cualquier otro método entra en pánico si un handler lo llama.
+type fakeRepository struct {
+	repository.Repository
+	mutex sync.Mutex
+	// feeds son los feeds guardados por ID
+	feeds map[string]*models.Feed
+	// sourceKeys es el ID del feed guardado con cada source_key
+	sourceKeys map[string]string
+	// idempotencyKeys son las claves reservadas por Idempotency-Key
+	idempotencyKeys map[string]*models.IdempotencyKey
+}
+
+func newFakeRepository() *fakeRepository {
+	return &fakeRepository{
+		feeds:           make(map[string]*models.Feed),
+		sourceKeys:      make(map[string]string),
+		idempotencyKeys: make(map[string]*models.IdempotencyKey),
+	}
+}
+
+func (r *fakeRepository) InsertFeed(ctx context.Context, feed *models.Feed) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.insert(feed)
+	return nil
+}
+
+// insert guarda el feed. Debe llamarse con el mutex tomado.
+func (r *fakeRepository) insert(feed *models.Feed) {
+	r.feeds[feed.ID] = feed
+	if feed.SourceKey != "" {
+		r.sourceKeys[feed.SourceKey] = feed.ID
+	}
+}
+
+func (r *fakeRepository) FindFeedsBySourceKey(ctx context.Context, keys []string) (map[string]string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	found := make(map[string]string)
+	for _, key := range keys {
+		if id, ok := r.sourceKeys[key]; ok {
+			found[key] = id
+		}
+	}
+	return found, nil
+}
+
+// fakeEventStore guarda los feeds de los eventos publicados. El EventStore
+// embebido es nil, igual que el Repository de fakeRepository.
+type fakeEventStore struct {
+	events.EventStore
+	mutex   sync.Mutex
+	created []*models.Feed
+}
+
+func (s *fakeEventStore) PublishCreatedFeed(ctx context.Context, feed *models.Feed) error {
+	return s.PublishCreatedFeeds(ctx, []*models.Feed{feed})
+}
+
+func (s *fakeEventStore) PublishCreatedFeeds(ctx context.Context, feeds []*models.Feed) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.created = append(s.created, feeds...)
+	return nil
+}
+
+// setupFakes instala un repositorio y un event store en memoria
+func setupFakes(t *testing.T) (*fakeRepository, *fakeEventStore) {
+	t.Helper()
+	repo, store := newFakeRepository(), &fakeEventStore{}
+	repository.SetRepository(repo)
+	events.SetEventStore(store)
+	t.Cleanup(func() {
+		repository.SetRepository(nil)
+		events.SetEventStore(nil)
+	})
+	return repo, store
+}
+
+// decodeProblem lee una respuesta de error RFC 7807
+func decodeProblem(t *testing.T, rec *httptest.ResponseRecorder) problem.Problem {
+	t.Helper()
+	var p problem.Problem
+	if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+		t.Fatalf("decoding problem: %v", err)
+	}
+	return p
+}
+
+func fieldNames(errs []problem.FieldError) []string {
+	fields := []string{}
+	for _, e := range errs {
+		fields = append(fields, e.Field)
+	}
+	return fields
+}
+
+func TestFeedContentFieldsValidate(t *testing.T) {
+	long := func(n int) string { return strings.Repeat("a", n) }
+	tests := []struct {
+		name   string
+		fields feedContentFields
+		want   []string
+	}{
+		{"valid", feedContentFields{Title: "Go", URL: "https://go.dev", Language: "pt-BR", Tags: []string{"go"}}, []string{}},
+		{"title required", feedContentFields{Title: "   "}, []string{"title"}},
+		{"title too long", feedContentFields{Title: long(maxTitleLength + 1)}, []string{"title"}},
+		{"title with newline", feedContentFields{Title: "a\nb"}, []string{"title"}},
+		{"description allows newlines", feedContentFields{Title: "Go", Description: "a\nb\tc"}, []string{}},
+		{"description with control", feedContentFields{Title: "Go", Description: "a\x00b"}, []string{"description"}},
+		{"author with control", feedContentFields{Title: "Go", Author: "a\tb"}, []string{"author"}},
+		{"relative url", feedContentFields{Title: "Go", URL: "/feeds/1"}, []string{"url"}},
+		{"ftp url", feedContentFields{Title: "Go", URL: "ftp://go.dev"}, []string{"url"}},
+		{"url too long", feedContentFields{Title: "Go", URL: "https://go.dev/" + long(maxURLLength)}, []string{"url"}},
+		{"body too long", feedContentFields{Title: "Go", Body: long(maxBodyLength + 1)}, []string{"body"}},
+		{"bad language", feedContentFields{Title: "Go", Language: "spanish!"}, []string{"language"}},
+		{"repeated tags", feedContentFields{Title: "Go", Tags: strings.Split(strings.Repeat("go,", maxTags+1), ",")}, []string{}},
+		{"too many tags", feedContentFields{Title: "Go", Tags: strings.Split("abcdefghijklmnopqrstu", "")}, []string{"tags"}},
+		{"tag too long", feedContentFields{Title: "Go", Tags: []string{long(maxTagLength + 1)}}, []string{"tags"}},
+		{"several fields", feedContentFields{URL: "nope", Language: "x"}, []string{"title", "url", "language"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v problem.Validator
+			tt.fields.validate(&v)
+			if got := fieldNames(v.Errors); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("invalid fields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFeedContentFieldsNormalize(t *testing.T) {
+	fields := feedContentFields{Title: "  Go  ", URL: " https://go.dev ", Tags: []string{" Go", "go", "", "CQRS "}}
+	var v problem.Validator
+	fields.validate(&v)
+	if !v.Valid() {
+		t.Fatalf("validate errors = %+v", v.Errors)
+	}
+	if fields.Title != "Go" || fields.URL != "https://go.dev" {
+		t.Errorf("fields = %+v, want them trimmed", fields)
+	}
+	if want := []string{"go", "cqrs"}; !reflect.DeepEqual(fields.Tags, want) {
+		t.Errorf("tags = %v, want %v", fields.Tags, want)
+	}
+}
+
+func TestCreateFeedRequestValidate(t *testing.T) {
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{"published by default", `{"title":"Go"}`, []string{}},
+		{"unknown status", `{"title":"Go","status":"hidden"}`, []string{"status"}},
+		{"scheduled without publish_at", `{"title":"Go","status":"scheduled"}`, []string{"publish_at"}},
+		{"draft with publish_at", fmt.Sprintf(`{"title":"Go","status":"draft","publish_at":%q}`, future.Format(time.RFC3339)), []string{"publish_at"}},
+		{"imported", fmt.Sprintf(`{"title":"Go","published_at":%q,"source_key":"k1"}`, past.Format(time.RFC3339)), []string{}},
+		{"published_at in the future", fmt.Sprintf(`{"title":"Go","published_at":%q}`, future.Format(time.RFC3339)), []string{"published_at"}},
+		{"published_at on a draft", fmt.Sprintf(`{"title":"Go","status":"draft","published_at":%q}`, past.Format(time.RFC3339)), []string{"published_at"}},
+		{"source_key with newline", `{"title":"Go","source_key":"a\nb"}`, []string{"source_key"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req createFeedRequest
+			if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if got := fieldNames(req.validate()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("invalid fields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateFeedHandler(t *testing.T) {
+	repo, store := setupFakes(t)
+	repo.sourceKeys["taken"] = "feed-0"
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		fields []string
+	}{
+		{"created", `{"title":" Go ","tags":["Go"],"source_key":"k1"}`, http.StatusCreated, nil},
+		{"invalid", `{"title":"","url":"nope"}`, http.StatusUnprocessableEntity, []string{"title", "url"}},
+		{"unknown field", `{"title":"Go","votes":1}`, http.StatusBadRequest, nil},
+		{"source_key taken", `{"title":"Go","source_key":"taken"}`, http.StatusConflict, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			createFeedHandler(rec, httptest.NewRequest(http.MethodPost, "/feeds", strings.NewReader(tt.body)))
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status >= http.StatusBadRequest {
+				if p := decodeProblem(t, rec); tt.fields != nil && !reflect.DeepEqual(fieldNames(p.Errors), tt.fields) {
+					t.Errorf("invalid fields = %v, want %v", fieldNames(p.Errors), tt.fields)
+				}
+			}
+		})
+	}
+
+	if len(repo.feeds) != 1 || len(store.created) != 1 {
+		t.Fatalf("stored %d feeds and published %d events, want 1 and 1", len(repo.feeds), len(store.created))
+	}
+	feed := store.created[0]
+	if feed.Title != "Go" || !reflect.DeepEqual(feed.Tags, []string{"go"}) || feed.Status != models.FeedStatusPublished || feed.PublishedAt == nil {
+		t.Errorf("created feed = %+v, want a normalized published feed", feed)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+	"unicode"
+
+	"platzi.com/go/cqrs/models"
+	"platzi.com/go/cqrs/problem"
+	"platzi.com/go/cqrs/repository"
+)
+
+const (
+	idempotencyKeyHeader    = "Idempotency-Key"
+	idempotentReplayHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength = 255
+)
+
+// idempotent hace que los reintentos de una petición con la cabecera
+// Idempotency-Key reciban la respuesta original en vez de repetirla. Si la
+// clave se reutiliza con otro cuerpo responde 422, y 409 si la petición
+// original aún se está procesando. Las respuestas 5xx y las vacías no se
+// guardan, para que el cliente pueda reintentar.
+func idempotent(ttl time.Duration, maxBodyBytes int64, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength || !printable(key) {
+			p := problem.New(http.StatusBadRequest, "Invalid Idempotency-Key header")
+			p.Errors = []problem.FieldError{{Field: idempotencyKeyHeader, Message: "must be at most 255 printable characters"}}
+			p.Write(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				problem.Error(w, r, http.StatusRequestEntityTooLarge, "Request body is too large")
+				return
+			}
+			problem.Error(w, r, http.StatusBadRequest, "Failed to read request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		now := time.Now().UTC()
+		reservation := &models.IdempotencyKey{
+			Key:         key,
+			RequestHash: requestHash(r, body),
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(ttl),
+		}
+		existing, err := repository.ReserveIdempotencyKey(r.Context(), reservation)
+		if err != nil {
+			log.Printf("Failed to reserve idempotency key: %v", err)
+			problem.Error(w, r, http.StatusInternalServerError, "Failed to check Idempotency-Key")
+			return
+		}
+		if existing != nil {
+			replay(w, r, existing, reservation.RequestHash)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(recorder, r)
+		if !recorder.wroteHeader {
+			log.Printf("Handler for %s %s wrote no response", r.Method, r.URL.Path)
+			problem.Error(recorder, r, http.StatusInternalServerError, "No response was produced")
+		}
+
+		// La petición puede haberse cancelado: la clave se completa igualmente
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if recorder.status >= http.StatusInternalServerError || recorder.body.Len() == 0 {
+			if err := repository.DeleteIdempotencyKey(ctx, key); err != nil {
+				log.Printf("Failed to release idempotency key: %v", err)
+			}
+			return
+		}
+		contentType := recorder.Header().Get("Content-Type")
+		if err := repository.CompleteIdempotencyKey(ctx, key, recorder.status, contentType, recorder.body.Bytes()); err != nil {
+			log.Printf("Failed to store idempotent response: %v", err)
+		}
+	}
+}
+
+// replay responde a un reintento con la respuesta guardada
+func replay(w http.ResponseWriter, r *http.Request, existing *models.IdempotencyKey, hash string) {
+	if existing.RequestHash != hash {
+		problem.Error(w, r, http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request body")
+		return
+	}
+	if !existing.Completed() {
+		w.Header().Set("Retry-After", "1")
+		problem.Error(w, r, http.StatusConflict, "A request with this Idempotency-Key is still being processed")
+		return
+	}
+	if existing.ContentType != "" {
+		w.Header().Set("Content-Type", existing.ContentType)
+	}
+	w.Header().Set(idempotentReplayHeader, "true")
+	w.WriteHeader(existing.StatusCode)
+	w.Write(existing.ResponseBody)
+}
+
+// requestHash identifica la petición por método, ruta y cuerpo
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.Path+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func printable(s string) bool {
+	for _, c := range s {
+		if c > unicode.MaxASCII || !unicode.IsPrint(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// responseRecorder copia la respuesta del handler para guardarla
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(data []byte) (int, error) {
+	rec.wroteHeader = true
+	rec.body.Write(data)
+	return rec.ResponseWriter.Write(data)
+}
+
+// purgeIdempotencyKeys borra periódicamente las claves vencidas
+func purgeIdempotencyKeys(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := repository.PurgeExpiredIdempotencyKeys(ctx, time.Now().UTC())
+			if err != nil {
+				log.Printf("Failed to purge idempotency keys: %v", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("Purged %d expired idempotency keys", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"platzi.com/go/cqrs/models"
+)
+
+// ReserveIdempotencyKey reserva la clave si no existe o venció, como el
+// INSERT ... ON CONFLICT de Postgres, y si no devuelve la existente
+func (r *fakeRepository) ReserveIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) (*models.IdempotencyKey, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if existing, ok := r.idempotencyKeys[key.Key]; ok && existing.ExpiresAt.After(key.CreatedAt) {
+		copied := *existing
+		return &copied, nil
+	}
+	reserved := *key
+	r.idempotencyKeys[key.Key] = &reserved
+	return nil, nil
+}
+
+func (r *fakeRepository) CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, contentType string, body []byte) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if k, ok := r.idempotencyKeys[key]; ok {
+		k.StatusCode, k.ContentType, k.ResponseBody = statusCode, contentType, body
+	}
+	return nil
+}
+
+func (r *fakeRepository) DeleteIdempotencyKey(ctx context.Context, key string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.idempotencyKeys, key)
+	return nil
+}
+
+func idempotentRequest(key, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/feeds", strings.NewReader(body))
+	if key != "" {
+		r.Header.Set(idempotencyKeyHeader, key)
+	}
+	return r
+}
+
+// countingHandler responde con status y cuenta cuántas veces se ejecutó
+func countingHandler(status int, calls *int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"call":1}`))
+	}
+}
+
+func TestIdempotentReplay(t *testing.T) {
+	repo, store := setupFakes(t)
+	handler := idempotent(time.Hour, maxFeedBodyBytes, createFeedHandler)
+	body := `{"title":"Go"}`
+
+	first := httptest.NewRecorder()
+	handler(first, idempotentRequest("key-1", body))
+	if first.Code != http.StatusCreated {
+		t.Fatalf("first status = %d, want %d: %s", first.Code, http.StatusCreated, first.Body)
+	}
+	second := httptest.NewRecorder()
+	handler(second, idempotentRequest("key-1", body))
+	if second.Code != http.StatusCreated || second.Body.String() != first.Body.String() {
+		t.Errorf("replay = %d %s, want %d %s", second.Code, second.Body, first.Code, first.Body)
+	}
+	if second.Header().Get(idempotentReplayHeader) != "true" || second.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("replay headers = %v", second.Header())
+	}
+	if len(repo.feeds) != 1 || len(store.created) != 1 {
+		t.Errorf("stored %d feeds and published %d events, want 1 and 1", len(repo.feeds), len(store.created))
+	}
+}
+
+func TestIdempotentRejected(t *testing.T) {
+	body := `{"title":"Go"}`
+	tests := []struct {
+		name string
+		key  string
+		// reserved es la clave guardada antes de la petición, si la hay
+		reserved *models.IdempotencyKey
+		status   int
+	}{
+		{"different body", "key-1", &models.IdempotencyKey{RequestHash: "other", StatusCode: http.StatusCreated, ExpiresAt: time.Now().Add(time.Hour)}, http.StatusUnprocessableEntity},
+		{"still processing", "key-1", &models.IdempotencyKey{ExpiresAt: time.Now().Add(time.Hour)}, http.StatusConflict},
+		{"key too long", strings.Repeat("k", maxIdempotencyKeyLength+1), nil, http.StatusBadRequest},
+		{"key not printable", "key\x7f", nil, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, _ := setupFakes(t)
+			if tt.reserved != nil {
+				tt.reserved.Key = tt.key
+				if tt.reserved.RequestHash == "" {
+					tt.reserved.RequestHash = requestHash(idempotentRequest("", ""), []byte(body))
+				}
+				repo.idempotencyKeys[tt.key] = tt.reserved
+			}
+			calls := 0
+			rec := httptest.NewRecorder()
+			idempotent(time.Hour, maxFeedBodyBytes, countingHandler(http.StatusCreated, &calls))(rec, idempotentRequest(tt.key, body))
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if calls != 0 {
+				t.Errorf("handler ran %d times, want 0", calls)
+			}
+			if tt.status == http.StatusConflict && rec.Header().Get("Retry-After") == "" {
+				t.Error("409 without Retry-After")
+			}
+		})
+	}
+}
+
+func TestIdempotentReservation(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		expired  bool
+		released bool
+		calls    int
+	}{
+		{"client error is stored", http.StatusUnprocessableEntity, false, false, 1},
+		{"server error is released", http.StatusInternalServerError, false, true, 2},
+		{"expired key is reserved again", http.StatusCreated, true, false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, _ := setupFakes(t)
+			calls := 0
+			handler := idempotent(time.Hour, maxFeedBodyBytes, countingHandler(tt.status, &calls))
+
+			handler(httptest.NewRecorder(), idempotentRequest("key-1", "{}"))
+			k, reserved := repo.idempotencyKeys["key-1"]
+			if reserved == tt.released {
+				t.Fatalf("key reserved = %v after a %d response", reserved, tt.status)
+			}
+			if reserved && k.StatusCode != tt.status {
+				t.Errorf("stored status = %d, want %d", k.StatusCode, tt.status)
+			}
+			if tt.expired {
+				k.ExpiresAt = time.Now().Add(-time.Second)
+			}
+
+			rec := httptest.NewRecorder()
+			handler(rec, idempotentRequest("key-1", "{}"))
+			if rec.Code != tt.status {
+				t.Errorf("retry status = %d, want %d", rec.Code, tt.status)
+			}
+			if calls != tt.calls {
+				t.Errorf("handler ran %d times, want %d", calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestIdempotentWithoutKey(t *testing.T) {
+	repo, _ := setupFakes(t)
+	calls := 0
+	handler := idempotent(time.Hour, maxFeedBodyBytes, countingHandler(http.StatusCreated, &calls))
+	for i := 0; i < 2; i++ {
+		handler(httptest.NewRecorder(), idempotentRequest("", "{}"))
+	}
+	if calls != 2 || len(repo.idempotencyKeys) != 0 {
+		t.Errorf("handler ran %d times and reserved %d keys, want 2 and 0", calls, len(repo.idempotencyKeys))
+	}
+}
@@ -1,16 +1,18 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/kelseyhightower/envconfig"
 	"platzi.com/go/cqrs/database"
 	"platzi.com/go/cqrs/events"
+	"platzi.com/go/cqrs/problem"
 	"platzi.com/go/cqrs/repository"
-	
 )
 
 type Config struct {
@@ -18,11 +20,27 @@ type Config struct {
 	PostgresUser     string `envconfig:"POSTGRES_USER"`
 	PostgresPassword string `envconfig:"POSTGRES_PASSWORD"`
 	NatsAddress      string `envconfig:"NATS_ADDRESS"`
+	// IdempotencyTTL es cuánto se guarda la respuesta a un POST con Idempotency-Key
+	IdempotencyTTL time.Duration `envconfig:"IDEMPOTENCY_TTL" default:"24h"`
+	// SchedulerInterval es cada cuánto se buscan feeds programados vencidos
+	SchedulerInterval time.Duration `envconfig:"SCHEDULER_INTERVAL" default:"30s"`
+	// RelayInterval es cada cuánto se envían a NATS los eventos pendientes de la outbox
+	RelayInterval time.Duration `envconfig:"RELAY_INTERVAL" default:"5s"`
+	// TrashRetention es cuánto queda un feed en la papelera antes de borrarlo
+	TrashRetention time.Duration `envconfig:"TRASH_RETENTION" default:"720h"`
 }
 
-func newRouter() *mux.Router {
+func newRouter(cfg Config, scheduler *Scheduler, relay *Relay) *mux.Router {
 	router := mux.NewRouter()
-	router.HandleFunc("/feeds", createFeedHandler).Methods("POST")
+	router.NotFoundHandler = http.HandlerFunc(problem.NotFound)
+	router.MethodNotAllowedHandler = http.HandlerFunc(problem.MethodNotAllowed)
+	router.HandleFunc("/feeds", idempotent(cfg.IdempotencyTTL, maxFeedBodyBytes, createFeedHandler)).Methods("POST")
+	router.HandleFunc("/feeds/batch", idempotent(cfg.IdempotencyTTL, maxBatchBodyBytes, createFeedsBatchHandler)).Methods("POST")
+	router.HandleFunc("/feeds/{id}/publish", publishFeedHandler(scheduler)).Methods("POST")
+	router.HandleFunc("/feeds/{id}", updateFeedHandler(relay)).Methods("PATCH")
+	router.HandleFunc("/feeds/{id}", deleteFeedHandler(relay)).Methods("DELETE")
+	router.HandleFunc("/feeds/{id}/restore", restoreFeedHandler(relay)).Methods("POST")
+	router.HandleFunc("/feeds/{id}/revisions/{n:[0-9]+}/restore", restoreRevisionHandler(relay)).Methods("POST")
 	return router
 }
 
@@ -32,6 +50,18 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to process env vars: %s", err)
 	}
+	if cfg.IdempotencyTTL <= 0 {
+		log.Fatalf("IDEMPOTENCY_TTL must be positive")
+	}
+	if cfg.SchedulerInterval <= 0 {
+		log.Fatalf("SCHEDULER_INTERVAL must be positive")
+	}
+	if cfg.RelayInterval <= 0 {
+		log.Fatalf("RELAY_INTERVAL must be positive")
+	}
+	if cfg.TrashRetention <= 0 {
+		log.Fatalf("TRASH_RETENTION must be positive")
+	}
 
 	addr := fmt.Sprintf("postgres://%s:%s@postgres/%s?sslmode=disable", cfg.PostgresUser, cfg.PostgresPassword, cfg.PostgresDB)
 	repo, err := database.NewPostgresRepository(addr)
@@ -51,9 +81,18 @@ func main() {
 		}
 	}()
 
-	router := newRouter()
+	go purgeIdempotencyKeys(context.Background(), time.Hour)
+	go purgeTrashedFeeds(context.Background(), time.Hour, cfg.TrashRetention)
+
+	relay := NewRelay(cfg.RelayInterval)
+	go relay.Run(context.Background())
+
+	scheduler := NewScheduler(cfg.SchedulerInterval, relay)
+	go scheduler.Run(context.Background())
+
+	router := newRouter(cfg, scheduler, relay)
 	if err := http.ListenAndServe(":8080", router); err != nil {
 		log.Fatalf("Failed to start server: %s", err)
 	}
-	 
+
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"platzi.com/go/cqrs/events"
+	"platzi.com/go/cqrs/models"
+	"platzi.com/go/cqrs/repository"
+)
+
+// relayBatchSize es cuántos eventos de la outbox se envían por transacción
+const relayBatchSize = 100
+
+// Relay envía a NATS los eventos guardados en la tabla feed_events (outbox)
+// en la misma transacción que el cambio que anuncian. Un evento se borra solo
+// después de que NATS lo recibió, así que se entrega al menos una vez: si el
+// servicio cae entre el envío y el commit, se vuelve a enviar. Los
+// consumidores pueden descartar los duplicados por el ID del feed y la fecha
+// del evento (published_at en published_feed).
+type Relay struct {
+	interval time.Duration
+	wake     chan struct{}
+}
+
+func NewRelay(interval time.Duration) *Relay {
+	return &Relay{
+		interval: interval,
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Wake adelanta la siguiente pasada, por ejemplo tras guardar un evento
+func (r *Relay) Wake() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		r.relay(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+// relay envía lotes hasta vaciar la outbox. Si NATS falla los eventos quedan
+// en la tabla y se reintentan en la siguiente pasada.
+func (r *Relay) relay(ctx context.Context) {
+	for {
+		n, err := repository.RelayFeedEvents(ctx, relayBatchSize, func(feedEvents []*models.FeedEvent) error {
+			return events.PublishFeedEvents(ctx, feedEvents)
+		})
+		if err != nil {
+			log.Printf("Failed to relay feed events: %v", err)
+			return
+		}
+		if n < relayBatchSize {
+			return
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"platzi.com/go/cqrs/models"
+	"platzi.com/go/cqrs/problem"
+	"platzi.com/go/cqrs/repository"
+)
+
+// errInvalidUpdate cancela la transacción de UpdateFeed cuando el contenido
+// resultante no es válido; los errores de cada campo se devuelven aparte
+var errInvalidUpdate = errors.New("invalid feed update")
+
+// updateFeedRequest es un PATCH: solo se cambian los campos presentes.
+// Editor es el autor de la revisión, no del feed.
+type updateFeedRequest struct {
+	Title       *string   `json:"title"`
+	Description *string   `json:"description"`
+	Author      *string   `json:"author"`
+	URL         *string   `json:"url"`
+	Tags        *[]string `json:"tags"`
+	Body        *string   `json:"body"`
+	Language    *string   `json:"language"`
+	Editor      string    `json:"editor"`
+}
+
+// apply devuelve current con los campos de la petición aplicados
+func (req *updateFeedRequest) apply(current models.FeedContent) *feedContentFields {
+	fields := &feedContentFields{
+		Title:       current.Title,
+		Description: current.Description,
+		Author:      current.Author,
+		URL:         current.URL,
+		Tags:        current.Tags,
+		Body:        current.Body,
+		Language:    current.Language,
+	}
+	if req.Title != nil {
+		fields.Title = *req.Title
+	}
+	if req.Description != nil {
+		fields.Description = *req.Description
+	}
+	if req.Author != nil {
+		fields.Author = *req.Author
+	}
+	if req.URL != nil {
+		fields.URL = *req.URL
+	}
+	if req.Body != nil {
+		fields.Body = *req.Body
+	}
+	if req.Language != nil {
+		fields.Language = *req.Language
+	}
+	if req.Tags != nil {
+		fields.Tags = *req.Tags
+	}
+	return fields
+}
+
+// validateEditor recorta el autor de una revisión y agrega sus errores a v
+func validateEditor(v *problem.Validator, editor *string) {
+	*editor = strings.TrimSpace(*editor)
+	v.MaxLength("editor", *editor, maxAuthorLength)
+	v.SingleLine("editor", *editor)
+}
+
+// updateFeedHandler cambia los campos editables de un feed, guarda el cambio
+// como una revisión nueva y publica updated_feed
+func updateFeedHandler(relay *Relay) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req updateFeedRequest
+		if !problem.DecodeJSON(w, r, &req, maxFeedBodyBytes) {
+			return
+		}
+
+		var v problem.Validator
+		validateEditor(&v, &req.Editor)
+		if len(v.Errors) > 0 {
+			problem.Invalid(w, r, v.Errors)
+			return
+		}
+
+		// El contenido se valida ya combinado con el actual, dentro de la
+		// transacción que bloquea el feed
+		var fieldErrors []problem.FieldError
+		updateFeed(w, r, relay, req.Editor, func(feed *models.Feed) error {
+			var v problem.Validator
+			fields := req.apply(feed.Content())
+			fields.validate(&v)
+			if len(v.Errors) > 0 {
+				fieldErrors = v.Errors
+				return errInvalidUpdate
+			}
+			feed.SetContent(fields.content())
+			return nil
+		}, &fieldErrors)
+	}
+}
+
+type restoreRevisionRequest struct {
+	Editor string `json:"editor"`
+}
+
+// restoreRevisionHandler vuelve un feed al contenido de una revisión
+// anterior. La restauración es un cambio más: crea una revisión nueva y
+// publica updated_feed, así que la búsqueda y los clientes se actualizan
+// como con cualquier edición.
+func restoreRevisionHandler(relay *Relay) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req restoreRevisionRequest
+		if r.ContentLength != 0 && !problem.DecodeJSON(w, r, &req, maxFeedBodyBytes) {
+			return
+		}
+		var v problem.Validator
+		validateEditor(&v, &req.Editor)
+		if len(v.Errors) > 0 {
+			problem.Invalid(w, r, v.Errors)
+			return
+		}
+
+		id := mux.Vars(r)["id"]
+		number, err := strconv.Atoi(mux.Vars(r)["n"])
+		if err != nil {
+			problem.Error(w, r, http.StatusNotFound, "Revision not found")
+			return
+		}
+		revision, err := repository.GetFeedRevision(r.Context(), id, number)
+		if err != nil {
+			log.Printf("Failed to get revision %d of feed %s: %v", number, id, err)
+			problem.Error(w, r, http.StatusInternalServerError, "Failed to get revision")
+			return
+		}
+		if revision == nil {
+			problem.Error(w, r, http.StatusNotFound, "Revision not found")
+			return
+		}
+
+		updateFeed(w, r, relay, req.Editor, func(feed *models.Feed) error {
+			feed.SetContent(revision.Content)
+			return nil
+		}, nil)
+	}
+}
+
+// updateFeed aplica update al feed de la ruta y responde con el feed
+// resultante. Si update devuelve errInvalidUpdate responde 422 con
+// fieldErrors. El evento updated_feed se guarda en la outbox en la misma
+// transacción que la revisión y relay lo envía a NATS.
+func updateFeed(w http.ResponseWriter, r *http.Request, relay *Relay, editor string, update func(*models.Feed) error, fieldErrors *[]problem.FieldError) {
+	id := mux.Vars(r)["id"]
+	feed, revision, err := repository.UpdateFeed(r.Context(), id, editor, time.Now().UTC(), update)
+	if errors.Is(err, errInvalidUpdate) {
+		problem.Invalid(w, r, *fieldErrors)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to update feed %s: %v", id, err)
+		problem.Error(w, r, http.StatusInternalServerError, "Failed to update feed")
+		return
+	}
+	if feed == nil {
+		problem.Error(w, r, http.StatusNotFound, "Feed not found")
+		return
+	}
+	// Sin revisión no hubo cambios y no hay nada que publicar
+	if revision != nil {
+		relay.Wake()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(feed)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"platzi.com/go/cqrs/repository"
+)
+
+// publishBatchSize es cuántos feeds programados se publican por transacción
+const publishBatchSize = 100
+
+// Scheduler publica los feeds programados cuyo publish_at ya llegó. Varias
+// réplicas pueden ejecutarlo a la vez: PublishDueFeeds bloquea las filas con
+// SKIP LOCKED, así que cada feed lo publica una sola réplica, y guarda el
+// evento published_feed en la outbox en la misma transacción. El Relay lo
+// envía después a NATS al menos una vez.
+type Scheduler struct {
+	interval time.Duration
+	wake     chan struct{}
+	relay    *Relay
+}
+
+func NewScheduler(interval time.Duration, relay *Relay) *Scheduler {
+	return &Scheduler{
+		interval: interval,
+		wake:     make(chan struct{}, 1),
+		relay:    relay,
+	}
+}
+
+// Wake adelanta la siguiente pasada, por ejemplo al publicar un borrador
+func (s *Scheduler) Wake() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		s.publishDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// publishDue publica lotes hasta que no queden feeds vencidos
+func (s *Scheduler) publishDue(ctx context.Context) {
+	for {
+		n, err := repository.PublishDueFeeds(ctx, time.Now().UTC(), publishBatchSize)
+		if err != nil {
+			log.Printf("Failed to publish scheduled feeds: %v", err)
+			return
+		}
+		if n > 0 {
+			log.Printf("Published %d scheduled feeds", n)
+			s.relay.Wake()
+		}
+		if n < publishBatchSize {
+			return
+		}
+	}
+}
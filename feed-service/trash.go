@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"platzi.com/go/cqrs/problem"
+	"platzi.com/go/cqrs/repository"
+)
+
+// deleteFeedHandler mueve un feed a la papelera y publica deleted_feed. Borrar
+// un feed que ya está en la papelera no hace nada y también responde 204. El
+// evento se guarda en la outbox en la misma transacción y relay lo envía.
+func deleteFeedHandler(relay *Relay) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		feed, err := repository.TrashFeed(r.Context(), id, time.Now().UTC())
+		if err != nil {
+			log.Printf("Failed to delete feed %s: %v", id, err)
+			problem.Error(w, r, http.StatusInternalServerError, "Failed to delete feed")
+			return
+		}
+		if feed == nil {
+			if !feedExists(w, r, id) {
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		relay.Wake()
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// restoreFeedHandler saca un feed de la papelera y publica restored_feed a
+// través de la outbox, como deleteFeedHandler
+func restoreFeedHandler(relay *Relay) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		feed, err := repository.RestoreFeed(r.Context(), id)
+		if err != nil {
+			log.Printf("Failed to restore feed %s: %v", id, err)
+			problem.Error(w, r, http.StatusInternalServerError, "Failed to restore feed")
+			return
+		}
+		if feed == nil {
+			if feedExists(w, r, id) {
+				problem.Error(w, r, http.StatusConflict, "Feed is not in the trash")
+			}
+			return
+		}
+		relay.Wake()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(feed)
+	}
+}
+
+// feedExists responde 404 y devuelve false si el feed no existe
+func feedExists(w http.ResponseWriter, r *http.Request, id string) bool {
+	feed, err := repository.GetFeed(r.Context(), id)
+	if err != nil {
+		log.Printf("Failed to get feed %s: %v", id, err)
+		problem.Error(w, r, http.StatusInternalServerError, "Failed to get feed")
+		return false
+	}
+	if feed == nil {
+		problem.Error(w, r, http.StatusNotFound, "Feed not found")
+		return false
+	}
+	return true
+}
+
+// purgeTrashedFeeds borra definitivamente, cada interval, los feeds que
+// llevan en la papelera más de retention
+func purgeTrashedFeeds(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := repository.PurgeTrashedFeeds(ctx, time.Now().UTC().Add(-retention))
+			if err != nil {
+				log.Printf("Failed to purge trashed feeds: %v", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("Purged %d feeds from the trash", n)
+			}
+		}
+	}
+}
@@ -2,9 +2,39 @@ package models
 
 import "time"
 
+// Estados de publicación de un feed
+const (
+	FeedStatusDraft     = "draft"
+	FeedStatusScheduled = "scheduled"
+	FeedStatusPublished = "published"
+	FeedStatusArchived  = "archived"
+)
+
 type Feed struct {
-	ID          string    `db:"id"`
-	Title       string    `db:"title"`
-	Description string    `db:"description"`
-	CreatedAt   time.Time `db:"created_at"`
-}
\ No newline at end of file
+	ID          string     `db:"id"`
+	Title       string     `db:"title"`
+	Description string     `db:"description"`
+	Author      string     `db:"author"`
+	URL         string     `db:"url"`
+	Tags        []string   `db:"tags"`
+	Body        string     `db:"body"`
+	Language    string     `db:"language"`
+	Status      string     `db:"status"`
+	PublishAt   *time.Time `db:"publish_at"`
+	PublishedAt *time.Time `db:"published_at"`
+	// SourceKey identifica la entrada de la que se importó el feed (por
+	// ejemplo el GUID de un RSS); vacía si no se importó
+	SourceKey string    `db:"source_key"`
+	CreatedAt time.Time `db:"created_at"`
+	// DeletedAt es cuándo se movió el feed a la papelera; nil si no está en ella
+	DeletedAt *time.Time `db:"deleted_at"`
+}
+
+// PublicationTime es cuándo se publicó el feed, o cuándo se creó si no tiene
+// PublishedAt
+func (f *Feed) PublicationTime() time.Time {
+	if f.PublishedAt != nil {
+		return *f.PublishedAt
+	}
+	return f.CreatedAt
+}
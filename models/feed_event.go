@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Tipos de los eventos de feeds que se guardan en la tabla feed_events
+const (
+	FeedEventPublished = "published_feed"
+	FeedEventUpdated   = "updated_feed"
+	FeedEventDeleted   = "deleted_feed"
+	FeedEventRestored  = "restored_feed"
+)
+
+// FeedEvent es un evento guardado en la tabla feed_events (outbox) en la
+// misma transacción que el cambio que anuncia, hasta que se envía a NATS
+type FeedEvent struct {
+	ID        int64         `db:"id"`
+	Type      string        `db:"type"`
+	Feed      *Feed         `db:"feed"`
+	Revision  *FeedRevision `db:"revision"`
+	CreatedAt time.Time     `db:"created_at"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// FeedFilter selects the feeds listed, exported or searched by query-service.
+// Zero values mean no bound; a feed must have every tag in Tags.
+type FeedFilter struct {
+	Since  time.Time
+	Until  time.Time
+	Tags   []string
+	Status string
+}
+
+// Matches reports whether feed passes the filter
+func (f FeedFilter) Matches(feed *Feed) bool {
+	if f.Status != "" && feed.Status != f.Status {
+		return false
+	}
+	if !f.Since.IsZero() && feed.CreatedAt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !feed.CreatedAt.Before(f.Until) {
+		return false
+	}
+	for _, tag := range f.Tags {
+		found := false
+		for _, t := range feed.Tags {
+			if t == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
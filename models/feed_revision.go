@@ -0,0 +1,111 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// FeedContent son los campos editables de un feed, los que guarda cada revisión
+type FeedContent struct {
+	Title       string
+	Description string
+	Author      string
+	URL         string
+	Tags        []string
+	Body        string
+	Language    string
+}
+
+// FeedContentFields son los nombres de los campos de FeedContent en la API,
+// en el orden en que se listan los cambios
+var FeedContentFields = []string{"title", "description", "author", "url", "tags", "body", "language"}
+
+// Content devuelve los campos editables de f
+func (f *Feed) Content() FeedContent {
+	return FeedContent{
+		Title:       f.Title,
+		Description: f.Description,
+		Author:      f.Author,
+		URL:         f.URL,
+		Tags:        f.Tags,
+		Body:        f.Body,
+		Language:    f.Language,
+	}
+}
+
+// SetContent reemplaza los campos editables de f por los de c
+func (f *Feed) SetContent(c FeedContent) {
+	f.Title = c.Title
+	f.Description = c.Description
+	f.Author = c.Author
+	f.URL = c.URL
+	f.Tags = c.Tags
+	f.Body = c.Body
+	f.Language = c.Language
+}
+
+// Field devuelve el valor del campo con el nombre que tiene en la API
+func (c FeedContent) Field(name string) interface{} {
+	switch name {
+	case "title":
+		return c.Title
+	case "description":
+		return c.Description
+	case "author":
+		return c.Author
+	case "url":
+		return c.URL
+	case "tags":
+		if c.Tags == nil {
+			return []string{}
+		}
+		return c.Tags
+	case "body":
+		return c.Body
+	case "language":
+		return c.Language
+	}
+	return nil
+}
+
+// ChangedFields lista los campos de c que difieren de previous
+func (c FeedContent) ChangedFields(previous FeedContent) []string {
+	changed := []string{}
+	for _, name := range FeedContentFields {
+		if name == "tags" {
+			if !slices.Equal(c.Tags, previous.Tags) {
+				changed = append(changed, name)
+			}
+			continue
+		}
+		if c.Field(name) != previous.Field(name) {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+// FeedRevision es una versión del contenido de un feed. La revisión 1 es el
+// contenido con el que se creó y cada cambio posterior agrega la siguiente.
+type FeedRevision struct {
+	FeedID        string      `db:"feed_id"`
+	Number        int         `db:"number"`
+	Author        string      `db:"author"`
+	ChangedFields []string    `db:"changed_fields"`
+	Content       FeedContent `db:"content"`
+	CreatedAt     time.Time   `db:"created_at"`
+}
+
+// NewFeedRevision crea la revisión número number de feed con su contenido
+// actual, anotando los campos que cambiaron respecto a previous
+func NewFeedRevision(feed *Feed, number int, author string, previous FeedContent, createdAt time.Time) *FeedRevision {
+	content := feed.Content()
+	return &FeedRevision{
+		FeedID:        feed.ID,
+		Number:        number,
+		Author:        author,
+		ChangedFields: content.ChangedFields(previous),
+		Content:       content,
+		CreatedAt:     createdAt,
+	}
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// IdempotencyKey guarda la respuesta a una petición con cabecera
+// Idempotency-Key. StatusCode es 0 mientras la petición original se procesa.
+type IdempotencyKey struct {
+	Key          string    `db:"key"`
+	RequestHash  string    `db:"request_hash"`
+	StatusCode   int       `db:"status_code"`
+	ContentType  string    `db:"content_type"`
+	ResponseBody []byte    `db:"response_body"`
+	CreatedAt    time.Time `db:"created_at"`
+	ExpiresAt    time.Time `db:"expires_at"`
+}
+
+// Completed indica si ya se guardó la respuesta
+func (k *IdempotencyKey) Completed() bool {
+	return k.StatusCode != 0
+}
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+type SavedSearch struct {
+	ID        string    `db:"id"`
+	OwnerID   string    `db:"owner_id"`
+	Query     string    `db:"query"`
+	CreatedAt time.Time `db:"created_at"`
+}
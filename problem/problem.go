@@ -0,0 +1,129 @@
+// Package problem escribe los errores HTTP de los servicios como
+// application/problem+json (RFC 7807) y valida los cuerpos de las peticiones.
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const ContentType = "application/problem+json"
+
+// MaxBodyBytes es el tamaño máximo por defecto del cuerpo de una petición
+const MaxBodyBytes = 1 << 20
+
+// Problem es el cuerpo de una respuesta de error según RFC 7807. Errors lista
+// los campos que no pasaron la validación.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError es el error de validación de un campo
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// New crea un Problem con el título estándar del código de estado
+func New(status int, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// Write responde con el Problem
+func (p *Problem) Write(w http.ResponseWriter, r *http.Request) {
+	if p.Instance == "" && r != nil {
+		p.Instance = r.URL.Path
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// Error responde con un Problem sin errores de campo; reemplaza a http.Error
+func Error(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	New(status, detail).Write(w, r)
+}
+
+// Invalid responde 422 con los errores de validación
+func Invalid(w http.ResponseWriter, r *http.Request, errs []FieldError) {
+	p := New(http.StatusUnprocessableEntity, "The request has invalid fields")
+	p.Errors = errs
+	p.Write(w, r)
+}
+
+// DecodeJSON decodifica el cuerpo en dst rechazando campos desconocidos,
+// datos después del objeto y cuerpos de más de maxBytes. Si falla responde
+// con el Problem correspondiente y devuelve false.
+func DecodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}, maxBytes int64) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBytes))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(dst)
+	if err == nil {
+		if _, extra := decoder.Token(); extra != io.EOF {
+			err = errors.New("request body must contain a single JSON object")
+		}
+	}
+	if err == nil {
+		return true
+	}
+	FromDecodeError(err).Write(w, r)
+	return false
+}
+
+// FromDecodeError convierte un error de encoding/json en un Problem con los
+// campos afectados
+func FromDecodeError(err error) *Problem {
+	var (
+		maxBytesErr  *http.MaxBytesError
+		syntaxErr    *json.SyntaxError
+		typeErr      *json.UnmarshalTypeError
+		invalidField string
+	)
+	if msg := err.Error(); strings.HasPrefix(msg, "json: unknown field ") {
+		invalidField = strings.Trim(strings.TrimPrefix(msg, "json: unknown field "), `"`)
+	}
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return New(http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body must not be larger than %d bytes", maxBytesErr.Limit))
+	case errors.As(err, &syntaxErr):
+		return New(http.StatusBadRequest, fmt.Sprintf("Malformed JSON at offset %d", syntaxErr.Offset))
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return New(http.StatusBadRequest, "Malformed JSON")
+	case errors.Is(err, io.EOF):
+		return New(http.StatusBadRequest, "Request body must not be empty")
+	case errors.As(err, &typeErr):
+		p := New(http.StatusBadRequest, "The request has fields of the wrong type")
+		p.Errors = []FieldError{{Field: typeErr.Field, Message: "must be a " + typeErr.Type.String()}}
+		return p
+	case invalidField != "":
+		p := New(http.StatusBadRequest, "The request has unknown fields")
+		p.Errors = []FieldError{{Field: invalidField, Message: "unknown field"}}
+		return p
+	default:
+		return New(http.StatusBadRequest, err.Error())
+	}
+}
+
+// NotFound y MethodNotAllowed reemplazan las respuestas en texto plano del router
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	Error(w, r, http.StatusNotFound, "No route matches "+r.URL.Path)
+}
+
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	Error(w, r, http.StatusMethodNotAllowed, "Method "+r.Method+" is not allowed on "+r.URL.Path)
+}
@@ -0,0 +1,70 @@
+package problem
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Validator acumula los errores de validación de una petición. Las reglas
+// esperan los valores ya recortados con strings.TrimSpace.
+type Validator struct {
+	Errors []FieldError
+}
+
+func (v *Validator) add(field, message string) {
+	// Solo se informa el primer error de cada campo
+	for _, e := range v.Errors {
+		if e.Field == field {
+			return
+		}
+	}
+	v.Errors = append(v.Errors, FieldError{Field: field, Message: message})
+}
+
+// Check registra message para field si ok es false
+func (v *Validator) Check(ok bool, field, message string) {
+	if !ok {
+		v.add(field, message)
+	}
+}
+
+// Required exige que value no esté vacío
+func (v *Validator) Required(field, value string) {
+	v.Check(value != "", field, "is required")
+}
+
+// MaxLength limita value a max caracteres, como VARCHAR(max) en Postgres
+func (v *Validator) MaxLength(field, value string, max int) {
+	v.Check(utf8.RuneCountInString(value) <= max, field, fmt.Sprintf("must be at most %d characters", max))
+}
+
+// SingleLine rechaza cualquier carácter de control, incluidos los saltos de línea
+func (v *Validator) SingleLine(field, value string) {
+	v.Check(!containsControl(value, false), field, "must not contain control characters")
+}
+
+// Text rechaza los caracteres de control salvo saltos de línea y tabuladores
+func (v *Validator) Text(field, value string) {
+	v.Check(!containsControl(value, true), field, "must not contain control characters")
+}
+
+// Valid indica si no hubo errores
+func (v *Validator) Valid() bool {
+	return len(v.Errors) == 0
+}
+
+func containsControl(value string, allowWhitespace bool) bool {
+	if !utf8.ValidString(value) {
+		return true
+	}
+	for _, r := range value {
+		if allowWhitespace && (r == '\n' || r == '\r' || r == '\t') {
+			continue
+		}
+		if unicode.IsControl(r) {
+			return true
+		}
+	}
+	return false
+}
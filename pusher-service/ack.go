@@ -0,0 +1,113 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// maxPendingAcks limita los mensajes sin confirmar que se guardan por cliente
+const maxPendingAcks = 1000
+
+// pendingAck es un mensaje entregado en modo ack que el cliente aún no confirmó
+type pendingAck struct {
+	data     []byte
+	attempts int
+	deadline time.Time
+}
+
+// deliver encola un mensaje numerado. En modo ack lo guarda hasta que el
+// cliente lo confirme, para reenviarlo si vence el plazo.
+func (c *Client) deliver(seq uint64, data []byte) bool {
+	if !c.ackMode || seq == 0 {
+		return c.enqueue(data)
+	}
+	c.mutex.Lock()
+	if len(c.pending) >= maxPendingAcks {
+		c.evictOldestPending()
+	}
+	c.pending[seq] = &pendingAck{
+		data:     data,
+		attempts: 1,
+		deadline: time.Now().Add(c.hub.clientOptions.AckTimeout),
+	}
+	c.mutex.Unlock()
+	return c.enqueue(data)
+}
+
+// evictOldestPending descarta el mensaje pendiente más antiguo. Debe
+// llamarse con el mutex tomado.
+func (c *Client) evictOldestPending() {
+	var oldest uint64
+	for seq := range c.pending {
+		if oldest == 0 || seq < oldest {
+			oldest = seq
+		}
+	}
+	delete(c.pending, oldest)
+	atomic.AddUint64(&c.failed, 1)
+}
+
+// ack confirma los mensajes recibidos por el cliente
+func (c *Client) ack(seqs []uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, seq := range seqs {
+		if _, ok := c.pending[seq]; ok {
+			delete(c.pending, seq)
+			atomic.AddUint64(&c.acked, 1)
+		}
+	}
+}
+
+// redeliver reenvía los mensajes cuyo plazo venció, hasta AckMaxAttempts
+// intentos, mientras el cliente siga conectado
+func (c *Client) redeliver() {
+	interval := c.hub.clientOptions.AckTimeout / 2
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closed:
+			return
+		case now := <-ticker.C:
+			for _, data := range c.duePending(now) {
+				atomic.AddUint64(&c.redelivered, 1)
+				c.enqueue(data)
+			}
+		}
+	}
+}
+
+// duePending devuelve, en orden, los mensajes a reenviar y descarta los que
+// agotaron sus intentos
+func (c *Client) duePending(now time.Time) [][]byte {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var seqs []uint64
+	for seq, p := range c.pending {
+		if now.Before(p.deadline) {
+			continue
+		}
+		if p.attempts >= c.hub.clientOptions.AckMaxAttempts {
+			log.Printf("Message %d to client %s was never acknowledged", seq, c.id)
+			delete(c.pending, seq)
+			atomic.AddUint64(&c.failed, 1)
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	due := make([][]byte, 0, len(seqs))
+	for _, seq := range seqs {
+		p := c.pending[seq]
+		p.attempts++
+		p.deadline = now.Add(c.hub.clientOptions.AckTimeout)
+		due = append(due, p.data)
+	}
+	return due
+}
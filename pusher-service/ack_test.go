@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDuePending(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		pending map[uint64]*pendingAck
+		want    []string
+		kept    int
+		failed  uint64
+	}{
+		{"none due", map[uint64]*pendingAck{
+			1: {data: []byte("1"), attempts: 1, deadline: now.Add(time.Second)},
+		}, nil, 1, 0},
+		{"due in order", map[uint64]*pendingAck{
+			3: {data: []byte("3"), attempts: 1, deadline: now},
+			1: {data: []byte("1"), attempts: 2, deadline: now.Add(-time.Second)},
+			2: {data: []byte("2"), attempts: 1, deadline: now.Add(time.Second)},
+		}, []string{"1", "3"}, 3, 0},
+		{"attempts exhausted", map[uint64]*pendingAck{
+			1: {data: []byte("1"), attempts: 3, deadline: now.Add(-time.Second)},
+			2: {data: []byte("2"), attempts: 2, deadline: now.Add(-time.Second)},
+		}, []string{"2"}, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newQueueClient(PolicyDropOldest, 4)
+			c.hub.clientOptions.AckTimeout = time.Minute
+			c.hub.clientOptions.AckMaxAttempts = 3
+			c.pending = tt.pending
+			due := c.duePending(now)
+			if len(due) != len(tt.want) {
+				t.Fatalf("duePending returned %d messages, want %v", len(due), tt.want)
+			}
+			for i, data := range due {
+				if string(data) != tt.want[i] {
+					t.Errorf("message %d = %q, want %q", i, data, tt.want[i])
+				}
+			}
+			if len(c.pending) != tt.kept {
+				t.Errorf("kept %d pending messages, want %d", len(c.pending), tt.kept)
+			}
+			if c.failed != tt.failed {
+				t.Errorf("failed = %d, want %d", c.failed, tt.failed)
+			}
+		})
+	}
+}
+
+func TestDuePendingPostponesDeadline(t *testing.T) {
+	now := time.Now()
+	c := newQueueClient(PolicyDropOldest, 4)
+	c.hub.clientOptions.AckTimeout = time.Minute
+	c.hub.clientOptions.AckMaxAttempts = 3
+	c.pending[1] = &pendingAck{data: []byte("1"), attempts: 1, deadline: now}
+
+	if due := c.duePending(now); len(due) != 1 {
+		t.Fatalf("duePending returned %d messages, want 1", len(due))
+	}
+	if p := c.pending[1]; p.attempts != 2 || !p.deadline.Equal(now.Add(time.Minute)) {
+		t.Errorf("pending = %+v, want attempt 2 due in a minute", p)
+	}
+	if due := c.duePending(now.Add(time.Second)); len(due) != 0 {
+		t.Errorf("duePending returned %d messages before the new deadline", len(due))
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"platzi.com/go/cqrs/auth"
+)
+
+// Códigos de cierre del WebSocket cuando falla la autenticación
+const (
+	CloseInvalidToken = 4001
+	CloseTokenExpired = 4002
+	CloseAuthRequired = 4003
+)
+
+// Authenticator valida los tokens JWT y el origen de las conexiones
+type Authenticator struct {
+	key            []byte
+	allowedOrigins []string
+	// timeout es el tiempo que se espera el mensaje auth cuando el token no
+	// viene en la petición
+	timeout time.Duration
+}
+
+func NewAuthenticator(key []byte, allowedOrigins []string, timeout time.Duration) *Authenticator {
+	return &Authenticator{
+		key:            key,
+		allowedOrigins: allowedOrigins,
+		timeout:        timeout,
+	}
+}
+
+// CheckOrigin acepta peticiones sin Origin (clientes que no son navegadores),
+// del mismo host, o de un origen de la lista. "*" acepta cualquier origen.
+func (a *Authenticator) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range a.allowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// tokenFromRequest busca el token en la cabecera Authorization o en el
+// parámetro access_token
+func tokenFromRequest(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))
+	}
+	return r.URL.Query().Get("access_token")
+}
+
+func (a *Authenticator) Verify(token string) (*auth.Claims, error) {
+	return auth.Verify(token, a.key, time.Now())
+}
+
+// closeCode traduce un error de verificación al código de cierre del WebSocket
+func closeCode(err error) int {
+	if errors.Is(err, auth.ErrTokenExpired) {
+		return CloseTokenExpired
+	}
+	return CloseInvalidToken
+}
+
+// authenticateSocket obtiene el token de la petición o, si no viene, del
+// primer mensaje ({"type": "auth", "token": "..."}). Si falla cierra el socket
+// con el código correspondiente y devuelve nil.
+func (a *Authenticator) authenticateSocket(socket *websocket.Conn, r *http.Request) *auth.Claims {
+	token := tokenFromRequest(r)
+	if token == "" {
+		socket.SetReadDeadline(time.Now().Add(a.timeout))
+		_, message, err := socket.ReadMessage()
+		socket.SetReadDeadline(time.Time{})
+		if err != nil {
+			closeSocket(socket, CloseAuthRequired, "authentication required")
+			return nil
+		}
+		cmd, err := parseCommand(message)
+		if err != nil || cmd.Type != commandAuth || cmd.Token == "" {
+			closeSocket(socket, CloseAuthRequired, "authentication required")
+			return nil
+		}
+		token = cmd.Token
+	}
+
+	claims, err := a.Verify(token)
+	if err != nil {
+		closeSocket(socket, closeCode(err), err.Error())
+		return nil
+	}
+	return claims
+}
+
+// closeSocket envía el frame de cierre con el código y cierra la conexión
+func closeSocket(socket *websocket.Conn, code int, reason string) {
+	socket.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	socket.Close()
+}
+
+// writeAuthError responde 401 a las peticiones SSE sin un token válido
+func writeAuthError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// RequireAdminToken solo deja pasar las peticiones con el token de
+// administración en la cabecera Authorization: Bearer
+func RequireAdminToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := r.Header.Get("Authorization")
+		if !strings.HasPrefix(h, "Bearer ") || subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(h, "Bearer ")), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
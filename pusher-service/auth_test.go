@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"platzi.com/go/cqrs/auth"
+)
+
+var testSecret = []byte("test-secret")
+
+// startTestHub sirve /ws y /events con un Hub nuevo en un servidor de prueba
+func startTestHub(t *testing.T, allowedOrigins ...string) (*Hub, *httptest.Server) {
+	t.Helper()
+	hub := NewHub(NewReplayBuffer(NewStreamID("test"), 100, time.Minute), ClientOptions{
+		QueueSize:      16,
+		Policy:         PolicyDropOldest,
+		WriteTimeout:   time.Second,
+		AckTimeout:     100 * time.Millisecond,
+		AckMaxAttempts: 3,
+		Limits: InputLimits{
+			MaxMessageSize: 1024,
+			Rate:           100,
+			Burst:          100,
+			MaxViolations:  5,
+		},
+	}, NewAuthenticator(testSecret, allowedOrigins, 200*time.Millisecond))
+	go hub.Run()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", hub.HandleWebSocket)
+	mux.HandleFunc("/events", hub.HandleEvents)
+	server := httptest.NewServer(mux)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		hub.Shutdown(ctx, 0)
+		server.Close()
+	})
+	return hub, server
+}
+
+func wsURL(server *httptest.Server, query string) string {
+	u := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	if query != "" {
+		u += "?" + query
+	}
+	return u
+}
+
+func testToken(t *testing.T, claims auth.Claims) string {
+	t.Helper()
+	token, err := auth.Sign(claims, testSecret)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	return token
+}
+
+func bearer(token string) http.Header {
+	return http.Header{"Authorization": []string{"Bearer " + token}}
+}
+
+// expectClose lee del socket hasta recibir el cierre y comprueba su código
+func expectClose(t *testing.T, socket *websocket.Conn, code int) {
+	t.Helper()
+	socket.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, message, err := socket.ReadMessage()
+		if err == nil {
+			t.Logf("ignoring message before close: %s", message)
+			continue
+		}
+		var closeErr *websocket.CloseError
+		if !errors.As(err, &closeErr) {
+			t.Fatalf("read error = %v, want close %d", err, code)
+		}
+		if closeErr.Code != code {
+			t.Fatalf("close code = %d (%s), want %d", closeErr.Code, closeErr.Text, code)
+		}
+		return
+	}
+}
+
+// expectWelcome comprueba que el primer mensaje es el welcome del usuario
+func expectWelcome(t *testing.T, socket *websocket.Conn, userID string) {
+	t.Helper()
+	socket.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var welcome struct {
+		Type   string `json:"type"`
+		UserID string `json:"user_id"`
+	}
+	if err := socket.ReadJSON(&welcome); err != nil {
+		t.Fatalf("reading welcome: %v", err)
+	}
+	if welcome.Type != "welcome" || welcome.UserID != userID {
+		t.Fatalf("first message = %+v, want welcome for %s", welcome, userID)
+	}
+}
+
+func dial(t *testing.T, url string, header http.Header) *websocket.Conn {
+	t.Helper()
+	socket, _, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { socket.Close() })
+	return socket
+}
+
+func TestHandshakeAccepted(t *testing.T) {
+	_, server := startTestHub(t)
+	token := testToken(t, auth.Claims{Subject: "user-1", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+
+	t.Run("Header", func(t *testing.T) {
+		expectWelcome(t, dial(t, wsURL(server, ""), bearer(token)), "user-1")
+	})
+	t.Run("Query", func(t *testing.T) {
+		expectWelcome(t, dial(t, wsURL(server, "access_token="+token), nil), "user-1")
+	})
+	t.Run("AuthMessage", func(t *testing.T) {
+		socket := dial(t, wsURL(server, ""), nil)
+		if err := socket.WriteJSON(map[string]string{"type": "auth", "token": token}); err != nil {
+			t.Fatalf("WriteJSON: %v", err)
+		}
+		expectWelcome(t, socket, "user-1")
+	})
+}
+
+func TestHandshakeRejected(t *testing.T) {
+	_, server := startTestHub(t)
+	now := time.Now()
+	otherKey, err := auth.Sign(auth.Claims{Subject: "user-1"}, []byte("other-secret"))
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		header http.Header
+		// first se envía como primer mensaje si no es vacío
+		first string
+		code  int
+	}{
+		{"InvalidSignature", bearer(otherKey), "", CloseInvalidToken},
+		{"Malformed", bearer("not-a-token"), "", CloseInvalidToken},
+		{"NotYetValid", bearer(testToken(t, auth.Claims{Subject: "user-1", NotBefore: now.Add(time.Hour).Unix()})), "", CloseInvalidToken},
+		{"Expired", bearer(testToken(t, auth.Claims{Subject: "user-1", ExpiresAt: now.Add(-time.Minute).Unix()})), "", CloseTokenExpired},
+		{"ExpiredAuthMessage", nil, `{"type":"auth","token":"` + testToken(t, auth.Claims{Subject: "user-1", ExpiresAt: now.Add(-time.Minute).Unix()}) + `"}`, CloseTokenExpired},
+		{"NoToken", nil, "", CloseAuthRequired},
+		{"NotAuthMessage", nil, `{"type":"ping"}`, CloseAuthRequired},
+		{"EmptyAuthMessage", nil, `{"type":"auth"}`, CloseAuthRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			socket := dial(t, wsURL(server, ""), tt.header)
+			if tt.first != "" {
+				if err := socket.WriteMessage(websocket.TextMessage, []byte(tt.first)); err != nil {
+					t.Fatalf("WriteMessage: %v", err)
+				}
+			}
+			expectClose(t, socket, tt.code)
+		})
+	}
+}
+
+func TestHandshakeTokenExpiresWhileConnected(t *testing.T) {
+	_, server := startTestHub(t)
+	token := testToken(t, auth.Claims{Subject: "user-1", ExpiresAt: time.Now().Add(1100 * time.Millisecond).Unix()})
+	socket := dial(t, wsURL(server, ""), bearer(token))
+	expectWelcome(t, socket, "user-1")
+	expectClose(t, socket, CloseTokenExpired)
+}
+
+func TestHandshakeOrigin(t *testing.T) {
+	_, server := startTestHub(t, "https://app.example.com")
+	token := testToken(t, auth.Claims{Subject: "user-1"})
+
+	for _, origin := range []string{"https://app.example.com", server.URL, ""} {
+		header := bearer(token)
+		if origin != "" {
+			header.Set("Origin", origin)
+		}
+		socket, _, err := websocket.DefaultDialer.Dial(wsURL(server, ""), header)
+		if err != nil {
+			t.Errorf("Dial with Origin %q: %v", origin, err)
+			continue
+		}
+		expectWelcome(t, socket, "user-1")
+		socket.Close()
+	}
+
+	header := bearer(token)
+	header.Set("Origin", "https://evil.example.com")
+	socket, resp, err := websocket.DefaultDialer.Dial(wsURL(server, ""), header)
+	if err == nil {
+		socket.Close()
+		t.Fatal("Dial from a disallowed origin succeeded")
+	}
+	if resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("Dial from a disallowed origin = %v, %v, want 403", resp, err)
+	}
+}
+
+func TestEventsOrigin(t *testing.T) {
+	_, server := startTestHub(t, "https://app.example.com")
+	token := testToken(t, auth.Claims{Subject: "user-1"})
+
+	tests := []struct {
+		origin string
+		want   int
+	}{
+		{"https://app.example.com", http.StatusOK},
+		{"", http.StatusOK},
+		{"https://evil.example.com", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/events", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header = bearer(token)
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET /events with Origin %q: %v", tt.origin, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("GET /events with Origin %q = %d, want %d", tt.origin, resp.StatusCode, tt.want)
+		}
+	}
+}
+
+func TestEventsRequiresToken(t *testing.T) {
+	_, server := startTestHub(t)
+	resp, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatalf("GET /events: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GET /events without token = %d, want 401", resp.StatusCode)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// SlowConsumerPolicy decide qué hacer cuando la cola de un cliente está llena
+type SlowConsumerPolicy string
+
+const (
+	// PolicyDropOldest descarta el mensaje más antiguo de la cola
+	PolicyDropOldest SlowConsumerPolicy = "drop_oldest"
+	// PolicyDropNewest descarta el mensaje que se intenta encolar
+	PolicyDropNewest SlowConsumerPolicy = "drop_newest"
+	// PolicyDisconnect desconecta al cliente
+	PolicyDisconnect SlowConsumerPolicy = "disconnect"
+)
+
+func ParseSlowConsumerPolicy(s string) (SlowConsumerPolicy, error) {
+	switch p := SlowConsumerPolicy(s); p {
+	case PolicyDropOldest, PolicyDropNewest, PolicyDisconnect:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown slow consumer policy %q", s)
+	}
+}
+
+// ClientOptions configura la cola de envío y el socket de cada cliente
+type ClientOptions struct {
+	QueueSize    int
+	Policy       SlowConsumerPolicy
+	WriteTimeout time.Duration
+	// AckTimeout y AckMaxAttempts controlan los reenvíos en modo ack
+	AckTimeout     time.Duration
+	AckMaxAttempts int
+	// Limits acota los mensajes que envía el cliente
+	Limits InputLimits
+}
+
+// ClientStats es el estado de entrega de un cliente
+type ClientStats struct {
+	ID          string `json:"id"`
+	NodeID      string `json:"node_id,omitempty"`
+	UserID      string `json:"user_id,omitempty"`
+	RemoteAddr  string `json:"remote_addr"`
+	Transport   string `json:"transport"`
+	Queued      int    `json:"queued"`
+	QueueSize   int    `json:"queue_size"`
+	Delivered   uint64 `json:"delivered"`
+	Dropped     uint64 `json:"dropped"`
+	AckMode     bool   `json:"ack_mode"`
+	Pending     int    `json:"pending_acks"`
+	Acked       uint64 `json:"acked"`
+	Redelivered uint64 `json:"redelivered"`
+	Failed      uint64 `json:"failed"`
+}
+
+// enqueue encola el mensaje sin bloquear. Si la cola está llena aplica la
+// política del Hub y devuelve false si el mensaje no se encoló.
+func (c *Client) enqueue(data []byte) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+	select {
+	case c.outbound <- data:
+		return true
+	default:
+	}
+
+	switch c.hub.clientOptions.Policy {
+	case PolicyDropOldest:
+		select {
+		case <-c.outbound:
+			atomic.AddUint64(&c.dropped, 1)
+		default:
+		}
+		select {
+		case c.outbound <- data:
+			return true
+		default:
+			atomic.AddUint64(&c.dropped, 1)
+			return false
+		}
+	case PolicyDisconnect:
+		atomic.AddUint64(&c.dropped, 1)
+		log.Printf("Client %s is too slow, disconnecting", c.id)
+		c.disconnect()
+		return false
+	default:
+		atomic.AddUint64(&c.dropped, 1)
+		return false
+	}
+}
+
+// disconnect pide cerrar la conexión del cliente. Es seguro llamarlo varias veces.
+func (c *Client) disconnect() {
+	c.doneOnce.Do(func() { close(c.done) })
+}
+
+// free devuelve cuántos mensajes caben aún en la cola
+func (c *Client) free() int {
+	return cap(c.outbound) - len(c.outbound)
+}
+
+func (c *Client) stats() ClientStats {
+	transport := "websocket"
+	if c.socket == nil {
+		transport = "sse"
+	}
+	c.mutex.Lock()
+	pending := len(c.pending)
+	c.mutex.Unlock()
+	return ClientStats{
+		ID:          c.id,
+		UserID:      c.userID,
+		RemoteAddr:  c.remoteAddr,
+		Transport:   transport,
+		Queued:      len(c.outbound),
+		QueueSize:   cap(c.outbound),
+		Delivered:   atomic.LoadUint64(&c.delivered),
+		Dropped:     atomic.LoadUint64(&c.dropped),
+		AckMode:     c.ackMode,
+		Pending:     pending,
+		Acked:       atomic.LoadUint64(&c.acked),
+		Redelivered: atomic.LoadUint64(&c.redelivered),
+		Failed:      atomic.LoadUint64(&c.failed),
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newQueueClient crea un cliente sin conexión con una cola de size mensajes
+func newQueueClient(policy SlowConsumerPolicy, size int) *Client {
+	hub := NewHub(NewReplayBuffer("test", 1, time.Minute), ClientOptions{QueueSize: size, Policy: policy}, NewAuthenticator(testSecret, nil, time.Second))
+	return NewClient(hub, nil, "client-1")
+}
+
+func TestEnqueuePolicies(t *testing.T) {
+	tests := []struct {
+		policy       SlowConsumerPolicy
+		enqueued     bool
+		queued       []string
+		dropped      uint64
+		disconnected bool
+	}{
+		{PolicyDropOldest, true, []string{"2", "3"}, 1, false},
+		{PolicyDropNewest, false, []string{"1", "2"}, 1, false},
+		{PolicyDisconnect, false, []string{"1", "2"}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			c := newQueueClient(tt.policy, 2)
+			for _, m := range []string{"1", "2"} {
+				if !c.enqueue([]byte(m)) {
+					t.Fatalf("enqueue(%s) = false with room in the queue", m)
+				}
+			}
+			if got := c.enqueue([]byte("3")); got != tt.enqueued {
+				t.Errorf("enqueue on a full queue = %v, want %v", got, tt.enqueued)
+			}
+			if got := atomic.LoadUint64(&c.dropped); got != tt.dropped {
+				t.Errorf("dropped = %d, want %d", got, tt.dropped)
+			}
+			select {
+			case <-c.done:
+				if !tt.disconnected {
+					t.Error("client was disconnected")
+				}
+			default:
+				if tt.disconnected {
+					t.Error("client was not disconnected")
+				}
+			}
+			for _, want := range tt.queued {
+				if got := string(<-c.outbound); got != want {
+					t.Errorf("queued %q, want %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEnqueueAfterDisconnect(t *testing.T) {
+	c := newQueueClient(PolicyDropOldest, 2)
+	c.disconnect()
+	if c.enqueue([]byte("1")) {
+		t.Error("enqueue = true after disconnect")
+	}
+	if len(c.outbound) != 0 {
+		t.Errorf("queued %d messages after disconnect", len(c.outbound))
+	}
+}
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -12,18 +16,132 @@ type Client struct {
 	hub *Hub
 	// id es el identificador único del cliente
 	id string
-	// socket es la conexión WebSocket del cliente
+	// userID es el sujeto (sub) del token con el que se autenticó la conexión
+	userID string
+	// expiry cierra la conexión cuando vence el token
+	expiry *time.Timer
+	// socket es la conexión WebSocket del cliente (nil para clientes SSE)
 	socket *websocket.Conn
-	// outbound es el canal por el que se envían los mensajes al cliente
+	// remoteAddr es la dirección del cliente, para los logs
+	remoteAddr string
+	// closed se cierra cuando el Hub da de baja al cliente
+	closed chan struct{}
+	// done se cierra para pedir el cierre de la conexión (cliente lento, apagado)
+	done     chan struct{}
+	doneOnce sync.Once
+	// draining se cierra para vaciar la cola y cerrar la conexión con
+	// closeCode (1001 durante el apagado, 1008 por violaciones)
+	draining    chan struct{}
+	drainOnce   sync.Once
+	closeCode   int
+	closeReason string
+	// delivered y dropped cuentan los mensajes escritos y descartados
+	delivered uint64
+	dropped   uint64
+	// ackMode activa la entrega al menos una vez: los mensajes numerados se
+	// reenvían hasta que el cliente los confirma con el comando ack
+	ackMode     bool
+	pending     map[uint64]*pendingAck
+	acked       uint64
+	redelivered uint64
+	failed      uint64
+	// outbound es la cola acotada por la que se envían los mensajes al cliente
 	outbound chan []byte
+	// subscription son los filtros pedidos con el comando subscribe. Mientras
+	// el cliente no se suscriba recibe todos los eventos.
+	subscription *Subscription
+	subscribed   bool
+	mutex        *sync.Mutex
+	// resumeFrom es la última secuencia vista y resumeStream su stream, si el
+	// cliente se reconecta con ?last_seq=&stream=
+	resumeFrom   *uint64
+	resumeStream string
+	// limiter y violations aplican los InputLimits del Hub a los mensajes recibidos
+	limiter    *tokenBucket
+	violations int
 }
 
 func NewClient(hub *Hub, socket *websocket.Conn, id string) *Client {
-	return &Client{
-		hub:      hub,
-		socket:   socket,
-		id:       id,
-		outbound: make(chan []byte),
+	client := &Client{
+		hub:          hub,
+		socket:       socket,
+		id:           id,
+		outbound:     make(chan []byte, hub.clientOptions.QueueSize),
+		closed:       make(chan struct{}),
+		done:         make(chan struct{}),
+		draining:     make(chan struct{}),
+		pending:      make(map[uint64]*pendingAck),
+		subscription: &Subscription{},
+		mutex:        &sync.Mutex{},
+		limiter:      newTokenBucket(hub.clientOptions.Limits.Rate, hub.clientOptions.Limits.Burst),
+	}
+	if socket != nil {
+		client.remoteAddr = socket.RemoteAddr().String()
+	}
+	return client
+}
+
+// expireAt programa el cierre de la conexión cuando vence el token
+func (c *Client) expireAt(at time.Time) {
+	if at.IsZero() {
+		return
+	}
+	c.expiry = time.AfterFunc(time.Until(at), func() {
+		log.Printf("Token expired for client %s", c.id)
+		if c.socket != nil {
+			c.socket.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(CloseTokenExpired, "token expired"), time.Now().Add(time.Second))
+		}
+		c.disconnect()
+	})
+}
+
+// wants indica si el evento coincide con las suscripciones del cliente
+func (c *Client) wants(m Routable) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.subscribed {
+		return true
+	}
+	return c.subscription.matches(m)
+}
+
+// send serializa el mensaje y lo encola para el cliente
+func (c *Client) send(message interface{}) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("Error encoding message for client %s: %v", c.id, err)
+		return
+	}
+	c.enqueue(data)
+}
+
+// handleCommand aplica un comando del protocolo y devuelve la respuesta
+func (c *Client) handleCommand(cmd *Command) *Reply {
+	switch cmd.Type {
+	case commandSubscribe:
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		c.subscribed = true
+		c.subscription.add(cmd)
+		reply := newReply("subscribed", cmd.RequestID)
+		reply.Subscriptions = c.subscription.clone()
+		return reply
+	case commandUnsubscribe:
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		c.subscribed = true
+		if len(cmd.EventTypes) == 0 && len(cmd.FeedIDs) == 0 && len(cmd.Keywords) == 0 {
+			c.subscription = &Subscription{}
+		} else {
+			c.subscription.remove(cmd)
+		}
+		reply := newReply("unsubscribed", cmd.RequestID)
+		reply.Subscriptions = c.subscription.clone()
+		return reply
+	case commandPing:
+		return newReply("pong", cmd.RequestID)
+	default:
+		return newErrorReply(cmd.RequestID, fmt.Sprintf("unknown command type %q", cmd.Type))
 	}
 }
 
@@ -40,15 +158,28 @@ func (c *Client) Write() {
 
 	for {
 		select {
+		case <-c.done:
+			// Cerrar el socket hace que Read termine y dé de baja al cliente
+			c.socket.Close()
+			return
+		case <-c.closed:
+			return
+		case <-c.draining:
+			c.closeDrained()
+			return
 		case message := <-c.outbound:
-			log.Printf("Sending message to client %s: %s", c.id, string(message))
+			log.Printf("Sending message to client %s: %s", c.id, truncateForLog(message))
+			c.socket.SetWriteDeadline(time.Now().Add(c.hub.clientOptions.WriteTimeout))
 			err := c.socket.WriteMessage(websocket.TextMessage, message)
 			if err != nil {
 				log.Printf("Error writing message to client %s: %v", c.id, err)
+				c.socket.Close()
 				return
 			}
+			atomic.AddUint64(&c.delivered, 1)
 		case <-ticker.C:
 			// Send ping to keep connection alive
+			c.socket.SetWriteDeadline(time.Now().Add(c.hub.clientOptions.WriteTimeout))
 			err := c.socket.WriteMessage(websocket.PingMessage, []byte("keepalive"))
 			if err != nil {
 				log.Printf("Error sending ping to client %s: %v", c.id, err)
@@ -62,7 +193,7 @@ func (c *Client) Write() {
 func (c *Client) Read() {
 	defer func() {
 		log.Printf("Read goroutine exiting for client %s", c.id)
-		c.hub.unregister <- c
+		c.hub.unregisterClient(c)
 	}()
 	log.Printf("Read goroutine started for client %s", c.id)
 
@@ -72,14 +203,44 @@ func (c *Client) Read() {
 	})
 
 	for {
-		_, message, err := c.socket.ReadMessage()
+		message, tooBig, err := c.readMessage()
 		if err != nil {
 			log.Printf("Error reading message from client %s: %v", c.id, err)
 			break
 		}
-		log.Printf("Received message from client %s: %s", c.id, string(message))
 
-		// Echo back the message
-		c.outbound <- message
+		// Tras superar MaxViolations se ignora todo hasta que Write cierre la conexión
+		if c.violations >= c.hub.clientOptions.Limits.MaxViolations {
+			continue
+		}
+		if !c.limiter.allow(time.Now()) {
+			c.violation("", errorRateLimited, "rate limit exceeded")
+			continue
+		}
+		if tooBig {
+			c.violation("", errorMessageTooBig, fmt.Sprintf("message exceeds %d bytes", c.hub.clientOptions.Limits.MaxMessageSize))
+			continue
+		}
+		log.Printf("Received message from client %s: %s", c.id, truncateForLog(message))
+
+		cmd, err := parseCommand(message)
+		if err != nil {
+			c.violation("", errorInvalidCommand, "invalid command: "+err.Error())
+			continue
+		}
+		if cmd.Type == commandAck {
+			c.ack(cmd.Seqs)
+			continue
+		}
+		if cmd.Type == commandResume {
+			if cmd.LastSeq == nil {
+				c.send(newErrorReply(cmd.RequestID, "last_seq is required"))
+				continue
+			}
+			// El Hub responde con resumed o resync_required
+			c.hub.Resume(c, cmd.Stream, *cmd.LastSeq, cmd.RequestID)
+			continue
+		}
+		c.send(c.handleCommand(cmd))
 	}
 }
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	presenceSubject = "pusher.presence"
+	deliverSubject  = "pusher.deliver."
+)
+
+// nodePresence es la lista de clientes que anuncia una instancia
+type nodePresence struct {
+	NodeID  string        `json:"node_id"`
+	Clients []ClientStats `json:"clients"`
+	At      time.Time     `json:"at"`
+	// Leaving indica que la instancia se está apagando
+	Leaving bool `json:"leaving,omitempty"`
+}
+
+// delivery es un mensaje dirigido a un cliente o usuario de otra instancia
+type delivery struct {
+	ClientID string          `json:"client_id,omitempty"`
+	UserID   string          `json:"user_id,omitempty"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+// Cluster anuncia por NATS los clientes conectados a esta instancia y
+// mantiene un directorio de los clientes de las demás, para entregar
+// mensajes a un cliente o usuario sin importar en qué réplica está.
+type Cluster struct {
+	nodeID   string
+	conn     *nats.Conn
+	hub      *Hub
+	interval time.Duration
+	mutex    *sync.Mutex
+	nodes    map[string]*nodePresence
+	subs     []*nats.Subscription
+	stop     chan struct{}
+}
+
+func NewCluster(nodeID string, conn *nats.Conn, hub *Hub, interval time.Duration) *Cluster {
+	return &Cluster{
+		nodeID:   nodeID,
+		conn:     conn,
+		hub:      hub,
+		interval: interval,
+		mutex:    &sync.Mutex{},
+		nodes:    make(map[string]*nodePresence),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start se suscribe a la presencia y a las entregas dirigidas a esta instancia
+func (c *Cluster) Start() error {
+	sub, err := c.conn.Subscribe(presenceSubject, c.onPresence)
+	if err != nil {
+		return fmt.Errorf("error subscribing to presence: %w", err)
+	}
+	c.subs = append(c.subs, sub)
+	sub, err = c.conn.Subscribe(deliverSubject+c.nodeID, c.onDelivery)
+	if err != nil {
+		return fmt.Errorf("error subscribing to deliveries: %w", err)
+	}
+	c.subs = append(c.subs, sub)
+	go c.run()
+	return nil
+}
+
+// run anuncia la presencia periódicamente y cada vez que cambian los clientes
+func (c *Cluster) run() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	c.announce(false)
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			c.announce(false)
+		case <-c.hub.changed:
+			c.announce(false)
+		}
+	}
+}
+
+// Stop anuncia que la instancia se va y cancela las suscripciones
+func (c *Cluster) Stop() {
+	close(c.stop)
+	c.announce(true)
+	for _, sub := range c.subs {
+		if err := sub.Unsubscribe(); err != nil {
+			log.Printf("Error unsubscribing from %s: %v", sub.Subject, err)
+		}
+	}
+}
+
+func (c *Cluster) announce(leaving bool) {
+	presence := nodePresence{
+		NodeID:  c.nodeID,
+		Clients: c.hub.Stats(),
+		At:      time.Now().UTC(),
+		Leaving: leaving,
+	}
+	if leaving {
+		presence.Clients = nil
+	}
+	data, err := json.Marshal(presence)
+	if err != nil {
+		log.Printf("Error encoding presence: %v", err)
+		return
+	}
+	if err := c.conn.Publish(presenceSubject, data); err != nil {
+		log.Printf("Error publishing presence: %v", err)
+	}
+}
+
+func (c *Cluster) onPresence(m *nats.Msg) {
+	var presence nodePresence
+	if err := json.Unmarshal(m.Data, &presence); err != nil {
+		log.Printf("Error decoding presence: %v", err)
+		return
+	}
+	if presence.NodeID == c.nodeID {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if presence.Leaving {
+		delete(c.nodes, presence.NodeID)
+		return
+	}
+	c.nodes[presence.NodeID] = &presence
+}
+
+func (c *Cluster) onDelivery(m *nats.Msg) {
+	var d delivery
+	if err := json.Unmarshal(m.Data, &d); err != nil {
+		log.Printf("Error decoding delivery: %v", err)
+		return
+	}
+	if d.ClientID != "" {
+		c.hub.SendToClient(d.ClientID, d.Payload)
+	}
+	if d.UserID != "" {
+		c.hub.SendToUser(d.UserID, d.Payload)
+	}
+}
+
+// liveNodes devuelve las instancias remotas que anunciaron su presencia hace
+// menos de tres intervalos. Debe llamarse con el mutex tomado.
+func (c *Cluster) liveNodes() []*nodePresence {
+	deadline := time.Now().Add(-3 * c.interval)
+	nodes := make([]*nodePresence, 0, len(c.nodes))
+	for id, node := range c.nodes {
+		if node.At.Before(deadline) {
+			delete(c.nodes, id)
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+func (c *Cluster) forward(nodeID string, d delivery) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return c.conn.Publish(deliverSubject+nodeID, data)
+}
+
+// SendToClient entrega el mensaje al cliente id, esté en esta instancia o en otra
+func (c *Cluster) SendToClient(id string, message interface{}) (bool, error) {
+	if c.hub.SendToClient(id, message) {
+		return true, nil
+	}
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return false, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, node := range c.liveNodes() {
+		for _, client := range node.Clients {
+			if client.ID == id {
+				return true, c.forward(node.NodeID, delivery{ClientID: id, Payload: payload})
+			}
+		}
+	}
+	return false, nil
+}
+
+// SendToUser entrega el mensaje a todas las conexiones del usuario en el cluster
+func (c *Cluster) SendToUser(userID string, message interface{}) error {
+	c.hub.SendToUser(userID, message)
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, node := range c.liveNodes() {
+		for _, client := range node.Clients {
+			if client.UserID == userID {
+				if err := c.forward(node.NodeID, delivery{UserID: userID, Payload: payload}); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// Clients devuelve los clientes conectados a todas las instancias
+func (c *Cluster) Clients() []ClientStats {
+	clients := c.hub.Stats()
+	for i := range clients {
+		clients[i].NodeID = c.nodeID
+	}
+	c.mutex.Lock()
+	for _, node := range c.liveNodes() {
+		for _, client := range node.Clients {
+			client.NodeID = node.NodeID
+			clients = append(clients, client)
+		}
+	}
+	c.mutex.Unlock()
+	sort.Slice(clients, func(i, j int) bool {
+		if clients[i].NodeID != clients[j].NodeID {
+			return clients[i].NodeID < clients[j].NodeID
+		}
+		return clients[i].ID < clients[j].ID
+	})
+	return clients
+}
+
+// HandleClients lista los clientes del cluster, o solo los locales con ?local=true
+func (c *Cluster) HandleClients(w http.ResponseWriter, r *http.Request) {
+	clients := c.Clients()
+	if r.URL.Query().Get("local") == "true" {
+		clients = c.hub.Stats()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(clients)
+}
+
+// HandleSend envía el cuerpo JSON de la petición a ?client_id= o ?user_id=
+func (c *Cluster) HandleSend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var payload json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Failed to decode request", http.StatusBadRequest)
+		return
+	}
+	clientID := r.URL.Query().Get("client_id")
+	userID := r.URL.Query().Get("user_id")
+	switch {
+	case clientID != "":
+		found, err := c.SendToClient(clientID, payload)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "client not found", http.StatusNotFound)
+			return
+		}
+	case userID != "":
+		if err := c.SendToUser(userID, payload); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "client_id or user_id is required", http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// presenceMsg codifica el anuncio de presencia como lo recibe el Cluster
+func presenceMsg(t *testing.T, presence nodePresence) *nats.Msg {
+	t.Helper()
+	data, err := json.Marshal(presence)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	return &nats.Msg{Subject: presenceSubject, Data: data}
+}
+
+func TestClusterDirectory(t *testing.T) {
+	hub := NewHub(NewReplayBuffer("test", 1, time.Minute), ClientOptions{QueueSize: 1}, NewAuthenticator(testSecret, nil, time.Second))
+	cluster := NewCluster("node-a", nil, hub, time.Second)
+	now := time.Now().UTC()
+
+	cluster.onPresence(presenceMsg(t, nodePresence{NodeID: "node-a", Clients: []ClientStats{{ID: "self"}}, At: now}))
+	cluster.onPresence(presenceMsg(t, nodePresence{NodeID: "node-c", Clients: []ClientStats{{ID: "c2"}, {ID: "c1"}}, At: now}))
+	cluster.onPresence(presenceMsg(t, nodePresence{NodeID: "node-b", Clients: []ClientStats{{ID: "b1"}}, At: now}))
+	cluster.onPresence(presenceMsg(t, nodePresence{NodeID: "node-stale", Clients: []ClientStats{{ID: "s1"}}, At: now.Add(-time.Minute)}))
+	cluster.onPresence(presenceMsg(t, nodePresence{NodeID: "node-gone", Clients: []ClientStats{{ID: "g1"}}, At: now}))
+	cluster.onPresence(presenceMsg(t, nodePresence{NodeID: "node-gone", At: now, Leaving: true}))
+
+	want := []struct{ node, id string }{{"node-b", "b1"}, {"node-c", "c1"}, {"node-c", "c2"}}
+	clients := cluster.Clients()
+	if len(clients) != len(want) {
+		t.Fatalf("Clients = %+v, want %v", clients, want)
+	}
+	for i, client := range clients {
+		if client.NodeID != want[i].node || client.ID != want[i].id {
+			t.Errorf("client %d = %s/%s, want %s/%s", i, client.NodeID, client.ID, want[i].node, want[i].id)
+		}
+	}
+	if _, ok := cluster.nodes["node-stale"]; ok {
+		t.Error("stale node was not removed from the directory")
+	}
+}
+
+func TestClusterSendToUnknownClient(t *testing.T) {
+	hub := NewHub(NewReplayBuffer("test", 1, time.Minute), ClientOptions{QueueSize: 1}, NewAuthenticator(testSecret, nil, time.Second))
+	cluster := NewCluster("node-a", nil, hub, time.Second)
+	cluster.onPresence(presenceMsg(t, nodePresence{NodeID: "node-b", Clients: []ClientStats{{ID: "b1", UserID: "user-1"}}, At: time.Now().Add(-time.Minute)}))
+
+	// node-b ya no está vivo, así que no se reenvía nada y no se usa la conexión
+	found, err := cluster.SendToClient("b1", map[string]string{"type": "ping"})
+	if err != nil || found {
+		t.Errorf("SendToClient = %v, %v, want false, nil", found, err)
+	}
+	if err := cluster.SendToUser("user-1", map[string]string{"type": "ping"}); err != nil {
+		t.Errorf("SendToUser = %v", err)
+	}
+}
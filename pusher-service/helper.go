@@ -1,23 +1,143 @@
 package main
 
 import (
+	"strings"
 	"time"
+
+	"platzi.com/go/cqrs/events"
 )
 
+// CreatedFeedMessage anuncia un feed nuevo (created_feed), un borrador o feed
+// programado que se acaba de publicar (published_feed), un cambio en su
+// contenido (updated_feed) o un feed que volvió de la papelera
+// (restored_feed). No incluye el cuerpo (body), que puede ser largo;
+// los clientes lo obtienen de query-service.
 type CreatedFeedMessage struct {
-	Type        string    `json:"type"`
-	ID          string    `json:"id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	CreatedAt   time.Time `json:"created_at"`
+	Seq         uint64     `json:"seq,omitempty"`
+	Type        string     `json:"type"`
+	ID          string     `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Author      string     `json:"author,omitempty"`
+	URL         string     `json:"url,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	Language    string     `json:"language,omitempty"`
+	Status      string     `json:"status,omitempty"`
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	// Revision y ChangedFields solo se envían en updated_feed
+	Revision      int      `json:"revision,omitempty"`
+	ChangedFields []string `json:"changed_fields,omitempty"`
 }
 
-func newCreatedFeedMessage(id, title, description string, createdAt time.Time) *CreatedFeedMessage{
+func newCreatedFeedMessage(m events.CreatedFeedMessage) *CreatedFeedMessage {
 	return &CreatedFeedMessage{
 		Type:        "created_feed",
-		ID:          id,
-		Title:       title,
-		Description: description,
-		CreatedAt:   createdAt,
+		ID:          m.ID,
+		Title:       m.Title,
+		Description: m.Description,
+		Author:      m.Author,
+		URL:         m.URL,
+		Tags:        m.Tags,
+		Language:    m.Language,
+		Status:      m.Status,
+		PublishedAt: m.PublishedAt,
+		CreatedAt:   m.CreatedAt,
+	}
+}
+
+func newPublishedFeedMessage(m events.PublishedFeedMessage) *CreatedFeedMessage {
+	msg := newCreatedFeedMessage(m.CreatedFeedMessage)
+	msg.Type = m.Type()
+	return msg
+}
+
+func newUpdatedFeedMessage(m events.UpdatedFeedMessage) *CreatedFeedMessage {
+	msg := newCreatedFeedMessage(m.CreatedFeedMessage)
+	msg.Type = m.Type()
+	msg.Revision = m.Revision
+	msg.ChangedFields = m.ChangedFields
+	return msg
+}
+
+func (m *CreatedFeedMessage) SetSeq(seq uint64) {
+	m.Seq = seq
+}
+
+func (m *CreatedFeedMessage) EventType() string {
+	return m.Type
+}
+
+func (m *CreatedFeedMessage) FeedID() string {
+	return m.ID
+}
+
+func (m *CreatedFeedMessage) Text() string {
+	return m.Title + " " + m.Description + " " + strings.Join(m.Tags, " ")
+}
+
+func newRestoredFeedMessage(m events.RestoredFeedMessage) *CreatedFeedMessage {
+	msg := newCreatedFeedMessage(m.CreatedFeedMessage)
+	msg.Type = m.Type()
+	return msg
+}
+
+// DeletedFeedMessage anuncia que un feed se movió a la papelera; los clientes
+// deberían dejar de mostrarlo
+type DeletedFeedMessage struct {
+	Seq       uint64    `json:"seq,omitempty"`
+	Type      string    `json:"type"`
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+func newDeletedFeedMessage(m events.DeletedFeedMessage) *DeletedFeedMessage {
+	return &DeletedFeedMessage{
+		Type:      m.Type(),
+		ID:        m.ID,
+		Title:     m.Title,
+		DeletedAt: m.DeletedAt,
+	}
+}
+
+func (m *DeletedFeedMessage) SetSeq(seq uint64) {
+	m.Seq = seq
+}
+
+func (m *DeletedFeedMessage) EventType() string {
+	return m.Type
+}
+
+func (m *DeletedFeedMessage) FeedID() string {
+	return m.ID
+}
+
+func (m *DeletedFeedMessage) Text() string {
+	return m.Title
+}
+
+type SavedSearchMatchedMessage struct {
+	Seq           uint64    `json:"seq,omitempty"`
+	Type          string    `json:"type"`
+	SavedSearchID string    `json:"saved_search_id"`
+	Query         string    `json:"query"`
+	FeedID        string    `json:"feed_id"`
+	FeedTitle     string    `json:"feed_title"`
+	MatchedAt     time.Time `json:"matched_at"`
+}
+
+func newSavedSearchMatchedMessage(savedSearchID, query, feedID, feedTitle string, matchedAt time.Time) *SavedSearchMatchedMessage {
+	return &SavedSearchMatchedMessage{
+		Type:          "saved_search_matched",
+		SavedSearchID: savedSearchID,
+		Query:         query,
+		FeedID:        feedID,
+		FeedTitle:     feedTitle,
+		MatchedAt:     matchedAt,
 	}
-}
\ No newline at end of file
+}
+
+func (m *SavedSearchMatchedMessage) SetSeq(seq uint64) {
+	m.Seq = seq
+}
@@ -4,44 +4,93 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true },
-}
-
 type Hub struct {
 	clients    []*Client
 	register   chan *Client
 	unregister chan *Client
 	mutex      *sync.Mutex
+	// replay guarda los últimos mensajes numerados para los clientes que se reconectan
+	replay *ReplayBuffer
+	// clientOptions configura la cola de envío de cada cliente
+	clientOptions ClientOptions
+	// changed avisa al Cluster de que se conectó o desconectó un cliente
+	changed chan struct{}
+	// auth valida el token y el origen de cada conexión
+	auth     *Authenticator
+	upgrader websocket.Upgrader
+	// shuttingDown rechaza nuevos clientes durante el apagado y quit detiene Run
+	shuttingDown bool
+	quit         chan struct{}
 }
 
-func NewHub() *Hub {
+func NewHub(replay *ReplayBuffer, clientOptions ClientOptions, authenticator *Authenticator) *Hub {
 	return &Hub{
-		clients:    make([]*Client, 0),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		mutex:      &sync.Mutex{},
+		clients:       make([]*Client, 0),
+		register:      make(chan *Client),
+		unregister:    make(chan *Client),
+		mutex:         &sync.Mutex{},
+		replay:        replay,
+		clientOptions: clientOptions,
+		changed:       make(chan struct{}, 1),
+		quit:          make(chan struct{}),
+		auth:          authenticator,
+		upgrader: websocket.Upgrader{
+			CheckOrigin: authenticator.CheckOrigin,
+		},
+	}
+}
+
+// notifyChanged avisa sin bloquear de un cambio en la lista de clientes
+func (h *Hub) notifyChanged() {
+	select {
+	case h.changed <- struct{}{}:
+	default:
 	}
 }
 
 func (h *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
-	socket, err := upgrader.Upgrade(w, r, nil)
+	socket, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
+		// Upgrade ya respondió con el error (por ejemplo 403 por el origen)
 		log.Println(err)
-		http.Error(w, "Could not open websocket connection", http.StatusBadRequest)
+		return
+	}
+	socket.SetReadLimit(h.clientOptions.Limits.frameLimit())
+	claims := h.auth.authenticateSocket(socket, r)
+	if claims == nil {
+		log.Printf("Rejected unauthenticated websocket from %s", socket.RemoteAddr())
 		return
 	}
 	client := NewClient(h, socket, uuid.New().String())
-	h.register <- client
+	client.userID = claims.Subject
+	client.expireAt(claims.Expiry())
+	if lastSeq := r.URL.Query().Get("last_seq"); lastSeq != "" {
+		seq, err := strconv.ParseUint(lastSeq, 10, 64)
+		if err == nil {
+			client.resumeFrom = &seq
+			client.resumeStream = r.URL.Query().Get("stream")
+		}
+	}
+	client.subscribeFromQuery(r)
+	client.ackMode = r.URL.Query().Get("ack") == "true"
+	if !h.registerClient(client) {
+		closeSocket(socket, websocket.CloseGoingAway, "server shutting down")
+		return
+	}
 
 	go client.Write()
 	go client.Read()
+	if client.ackMode {
+		go client.redeliver()
+	}
 }
 
 func (h *Hub) Run() {
@@ -52,49 +101,199 @@ func (h *Hub) Run() {
 			h.onConnect(client)
 		case client := <-h.unregister:
 			h.onDisconnect(client)
+		case <-h.quit:
+			log.Println("Hub stopped")
+			return
 		}
 	}
 }
 
+// registerClient entrega el cliente a Run; devuelve false si el Hub ya se detuvo
+func (h *Hub) registerClient(client *Client) bool {
+	select {
+	case h.register <- client:
+		return true
+	case <-h.quit:
+		return false
+	}
+}
+
+// unregisterClient pide a Run que dé de baja al cliente, sin bloquear si el Hub ya se detuvo
+func (h *Hub) unregisterClient(client *Client) {
+	select {
+	case h.unregister <- client:
+	case <-h.quit:
+	}
+}
+
 func (h *Hub) onConnect(client *Client) {
-	log.Println("Client connected:", client.socket.RemoteAddr())
+	log.Println("Client connected:", client.remoteAddr)
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
-	client.id = client.socket.RemoteAddr().String()
 	h.clients = append(h.clients, client)
+	h.notifyChanged()
+	if h.shuttingDown {
+		client.goAway(0)
+		return
+	}
 
 	// Send welcome message
-	welcomeMessage := map[string]string{
+	welcomeMessage := map[string]interface{}{
 		"type":      "welcome",
 		"message":   "Connected to WebSocket server",
-		"timestamp": "2025-12-19T15:42:30Z",
+		"client_id": client.id,
+		"user_id":   client.userID,
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+		"last_seq":  h.replay.lastSeq,
+		"stream":    h.replay.stream,
 	}
 	data, _ := json.Marshal(welcomeMessage)
-	client.outbound <- data
+	client.enqueue(data)
+
+	if client.resumeFrom != nil {
+		h.replayTo(client, client.resumeStream, *client.resumeFrom, "")
+	}
+}
+
+// Resume reenvía al cliente los mensajes de stream posteriores a lastSeq
+func (h *Hub) Resume(client *Client, stream string, lastSeq uint64, requestID string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.replayTo(client, stream, lastSeq, requestID)
+}
+
+// replayTo debe llamarse con el mutex tomado, para que ningún mensaje nuevo
+// se intercale con los reenviados
+func (h *Hub) replayTo(client *Client, stream string, lastSeq uint64, requestID string) {
+	entries, ok := h.replay.since(stream, lastSeq)
+	// Si los mensajes perdidos no caben en la cola, se descartarían en silencio
+	if ok && len(entries) > client.free() {
+		ok = false
+	}
+	if !ok {
+		reply := newReply("resync_required", requestID)
+		reply.LastSeq = h.replay.lastSeq
+		reply.Stream = h.replay.stream
+		client.send(reply)
+		return
+	}
+	replayed := 0
+	for _, entry := range entries {
+		if entry.userID != "" && entry.userID != client.userID {
+			continue
+		}
+		if entry.routable != nil && !client.wants(entry.routable) {
+			continue
+		}
+		if client.deliver(entry.seq, entry.data) {
+			replayed++
+		}
+	}
+	reply := newReply("resumed", requestID)
+	reply.LastSeq = h.replay.lastSeq
+	reply.Stream = h.replay.stream
+	reply.Replayed = replayed
+	client.send(reply)
+}
+
+// stamp numera el mensaje, lo serializa y lo guarda para reenvíos. Debe
+// llamarse con el mutex tomado.
+func (h *Hub) stamp(message interface{}, userID string) (uint64, []byte) {
+	sequenced, ok := message.(Sequenced)
+	if !ok {
+		data, _ := json.Marshal(message)
+		return 0, data
+	}
+	seq := h.replay.next()
+	sequenced.SetSeq(seq)
+	data, _ := json.Marshal(message)
+	routable, _ := message.(Routable)
+	h.replay.add(replayEntry{
+		seq:      seq,
+		at:       time.Now(),
+		data:     data,
+		routable: routable,
+		userID:   userID,
+	})
+	return seq, data
 }
 
 func (h *Hub) onDisconnect(client *Client) {
-	log.Println("Client disconnected:", client.socket.RemoteAddr())
-	client.socket.Close()
+	log.Println("Client disconnected:", client.remoteAddr)
+	if client.expiry != nil {
+		client.expiry.Stop()
+	}
+	if client.socket != nil {
+		client.socket.Close()
+	}
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
+	close(client.closed)
 
 	i := -1
 	for j, c := range h.clients {
-		if c.id == client.id {
+		if c == client {
 			i = j
 		}
 	}
+	if i < 0 {
+		return
+	}
 	copy(h.clients[i:], h.clients[i+1:])
 	h.clients[len(h.clients)-1] = nil
 	h.clients = h.clients[:len(h.clients)-1]
+	h.notifyChanged()
 }
 
 func (h *Hub) Broadcast(message interface{}, ignore *Client) {
-	data, _ := json.Marshal(message)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	seq, data := h.stamp(message, "")
+	routable, filtered := message.(Routable)
 	for _, client := range h.clients {
-		if client != ignore {
-			client.outbound <- data
+		if client == ignore {
+			continue
+		}
+		if filtered && !client.wants(routable) {
+			continue
 		}
+		client.deliver(seq, data)
+	}
+}
+
+// SendToUser entrega el mensaje solo a los clientes del usuario userID
+func (h *Hub) SendToUser(userID string, message interface{}) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	seq, data := h.stamp(message, userID)
+	for _, client := range h.clients {
+		if client.userID == userID {
+			client.deliver(seq, data)
+		}
+	}
+}
+
+// SendToClient entrega el mensaje al cliente id si está conectado a esta instancia
+func (h *Hub) SendToClient(id string, message interface{}) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, client := range h.clients {
+		if client.id == id {
+			data, _ := json.Marshal(message)
+			client.enqueue(data)
+			return true
+		}
+	}
+	return false
+}
+
+// Stats devuelve el estado de entrega de los clientes conectados
+func (h *Hub) Stats() []ClientStats {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	stats := make([]ClientStats, 0, len(h.clients))
+	for _, client := range h.clients {
+		stats = append(stats, client.stats())
 	}
+	return stats
 }
@@ -1,17 +1,55 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"fmt"
 
 	"github.com/kelseyhightower/envconfig"
 	"platzi.com/go/cqrs/events"
+	"platzi.com/go/cqrs/models"
 )
 
 type Config struct {
 	NatsAddress string `envconfig:"NATS_ADDRESS"`
+	// ReplayBufferSize y ReplayMaxAge limitan los mensajes reenviables a clientes que se reconectan
+	ReplayBufferSize int           `envconfig:"REPLAY_BUFFER_SIZE" default:"1000"`
+	ReplayMaxAge     time.Duration `envconfig:"REPLAY_MAX_AGE" default:"5m"`
+	// SendQueueSize, SlowConsumerPolicy y WriteTimeout evitan que un cliente lento bloquee al resto
+	SendQueueSize      int           `envconfig:"SEND_QUEUE_SIZE" default:"256"`
+	SlowConsumerPolicy string        `envconfig:"SLOW_CONSUMER_POLICY" default:"drop_oldest"`
+	WriteTimeout       time.Duration `envconfig:"WRITE_TIMEOUT" default:"10s"`
+	// NodeID identifica a esta instancia en el cluster (por defecto, el hostname)
+	NodeID           string        `envconfig:"NODE_ID"`
+	PresenceInterval time.Duration `envconfig:"PRESENCE_INTERVAL" default:"10s"`
+	// JWTSecret firma los tokens HS256 de los clientes de /ws y /events
+	JWTSecret      string        `envconfig:"JWT_SECRET" required:"true"`
+	AllowedOrigins []string      `envconfig:"ALLOWED_ORIGINS"`
+	AuthTimeout    time.Duration `envconfig:"AUTH_TIMEOUT" default:"10s"`
+	// AckTimeout y AckMaxAttempts aplican a los clientes conectados con ?ack=true
+	AckTimeout     time.Duration `envconfig:"ACK_TIMEOUT" default:"10s"`
+	AckMaxAttempts int           `envconfig:"ACK_MAX_ATTEMPTS" default:"5"`
+	// ShutdownTimeout es el plazo para vaciar las colas al apagarse y
+	// ReconnectHint cuánto esperan los clientes antes de reconectarse
+	ShutdownTimeout time.Duration `envconfig:"SHUTDOWN_TIMEOUT" default:"15s"`
+	ReconnectHint   time.Duration `envconfig:"RECONNECT_HINT" default:"1s"`
+	// MaxMessageSize, RateLimit y RateBurst limitan los mensajes de cada
+	// cliente de /ws; tras MaxViolations mensajes rechazados se le desconecta
+	MaxMessageSize int64   `envconfig:"MAX_MESSAGE_SIZE" default:"4096"`
+	RateLimit      float64 `envconfig:"RATE_LIMIT" default:"10"`
+	RateBurst      int     `envconfig:"RATE_BURST" default:"20"`
+	MaxViolations  int     `envconfig:"MAX_VIOLATIONS" default:"5"`
+	// AdminAddress es un listener aparte para /admin/clients y /admin/send,
+	// que no debe publicarse fuera de la red interna. Las peticiones llevan
+	// AdminToken como Bearer; sin AdminToken el listener no se abre.
+	AdminAddress string `envconfig:"ADMIN_ADDRESS" default:":8081"`
+	AdminToken   string `envconfig:"ADMIN_TOKEN"`
 }
 
 func main() {
@@ -21,7 +59,35 @@ func main() {
 		log.Fatalf("Failed to process env vars: %s", err)
 	}
 
-	hub := NewHub()
+	policy, err := ParseSlowConsumerPolicy(cfg.SlowConsumerPolicy)
+	if err != nil {
+		log.Fatalf("Invalid SLOW_CONSUMER_POLICY: %s", err)
+	}
+	if cfg.AckTimeout <= 0 || cfg.AckMaxAttempts < 1 {
+		log.Fatalf("ACK_TIMEOUT must be positive and ACK_MAX_ATTEMPTS at least 1")
+	}
+	if cfg.MaxMessageSize <= 0 || cfg.RateLimit <= 0 || cfg.RateBurst < 1 || cfg.MaxViolations < 1 {
+		log.Fatalf("MAX_MESSAGE_SIZE and RATE_LIMIT must be positive, RATE_BURST and MAX_VIOLATIONS at least 1")
+	}
+	if cfg.NodeID == "" {
+		if cfg.NodeID, err = os.Hostname(); err != nil {
+			log.Fatalf("Failed to get hostname for NODE_ID: %s", err)
+		}
+	}
+	replay := NewReplayBuffer(NewStreamID(cfg.NodeID), cfg.ReplayBufferSize, cfg.ReplayMaxAge)
+	hub := NewHub(replay, ClientOptions{
+		QueueSize:      cfg.SendQueueSize,
+		Policy:         policy,
+		WriteTimeout:   cfg.WriteTimeout,
+		AckTimeout:     cfg.AckTimeout,
+		AckMaxAttempts: cfg.AckMaxAttempts,
+		Limits: InputLimits{
+			MaxMessageSize: cfg.MaxMessageSize,
+			Rate:           cfg.RateLimit,
+			Burst:          cfg.RateBurst,
+			MaxViolations:  cfg.MaxViolations,
+		},
+	}, NewAuthenticator([]byte(cfg.JWTSecret), cfg.AllowedOrigins, cfg.AuthTimeout))
 
 	//Coneccion a NATS
 	n, err := events.NewNats(fmt.Sprintf("nats://%s", cfg.NatsAddress))
@@ -29,21 +95,121 @@ func main() {
 		log.Fatalf("Failed to connect to NATS: %s", err)
 	}
 
+	// Los borradores y feeds programados se anuncian al publicarse
 	err = n.OnCreatedFeed(func(m events.CreatedFeedMessage) {
-		hub.Broadcast(newCreatedFeedMessage(m.ID, m.Title, m.Description, m.CreatedAt), nil)
+		if m.Status == models.FeedStatusPublished {
+			hub.Broadcast(newCreatedFeedMessage(m), nil)
+		}
 	})
 	if err != nil {
 		log.Fatalf("Failed to subscribe to created_feed events: %s", err)
 	}
 
+	err = n.OnPublishedFeed(func(m events.PublishedFeedMessage) {
+		hub.Broadcast(newPublishedFeedMessage(m), nil)
+	})
+	if err != nil {
+		log.Fatalf("Failed to subscribe to published_feed events: %s", err)
+	}
+
+	err = n.OnUpdatedFeed(func(m events.UpdatedFeedMessage) {
+		if m.Status == models.FeedStatusPublished {
+			hub.Broadcast(newUpdatedFeedMessage(m), nil)
+		}
+	})
+	if err != nil {
+		log.Fatalf("Failed to subscribe to updated_feed events: %s", err)
+	}
+
+	// Solo los feeds publicados llegaron a los clientes, así que son los
+	// únicos cuyo borrado o restauración se anuncia
+	err = n.OnDeletedFeed(func(m events.DeletedFeedMessage) {
+		if m.Status == models.FeedStatusPublished {
+			hub.Broadcast(newDeletedFeedMessage(m), nil)
+		}
+	})
+	if err != nil {
+		log.Fatalf("Failed to subscribe to deleted_feed events: %s", err)
+	}
+
+	err = n.OnRestoredFeed(func(m events.RestoredFeedMessage) {
+		if m.Status == models.FeedStatusPublished {
+			hub.Broadcast(newRestoredFeedMessage(m), nil)
+		}
+	})
+	if err != nil {
+		log.Fatalf("Failed to subscribe to restored_feed events: %s", err)
+	}
+
+	err = n.OnSavedSearchMatched(func(m events.SavedSearchMatchedMessage) {
+		hub.SendToUser(m.OwnerID, newSavedSearchMatchedMessage(m.SavedSearchID, m.Query, m.FeedID, m.FeedTitle, m.MatchedAt))
+	})
+	if err != nil {
+		log.Fatalf("Failed to subscribe to saved_search_matched events: %s", err)
+	}
+
 	events.SetEventStore(n)
-	defer events.Close()
+
+	cluster := NewCluster(cfg.NodeID, n.Conn(), hub, cfg.PresenceInterval)
+	if err := cluster.Start(); err != nil {
+		log.Fatalf("Failed to join pusher cluster: %s", err)
+	}
 
 	go hub.Run()
 	http.HandleFunc("/ws", hub.HandleWebSocket)
-	log.Println("WebSocket server starting on :8080")
-	err = http.ListenAndServe(":8080", nil)
-	if err != nil {
-		log.Fatalf("Failed to start server: %s", err)
+	http.HandleFunc("/events", hub.HandleEvents)
+	server := &http.Server{Addr: ":8080"}
+	go func() {
+		log.Println("WebSocket server starting on :8080")
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Failed to start server: %s", err)
+		}
+	}()
+
+	var adminServer *http.Server
+	if cfg.AdminToken != "" {
+		admin := http.NewServeMux()
+		admin.HandleFunc("/admin/clients", cluster.HandleClients)
+		admin.HandleFunc("/admin/send", cluster.HandleSend)
+		adminServer = &http.Server{Addr: cfg.AdminAddress, Handler: RequireAdminToken(cfg.AdminToken, admin)}
+		go func() {
+			log.Printf("Admin server starting on %s", cfg.AdminAddress)
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Failed to start admin server: %s", err)
+			}
+		}()
+	} else {
+		log.Println("ADMIN_TOKEN not set, admin endpoints disabled")
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-stop
+	log.Printf("Received %s, shutting down", sig)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// Deja de aceptar conexiones; las peticiones SSE activas terminan al vaciar el Hub
+	serverDone := make(chan error, 1)
+	go func() { serverDone <- server.Shutdown(ctx) }()
+	if adminServer != nil {
+		if err := adminServer.Shutdown(ctx); err != nil {
+			log.Printf("Error shutting down admin server: %s", err)
+		}
+	}
+
+	// Deja de recibir eventos antes de vaciar las colas de los clientes
+	cluster.Stop()
+	if err := events.Close(); err != nil {
+		log.Printf("Error closing event store: %s", err)
+	}
+
+	if err := hub.Shutdown(ctx, cfg.ReconnectHint); err != nil {
+		log.Printf("Error draining clients: %s", err)
+	}
+	if err := <-serverDone; err != nil {
+		log.Printf("Error shutting down HTTP server: %s", err)
 	}
+	log.Println("Pusher service stopped")
 }
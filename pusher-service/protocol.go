@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Command es un mensaje enviado por el cliente a través de /ws
+type Command struct {
+	Type       string   `json:"type"`
+	RequestID  string   `json:"request_id,omitempty"`
+	EventTypes []string `json:"event_types,omitempty"`
+	FeedIDs    []string `json:"feed_ids,omitempty"`
+	Keywords   []string `json:"keywords,omitempty"`
+	LastSeq    *uint64  `json:"last_seq,omitempty"`
+	Stream     string   `json:"stream,omitempty"`
+	Token      string   `json:"token,omitempty"`
+	Seqs       []uint64 `json:"seqs,omitempty"`
+}
+
+const (
+	commandSubscribe   = "subscribe"
+	commandUnsubscribe = "unsubscribe"
+	commandPing        = "ping"
+	commandResume      = "resume"
+	commandAuth        = "auth"
+	commandAck         = "ack"
+)
+
+// Códigos de los errores que cuentan como violaciones del cliente
+const (
+	errorRateLimited    = "rate_limited"
+	errorInvalidCommand = "invalid_command"
+	errorMessageTooBig  = "message_too_big"
+)
+
+// Reply es la respuesta tipada a un Command
+type Reply struct {
+	Type          string        `json:"type"`
+	RequestID     string        `json:"request_id,omitempty"`
+	Error         string        `json:"error,omitempty"`
+	Code          string        `json:"code,omitempty"`
+	Subscriptions *Subscription `json:"subscriptions,omitempty"`
+	LastSeq       uint64        `json:"last_seq,omitempty"`
+	Stream        string        `json:"stream,omitempty"`
+	Replayed      int           `json:"replayed,omitempty"`
+	Timestamp     time.Time     `json:"timestamp"`
+}
+
+func newReply(replyType, requestID string) *Reply {
+	return &Reply{
+		Type:      replyType,
+		RequestID: requestID,
+		Timestamp: time.Now().UTC(),
+	}
+}
+
+func newErrorReply(requestID, message string) *Reply {
+	reply := newReply("error", requestID)
+	reply.Error = message
+	return reply
+}
+
+// Routable lo implementan los mensajes que el Hub filtra según las
+// suscripciones de cada cliente
+type Routable interface {
+	EventType() string
+	FeedID() string
+	Text() string
+}
+
+// Subscription es el conjunto de filtros de un cliente. Un evento se entrega
+// si su tipo está suscrito (o no hay tipos) y, cuando hay feeds o palabras
+// clave, si coincide con alguno de ellos.
+type Subscription struct {
+	EventTypes []string `json:"event_types"`
+	FeedIDs    []string `json:"feed_ids"`
+	Keywords   []string `json:"keywords"`
+}
+
+func (s *Subscription) empty() bool {
+	return len(s.EventTypes) == 0 && len(s.FeedIDs) == 0 && len(s.Keywords) == 0
+}
+
+func (s *Subscription) add(cmd *Command) {
+	s.EventTypes = addUnique(s.EventTypes, cmd.EventTypes)
+	s.FeedIDs = addUnique(s.FeedIDs, cmd.FeedIDs)
+	s.Keywords = addUnique(s.Keywords, lowerAll(cmd.Keywords))
+}
+
+func (s *Subscription) remove(cmd *Command) {
+	s.EventTypes = removeAll(s.EventTypes, cmd.EventTypes)
+	s.FeedIDs = removeAll(s.FeedIDs, cmd.FeedIDs)
+	s.Keywords = removeAll(s.Keywords, lowerAll(cmd.Keywords))
+}
+
+func (s *Subscription) matches(m Routable) bool {
+	if len(s.EventTypes) > 0 && !contains(s.EventTypes, m.EventType()) {
+		return false
+	}
+	if len(s.FeedIDs) == 0 && len(s.Keywords) == 0 {
+		return len(s.EventTypes) > 0
+	}
+	if contains(s.FeedIDs, m.FeedID()) {
+		return true
+	}
+	text := strings.ToLower(m.Text())
+	for _, k := range s.Keywords {
+		if strings.Contains(text, k) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Subscription) clone() *Subscription {
+	return &Subscription{
+		EventTypes: append([]string{}, s.EventTypes...),
+		FeedIDs:    append([]string{}, s.FeedIDs...),
+		Keywords:   append([]string{}, s.Keywords...),
+	}
+}
+
+func contains(values []string, v string) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func addUnique(values, add []string) []string {
+	for _, v := range add {
+		if v = strings.TrimSpace(v); v != "" && !contains(values, v) {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func removeAll(values, remove []string) []string {
+	kept := values[:0]
+	for _, v := range values {
+		if !contains(remove, v) {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+func lowerAll(values []string) []string {
+	lowered := make([]string, len(values))
+	for i, v := range values {
+		lowered[i] = strings.ToLower(strings.TrimSpace(v))
+	}
+	return lowered
+}
+
+func parseCommand(data []byte) (*Command, error) {
+	cmd := &Command{}
+	if err := json.Unmarshal(data, cmd); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+// routable es un mensaje de prueba para los filtros de Subscription
+type routable struct {
+	eventType, feedID, text string
+}
+
+func (m routable) EventType() string { return m.eventType }
+func (m routable) FeedID() string    { return m.feedID }
+func (m routable) Text() string      { return m.text }
+
+func TestSubscriptionMatches(t *testing.T) {
+	created := routable{eventType: "created_feed", feedID: "feed-1", text: "Go 1.22 released"}
+	tests := []struct {
+		name string
+		sub  Subscription
+		m    routable
+		want bool
+	}{
+		{"empty", Subscription{}, created, false},
+		{"event type", Subscription{EventTypes: []string{"created_feed"}}, created, true},
+		{"other event type", Subscription{EventTypes: []string{"deleted_feed"}}, created, false},
+		{"feed id", Subscription{FeedIDs: []string{"feed-1"}}, created, true},
+		{"other feed id", Subscription{FeedIDs: []string{"feed-2"}}, created, false},
+		{"keyword ignores case", Subscription{Keywords: []string{"released"}}, routable{eventType: "created_feed", text: "GO RELEASED"}, true},
+		{"keyword missing", Subscription{Keywords: []string{"rust"}}, created, false},
+		{"feed id or keyword", Subscription{FeedIDs: []string{"feed-2"}, Keywords: []string{"go"}}, created, true},
+		{"event type and feed id", Subscription{EventTypes: []string{"created_feed"}, FeedIDs: []string{"feed-1"}}, created, true},
+		{"event type filters feed id", Subscription{EventTypes: []string{"deleted_feed"}, FeedIDs: []string{"feed-1"}}, created, false},
+		{"event type filters keyword", Subscription{EventTypes: []string{"deleted_feed"}, Keywords: []string{"go"}}, created, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.sub.matches(tt.m); got != tt.want {
+				t.Errorf("matches(%+v) = %v, want %v", tt.m, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubscriptionAddRemove(t *testing.T) {
+	var sub Subscription
+	sub.add(&Command{EventTypes: []string{"created_feed", " "}, Keywords: []string{" Go ", "go"}})
+	if len(sub.EventTypes) != 1 || len(sub.Keywords) != 1 || sub.Keywords[0] != "go" {
+		t.Fatalf("after add = %+v, want one event type and keyword go", sub)
+	}
+	sub.remove(&Command{Keywords: []string{"GO"}})
+	if len(sub.Keywords) != 0 || len(sub.EventTypes) != 1 {
+		t.Errorf("after remove = %+v, want only the event type", sub)
+	}
+}
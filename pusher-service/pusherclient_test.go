@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"platzi.com/go/cqrs/auth"
+	"platzi.com/go/cqrs/events"
+	"platzi.com/go/cqrs/models"
+	"platzi.com/go/cqrs/pusherclient"
+)
+
+// Estas pruebas ejercitan pusherclient contra un Hub real, ya que el paquete
+// main no se puede importar desde pusherclient
+
+// waitFor espera a que cond se cumpla
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// connectedClients devuelve los clientes conectados al Hub
+func connectedClients(hub *Hub) []*Client {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	return append([]*Client{}, hub.clients...)
+}
+
+// serverClient espera a que haya un único cliente conectado y lo devuelve
+func serverClient(t *testing.T, hub *Hub) *Client {
+	t.Helper()
+	var clients []*Client
+	waitFor(t, "one connected client", func() bool {
+		clients = connectedClients(hub)
+		return len(clients) == 1
+	})
+	return clients[0]
+}
+
+func broadcastCreated(hub *Hub, id string) {
+	hub.Broadcast(newCreatedFeedMessage(events.CreatedFeedMessage{
+		ID:        id,
+		Title:     "feed " + id,
+		Status:    models.FeedStatusPublished,
+		CreatedAt: time.Now().UTC(),
+	}), nil)
+}
+
+func broadcastDeleted(hub *Hub, id string) {
+	hub.Broadcast(newDeletedFeedMessage(events.DeletedFeedMessage{
+		ID:        id,
+		Title:     "feed " + id,
+		Status:    models.FeedStatusPublished,
+		DeletedAt: time.Now().UTC(),
+	}), nil)
+}
+
+func nextEvent(t *testing.T, client *pusherclient.Client) pusherclient.Event {
+	t.Helper()
+	select {
+	case event, ok := <-client.Events():
+		if !ok {
+			t.Fatal("events channel closed")
+		}
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return nil
+}
+
+func expectCreated(t *testing.T, client *pusherclient.Client, id string, seq uint64) {
+	t.Helper()
+	event := nextEvent(t, client)
+	created, ok := event.(*pusherclient.CreatedFeedMessage)
+	if !ok || created.ID != id || created.Seq != seq {
+		t.Fatalf("event = %#v, want created_feed %s with seq %d", event, id, seq)
+	}
+}
+
+func expectNoEvent(t *testing.T, client *pusherclient.Client) {
+	t.Helper()
+	select {
+	case event := <-client.Events():
+		t.Fatalf("unexpected event %#v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func dialClient(t *testing.T, url string, options pusherclient.Options) *pusherclient.Client {
+	t.Helper()
+	if options.Token == "" {
+		options.Token = testToken(t, auth.Claims{Subject: "user-1"})
+	}
+	if options.MinBackoff == 0 {
+		options.MinBackoff = 20 * time.Millisecond
+		options.MaxBackoff = 100 * time.Millisecond
+	}
+	client, err := pusherclient.Dial(context.Background(), url, options)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// switchDialer conecta con la dirección de target en lugar de la de la URL y
+// puede retener las conexiones nuevas, para controlar cuándo se reconecta el cliente
+type switchDialer struct {
+	mutex  sync.Mutex
+	target string
+	hold   chan struct{}
+}
+
+func (d *switchDialer) setTarget(server string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.target = strings.TrimPrefix(server, "http://")
+}
+
+// block retiene las conexiones hasta que se llame a la función devuelta
+func (d *switchDialer) block() (release func()) {
+	hold := make(chan struct{})
+	d.mutex.Lock()
+	d.hold = hold
+	d.mutex.Unlock()
+	return func() { close(hold) }
+}
+
+func (d *switchDialer) dialer() *websocket.Dialer {
+	return &websocket.Dialer{
+		HandshakeTimeout: time.Second,
+		NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			d.mutex.Lock()
+			target, hold := d.target, d.hold
+			d.mutex.Unlock()
+			if hold != nil {
+				select {
+				case <-hold:
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			}
+			if target != "" {
+				addr = target
+			}
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}
+}
+
+func TestPusherClientUnauthorized(t *testing.T) {
+	_, server := startTestHub(t)
+
+	for name, token := range map[string]string{
+		"InvalidToken": "not-a-token",
+		"ExpiredToken": testToken(t, auth.Claims{Subject: "user-1", ExpiresAt: time.Now().Add(-time.Minute).Unix()}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			client, err := pusherclient.Dial(context.Background(), wsURL(server, ""), pusherclient.Options{Token: token})
+			if !errors.Is(err, pusherclient.ErrUnauthorized) {
+				if client != nil {
+					client.Close()
+				}
+				t.Fatalf("Dial = %v, want ErrUnauthorized", err)
+			}
+		})
+	}
+
+	t.Run("ExpiresWhileConnected", func(t *testing.T) {
+		token := testToken(t, auth.Claims{Subject: "user-1", ExpiresAt: time.Now().Add(1100 * time.Millisecond).Unix()})
+		client := dialClient(t, wsURL(server, ""), pusherclient.Options{Token: token})
+		select {
+		case err := <-client.Err():
+			if !errors.Is(err, pusherclient.ErrUnauthorized) {
+				t.Fatalf("Err = %v, want ErrUnauthorized", err)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatal("timed out waiting for the token to expire")
+		}
+		if _, ok := <-client.Events(); ok {
+			t.Fatal("events channel still open after ErrUnauthorized")
+		}
+	})
+}
+
+func TestPusherClientSubscribe(t *testing.T) {
+	hub, server := startTestHub(t)
+	client := dialClient(t, wsURL(server, ""), pusherclient.Options{
+		Subscription: pusherclient.Subscription{EventTypes: []string{"created_feed"}},
+	})
+	sc := serverClient(t, hub)
+
+	broadcastDeleted(hub, "deleted-1")
+	broadcastCreated(hub, "created-1")
+	expectCreated(t, client, "created-1", 2)
+
+	if err := client.Subscribe(pusherclient.Subscription{EventTypes: []string{"deleted_feed"}}); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	waitFor(t, "the subscription", func() bool {
+		sc.mutex.Lock()
+		defer sc.mutex.Unlock()
+		return contains(sc.subscription.EventTypes, "deleted_feed")
+	})
+	broadcastDeleted(hub, "deleted-2")
+	if event, ok := nextEvent(t, client).(*pusherclient.DeletedFeedMessage); !ok || event.ID != "deleted-2" {
+		t.Fatalf("event = %#v, want deleted_feed deleted-2", event)
+	}
+
+	if err := client.Unsubscribe(pusherclient.Subscription{EventTypes: []string{"created_feed"}}); err != nil {
+		t.Fatalf("Unsubscribe: %v", err)
+	}
+	waitFor(t, "the unsubscription", func() bool {
+		sc.mutex.Lock()
+		defer sc.mutex.Unlock()
+		return !contains(sc.subscription.EventTypes, "created_feed")
+	})
+	broadcastCreated(hub, "created-2")
+	expectNoEvent(t, client)
+
+	// La suscripción se conserva al reconectarse
+	sc.disconnect()
+	waitFor(t, "the reconnection", func() bool {
+		clients := connectedClients(hub)
+		return len(clients) == 1 && clients[0] != sc
+	})
+	broadcastCreated(hub, "created-3")
+	broadcastDeleted(hub, "deleted-3")
+	if event, ok := nextEvent(t, client).(*pusherclient.DeletedFeedMessage); !ok || event.ID != "deleted-3" {
+		t.Fatalf("event = %#v, want deleted_feed deleted-3", event)
+	}
+}
+
+func TestPusherClientReconnectReplay(t *testing.T) {
+	hub, server := startTestHub(t)
+	d := &switchDialer{}
+	client := dialClient(t, wsURL(server, ""), pusherclient.Options{Dialer: d.dialer()})
+	sc := serverClient(t, hub)
+
+	broadcastCreated(hub, "feed-1")
+	expectCreated(t, client, "feed-1", 1)
+
+	// Los eventos publicados mientras el cliente está desconectado se
+	// reenvían al reconectarse con last_seq
+	release := d.block()
+	sc.disconnect()
+	waitFor(t, "the disconnection", func() bool { return len(connectedClients(hub)) == 0 })
+	broadcastCreated(hub, "feed-2")
+	broadcastCreated(hub, "feed-3")
+	release()
+
+	expectCreated(t, client, "feed-2", 2)
+	expectCreated(t, client, "feed-3", 3)
+	broadcastCreated(hub, "feed-4")
+	expectCreated(t, client, "feed-4", 4)
+}
+
+func TestPusherClientResyncRequired(t *testing.T) {
+	first, firstServer := startTestHub(t)
+	second, secondServer := startTestHub(t)
+	d := &switchDialer{}
+	client := dialClient(t, wsURL(firstServer, ""), pusherclient.Options{Dialer: d.dialer()})
+
+	broadcastCreated(first, "feed-1")
+	broadcastCreated(first, "feed-2")
+	expectCreated(t, client, "feed-1", 1)
+	expectCreated(t, client, "feed-2", 2)
+
+	// Otra instancia no conoce el stream de la primera
+	d.setTarget(secondServer.URL)
+	serverClient(t, first).disconnect()
+	event := nextEvent(t, client)
+	if resync, ok := event.(*pusherclient.ResyncRequired); !ok || resync.LastSeq != 0 {
+		t.Fatalf("event = %#v, want resync_required with last_seq 0", event)
+	}
+
+	// La secuencia sigue la de la nueva instancia, así que su seq 1 no es un duplicado
+	serverClient(t, second)
+	broadcastCreated(second, "feed-3")
+	expectCreated(t, client, "feed-3", 1)
+}
+
+func TestPusherClientDedupAndAck(t *testing.T) {
+	hub, server := startTestHub(t)
+	client := dialClient(t, wsURL(server, ""), pusherclient.Options{Ack: true})
+	sc := serverClient(t, hub)
+
+	broadcastCreated(hub, "feed-1")
+	broadcastCreated(hub, "feed-2")
+	expectCreated(t, client, "feed-1", 1)
+	expectCreated(t, client, "feed-2", 2)
+	waitFor(t, "the acks", func() bool {
+		stats := sc.stats()
+		return stats.Acked >= 2 && stats.Pending == 0
+	})
+
+	// Reenviar lo ya visto no llega al consumidor, pero se vuelve a confirmar
+	hub.Resume(sc, hub.replay.stream, 0, "")
+	broadcastCreated(hub, "feed-3")
+	expectCreated(t, client, "feed-3", 3)
+	expectNoEvent(t, client)
+	waitFor(t, "the acks of the duplicates", func() bool {
+		stats := sc.stats()
+		return stats.Acked >= 5 && stats.Pending == 0
+	})
+	if stats := sc.stats(); stats.Failed != 0 {
+		t.Errorf("stats = %+v, want no failed deliveries", stats)
+	}
+}
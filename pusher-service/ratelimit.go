@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io"
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// InputLimits acota los mensajes que un cliente puede enviar por /ws
+type InputLimits struct {
+	// MaxMessageSize es el tamaño máximo de un mensaje. Los mayores se
+	// descartan y cuentan como violación; los que superan
+	// frameLimitFactor veces el tamaño cierran la conexión con 1009
+	// (message too big) sin leerlos.
+	MaxMessageSize int64
+	// Rate es el número de mensajes por segundo y Burst los que se aceptan
+	// de golpe antes de aplicar Rate
+	Rate  float64
+	Burst int
+	// MaxViolations es el número de mensajes rechazados tras el cual se
+	// cierra la conexión con 1008 (policy violation)
+	MaxViolations int
+}
+
+// frameLimitFactor es cuántas veces MaxMessageSize se lee de un mensaje
+// demasiado grande antes de cerrar la conexión
+const frameLimitFactor = 16
+
+// maxLoggedMessage es cuántos bytes de cada mensaje recibido se escriben en el log
+const maxLoggedMessage = 256
+
+// frameLimit es el límite de lectura del socket
+func (l InputLimits) frameLimit() int64 {
+	return l.MaxMessageSize * frameLimitFactor
+}
+
+// readMessage lee el siguiente mensaje sin guardar más de MaxMessageSize
+// bytes. Si el mensaje es mayor descarta el resto y devuelve tooBig.
+func (c *Client) readMessage() (message []byte, tooBig bool, err error) {
+	_, r, err := c.socket.NextReader()
+	if err != nil {
+		return nil, false, err
+	}
+	limit := c.hub.clientOptions.Limits.MaxMessageSize
+	message, err = io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(message)) <= limit {
+		return message, false, nil
+	}
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return nil, false, err
+	}
+	return nil, true, nil
+}
+
+func truncateForLog(message []byte) string {
+	if len(message) <= maxLoggedMessage {
+		return string(message)
+	}
+	return string(message[:maxLoggedMessage]) + "..."
+}
+
+// tokenBucket limita los mensajes entrantes de un cliente. Solo lo usa la
+// goroutine Read, así que no necesita mutex.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// allow consume un token si hay alguno disponible en el instante now
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// violation registra un mensaje rechazado y responde con un error con el
+// código indicado. Al llegar a MaxViolations se cierra la conexión con 1008
+// después de enviar las respuestas pendientes.
+func (c *Client) violation(requestID, code, message string) {
+	c.violations++
+	reply := newErrorReply(requestID, message)
+	reply.Code = code
+	c.send(reply)
+	if c.violations >= c.hub.clientOptions.Limits.MaxViolations {
+		log.Printf("Client %s reached %d violations, disconnecting", c.id, c.violations)
+		c.closeAfterDrain(websocket.ClosePolicyViolation, "too many rejected messages")
+	}
+}
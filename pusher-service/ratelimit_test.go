@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucketAllow(t *testing.T) {
+	tests := []struct {
+		name  string
+		rate  float64
+		burst int
+		// at son los instantes de cada mensaje desde que se crea el bucket
+		at   []time.Duration
+		want []bool
+	}{
+		{"burst", 1, 3, []time.Duration{0, 0, 0, 0}, []bool{true, true, true, false}},
+		{"refills at rate", 2, 1, []time.Duration{0, 0, 250 * time.Millisecond, 500 * time.Millisecond}, []bool{true, false, false, true}},
+		{"refill capped at burst", 10, 2, []time.Duration{time.Minute, time.Minute, time.Minute}, []bool{true, true, false}},
+		{"zero burst", 100, 0, []time.Duration{0, time.Second}, []bool{false, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTokenBucket(tt.rate, tt.burst)
+			start := b.last
+			for i, d := range tt.at {
+				if got := b.allow(start.Add(d)); got != tt.want[i] {
+					t.Errorf("allow at %v (message %d) = %v, want %v", d, i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTruncateForLog(t *testing.T) {
+	short := []byte("hello")
+	if got := truncateForLog(short); got != "hello" {
+		t.Errorf("truncateForLog(%q) = %q", short, got)
+	}
+	long := make([]byte, maxLoggedMessage+10)
+	for i := range long {
+		long[i] = 'a'
+	}
+	if got := truncateForLog(long); len(got) != maxLoggedMessage+len("...") {
+		t.Errorf("truncateForLog returned %d bytes, want %d", len(got), maxLoggedMessage+len("..."))
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+// Sequenced lo implementan los mensajes que el Hub numera y guarda para
+// poder reenviarlos a los clientes que se reconectan
+type Sequenced interface {
+	SetSeq(seq uint64)
+}
+
+// replayEntry es un mensaje ya serializado junto con los datos necesarios
+// para decidir a qué clientes reenviarlo
+type replayEntry struct {
+	seq      uint64
+	at       time.Time
+	data     []byte
+	routable Routable
+	// userID restringe el mensaje a los clientes de ese usuario
+	userID string
+}
+
+// ReplayBuffer guarda en memoria los últimos mensajes enviados, limitado por
+// cantidad y antigüedad. No es seguro para uso concurrente: el Hub lo protege
+// con su mutex.
+//
+// Cada instancia numera sus mensajes desde 1 cada vez que arranca, así que un
+// seq solo tiene sentido junto con el stream que lo generó. Un cliente que se
+// reconecta a otra instancia, o a la misma tras reiniciarse, trae otro stream
+// y recibe resync_required en lugar de mensajes que no son los que se perdió.
+type ReplayBuffer struct {
+	stream  string
+	entries []replayEntry
+	start   int
+	size    int
+	maxAge  time.Duration
+	lastSeq uint64
+}
+
+func NewReplayBuffer(stream string, capacity int, maxAge time.Duration) *ReplayBuffer {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &ReplayBuffer{
+		stream:  stream,
+		entries: make([]replayEntry, capacity),
+		maxAge:  maxAge,
+	}
+}
+
+// NewStreamID identifica la secuencia de nodeID en este arranque
+func NewStreamID(nodeID string) string {
+	return nodeID + "." + strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// next asigna el siguiente número de secuencia
+func (b *ReplayBuffer) next() uint64 {
+	b.lastSeq++
+	return b.lastSeq
+}
+
+// add guarda la entrada, descartando la más antigua si el buffer está lleno
+func (b *ReplayBuffer) add(entry replayEntry) {
+	if b.size < len(b.entries) {
+		b.entries[(b.start+b.size)%len(b.entries)] = entry
+		b.size++
+		return
+	}
+	b.entries[b.start] = entry
+	b.start = (b.start + 1) % len(b.entries)
+}
+
+// expire descarta las entradas más antiguas que maxAge
+func (b *ReplayBuffer) expire(now time.Time) {
+	if b.maxAge <= 0 {
+		return
+	}
+	for b.size > 0 && now.Sub(b.entries[b.start].at) > b.maxAge {
+		b.entries[b.start] = replayEntry{}
+		b.start = (b.start + 1) % len(b.entries)
+		b.size--
+	}
+}
+
+// since devuelve las entradas de stream posteriores a lastSeq. ok es false
+// cuando ya no se pueden reconstruir todas, o lastSeq es de otro stream, y el
+// cliente debe resincronizarse.
+func (b *ReplayBuffer) since(stream string, lastSeq uint64) (entries []replayEntry, ok bool) {
+	b.expire(time.Now())
+	if stream != b.stream || lastSeq > b.lastSeq {
+		return nil, false
+	}
+	if lastSeq == b.lastSeq {
+		return nil, true
+	}
+	if b.size == 0 || b.entries[b.start].seq > lastSeq+1 {
+		return nil, false
+	}
+	for i := 0; i < b.size; i++ {
+		entry := b.entries[(b.start+i)%len(b.entries)]
+		if entry.seq > lastSeq {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, true
+}
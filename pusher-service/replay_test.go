@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// fillReplay agrega n mensajes numerados al buffer
+func fillReplay(b *ReplayBuffer, n int, at time.Time) {
+	for i := 0; i < n; i++ {
+		b.add(replayEntry{seq: b.next(), at: at})
+	}
+}
+
+func TestReplayBufferSince(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		capacity int
+		added    int
+		at       time.Time
+		stream   string
+		lastSeq  uint64
+		want     []uint64
+		ok       bool
+	}{
+		{"up to date", 5, 3, now, "s1", 3, nil, true},
+		{"missed some", 5, 3, now, "s1", 1, []uint64{2, 3}, true},
+		{"missed all", 5, 3, now, "s1", 0, []uint64{1, 2, 3}, true},
+		{"oldest still kept", 3, 5, now, "s1", 2, []uint64{3, 4, 5}, true},
+		{"oldest dropped", 3, 5, now, "s1", 1, nil, false},
+		{"ahead of stream", 5, 3, now, "s1", 4, nil, false},
+		{"other stream", 5, 3, now, "s2", 1, nil, false},
+		{"expired", 5, 3, now.Add(-2 * time.Minute), "s1", 1, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewReplayBuffer("s1", tt.capacity, time.Minute)
+			fillReplay(b, tt.added, tt.at)
+			entries, ok := b.since(tt.stream, tt.lastSeq)
+			if ok != tt.ok {
+				t.Fatalf("since ok = %v, want %v", ok, tt.ok)
+			}
+			if len(entries) != len(tt.want) {
+				t.Fatalf("since returned %d entries, want %v", len(entries), tt.want)
+			}
+			for i, entry := range entries {
+				if entry.seq != tt.want[i] {
+					t.Errorf("entry %d seq = %d, want %d", i, entry.seq, tt.want[i])
+				}
+			}
+		})
+	}
+}
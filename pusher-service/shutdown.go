@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// GoingAwayMessage avisa al cliente de que el servidor se apaga y cuándo
+// conviene reconectarse
+type GoingAwayMessage struct {
+	Type             string `json:"type"`
+	Message          string `json:"message"`
+	ReconnectAfterMs int64  `json:"reconnect_after_ms"`
+}
+
+// reconnectHint reparte las reconexiones entre hint y 2*hint para que no
+// lleguen todas a la vez a las demás instancias
+func reconnectHint(hint time.Duration) time.Duration {
+	if hint <= 0 {
+		return 0
+	}
+	return hint + time.Duration(rand.Int63n(int64(hint)))
+}
+
+// goAway envía el aviso de cierre y cierra la conexión con 1001 (going away)
+// después de vaciar la cola
+func (c *Client) goAway(hint time.Duration) {
+	after := reconnectHint(hint)
+	c.send(&GoingAwayMessage{
+		Type:             "going_away",
+		Message:          "Server shutting down",
+		ReconnectAfterMs: after.Milliseconds(),
+	})
+	c.closeAfterDrain(websocket.CloseGoingAway, fmt.Sprintf("server shutting down, reconnect in %dms", after.Milliseconds()))
+}
+
+// closeAfterDrain pide a la goroutine de escritura que vacíe la cola y cierre
+// la conexión con code. Solo cuenta la primera llamada.
+func (c *Client) closeAfterDrain(code int, reason string) {
+	c.drainOnce.Do(func() {
+		c.closeCode = code
+		c.closeReason = reason
+		close(c.draining)
+	})
+}
+
+// flush escribe los mensajes que quedan en la cola sin esperar nuevos
+func (c *Client) flush() error {
+	for {
+		select {
+		case message := <-c.outbound:
+			c.socket.SetWriteDeadline(time.Now().Add(c.hub.clientOptions.WriteTimeout))
+			if err := c.socket.WriteMessage(websocket.TextMessage, message); err != nil {
+				return err
+			}
+			atomic.AddUint64(&c.delivered, 1)
+		default:
+			return nil
+		}
+	}
+}
+
+// closeDrained vacía la cola y cierra el socket con el código pedido
+func (c *Client) closeDrained() {
+	if err := c.flush(); err != nil {
+		log.Printf("Error flushing messages to client %s: %v", c.id, err)
+	}
+	c.socket.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(c.closeCode, c.closeReason), time.Now().Add(time.Second))
+	c.socket.Close()
+}
+
+// Shutdown deja de aceptar clientes, les pide que se reconecten a otra
+// instancia y espera a que se desconecten. Si ctx vence antes, cierra las
+// conexiones que queden. Al terminar detiene la goroutine de Run.
+func (h *Hub) Shutdown(ctx context.Context, reconnectAfter time.Duration) error {
+	h.mutex.Lock()
+	h.shuttingDown = true
+	clients := append([]*Client{}, h.clients...)
+	h.mutex.Unlock()
+
+	log.Printf("Draining %d clients", len(clients))
+	for _, client := range clients {
+		client.goAway(reconnectAfter)
+	}
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	var err error
+wait:
+	for {
+		h.mutex.Lock()
+		remaining := len(h.clients)
+		h.mutex.Unlock()
+		if remaining == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			err = fmt.Errorf("%d clients still connected: %w", remaining, ctx.Err())
+			h.mutex.Lock()
+			for _, client := range h.clients {
+				client.disconnect()
+				if client.socket != nil {
+					client.socket.Close()
+				}
+			}
+			h.mutex.Unlock()
+			break wait
+		case <-ticker.C:
+		}
+	}
+
+	close(h.quit)
+	return err
+}
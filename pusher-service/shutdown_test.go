@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"platzi.com/go/cqrs/auth"
+)
+
+func TestReconnectHint(t *testing.T) {
+	tests := []struct {
+		hint     time.Duration
+		min, max time.Duration
+	}{
+		{0, 0, 0},
+		{-time.Second, 0, 0},
+		{time.Second, time.Second, 2 * time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if got := reconnectHint(tt.hint); got < tt.min || got > tt.max {
+				t.Fatalf("reconnectHint(%v) = %v, want between %v and %v", tt.hint, got, tt.min, tt.max)
+			}
+		}
+	}
+}
+
+func TestShutdownDrainsClients(t *testing.T) {
+	// El Hub no usa startTestHub porque la prueba ya lo apaga
+	hub := NewHub(NewReplayBuffer(NewStreamID("test"), 100, time.Minute), ClientOptions{
+		QueueSize:    16,
+		Policy:       PolicyDropOldest,
+		WriteTimeout: time.Second,
+		Limits:       InputLimits{MaxMessageSize: 1024, Rate: 100, Burst: 100, MaxViolations: 5},
+	}, NewAuthenticator(testSecret, nil, time.Second))
+	go hub.Run()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", hub.HandleWebSocket)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	token := testToken(t, auth.Claims{Subject: "user-1", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	socket := dial(t, wsURL(server, ""), bearer(token))
+	expectWelcome(t, socket, "user-1")
+	serverClient(t, hub)
+	broadcastCreated(hub, "feed-1")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- hub.Shutdown(ctx, time.Second) }()
+
+	// El evento encolado se entrega antes del aviso y del cierre
+	var types []string
+	socket.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for len(types) < 2 {
+		var message struct {
+			Type             string `json:"type"`
+			ReconnectAfterMs int64  `json:"reconnect_after_ms"`
+		}
+		if err := socket.ReadJSON(&message); err != nil {
+			t.Fatalf("reading message %d: %v", len(types), err)
+		}
+		if message.Type == "going_away" && (message.ReconnectAfterMs < 1000 || message.ReconnectAfterMs > 2000) {
+			t.Errorf("reconnect_after_ms = %d, want between 1000 and 2000", message.ReconnectAfterMs)
+		}
+		types = append(types, message.Type)
+	}
+	if types[0] != "created_feed" || types[1] != "going_away" {
+		t.Errorf("messages = %v, want created_feed then going_away", types)
+	}
+	expectClose(t, socket, websocket.CloseGoingAway)
+
+	if err := <-done; err != nil {
+		t.Errorf("Shutdown = %v", err)
+	}
+	if clients := connectedClients(hub); len(clients) != 0 {
+		t.Errorf("%d clients still connected after shutdown", len(clients))
+	}
+}
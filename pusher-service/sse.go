@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// sseHeartbeat es el intervalo de los comentarios que mantienen viva la
+// conexión a través de proxies
+const sseHeartbeat = 15 * time.Second
+
+// HandleEvents expone los mismos mensajes que /ws como text/event-stream.
+// Los filtros se pasan como parámetros (event_types, feed_ids, keywords,
+// separados por comas) y la reanudación usa la cabecera Last-Event-ID, con
+// el formato <stream>:<seq> de los id de los eventos. El
+// token va en la cabecera Authorization o en el parámetro access_token, y el
+// origen se comprueba como en /ws.
+func (h *Hub) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	if !h.auth.CheckOrigin(r) {
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return
+	}
+	claims, err := h.auth.Verify(tokenFromRequest(r))
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	client := NewClient(h, nil, uuid.New().String())
+	client.remoteAddr = r.RemoteAddr
+	client.userID = claims.Subject
+	client.expireAt(claims.Expiry())
+
+	client.subscribeFromQuery(r)
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	if lastEventID != "" {
+		stream, seq, err := parseEventID(lastEventID)
+		if err != nil {
+			http.Error(w, "Last-Event-ID must be <stream>:<seq>", http.StatusBadRequest)
+			return
+		}
+		client.resumeFrom = &seq
+		client.resumeStream = stream
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	if !h.registerClient(client) {
+		return
+	}
+	defer client.drain()
+
+	ticker := time.NewTicker(sseHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-client.closed:
+			return
+		case <-client.done:
+			return
+		case <-client.draining:
+			// El aviso going_away ya está en la cola
+			for {
+				select {
+				case message := <-client.outbound:
+					if err := writeSSE(w, h.replay.stream, message); err != nil {
+						return
+					}
+					atomic.AddUint64(&client.delivered, 1)
+				default:
+					flusher.Flush()
+					return
+				}
+			}
+		case message := <-client.outbound:
+			if err := writeSSE(w, h.replay.stream, message); err != nil {
+				log.Printf("Error writing event to client %s: %v", client.id, err)
+				return
+			}
+			flusher.Flush()
+			atomic.AddUint64(&client.delivered, 1)
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// drain da de baja al cliente y descarta los mensajes pendientes hasta que el
+// Hub confirma la baja, para no bloquear un Broadcast en curso
+func (c *Client) drain() {
+	go c.hub.unregisterClient(c)
+	for {
+		select {
+		case <-c.outbound:
+		case <-c.closed:
+			return
+		case <-c.hub.quit:
+			return
+		}
+	}
+}
+
+// parseEventID separa un Last-Event-ID en stream y seq. Un seq sin stream,
+// de versiones anteriores, se acepta y produce resync_required.
+func parseEventID(id string) (string, uint64, error) {
+	stream := ""
+	if i := strings.LastIndex(id, ":"); i >= 0 {
+		stream, id = id[:i], id[i+1:]
+	}
+	seq, err := strconv.ParseUint(id, 10, 64)
+	return stream, seq, err
+}
+
+// writeSSE escribe un mensaje JSON como evento, usando su stream y seq como id
+func writeSSE(w http.ResponseWriter, stream string, message []byte) error {
+	var meta struct {
+		Seq  uint64 `json:"seq"`
+		Type string `json:"type"`
+	}
+	json.Unmarshal(message, &meta)
+
+	var b strings.Builder
+	if meta.Seq > 0 {
+		fmt.Fprintf(&b, "id: %s:%d\n", stream, meta.Seq)
+	}
+	if meta.Type != "" {
+		fmt.Fprintf(&b, "event: %s\n", meta.Type)
+	}
+	fmt.Fprintf(&b, "data: %s\n\n", message)
+	_, err := fmt.Fprint(w, b.String())
+	return err
+}
+
+// subscribeFromQuery aplica los filtros event_types, feed_ids y keywords de
+// la petición, para que también se usen al reenviar los eventos perdidos
+func (c *Client) subscribeFromQuery(r *http.Request) {
+	cmd := &Command{
+		EventTypes: splitParam(r, "event_types"),
+		FeedIDs:    splitParam(r, "feed_ids"),
+		Keywords:   splitParam(r, "keywords"),
+	}
+	if len(cmd.EventTypes) > 0 || len(cmd.FeedIDs) > 0 || len(cmd.Keywords) > 0 {
+		c.subscribed = true
+		c.subscription.add(cmd)
+	}
+}
+
+func splitParam(r *http.Request, name string) []string {
+	var values []string
+	for _, v := range r.URL.Query()[name] {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				values = append(values, part)
+			}
+		}
+	}
+	return values
+}
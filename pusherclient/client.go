@@ -0,0 +1,433 @@
+// Package pusherclient es un cliente Go para el protocolo WebSocket de
+// pusher-service: se autentica, se suscribe, se reconecta con backoff pidiendo
+// los eventos perdidos y entrega los eventos tipados por un canal.
+package pusherclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Códigos de cierre con los que pusher-service rechaza la autenticación
+const (
+	closeInvalidToken = 4001
+	closeTokenExpired = 4002
+	closeAuthRequired = 4003
+)
+
+// ErrUnauthorized se devuelve cuando el servidor rechaza el token; no tiene
+// sentido reintentar con el mismo token
+var ErrUnauthorized = errors.New("pusherclient: unauthorized")
+
+type Options struct {
+	// Token es el JWT con el que se autentica la conexión
+	Token string
+	// Subscription filtra los eventos; vacía recibe todos
+	Subscription Subscription
+	// Ack activa la entrega al menos una vez: cada evento se confirma al
+	// entregarlo por el canal
+	Ack bool
+	// MinBackoff y MaxBackoff acotan la espera entre reconexiones
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// BufferSize es la capacidad del canal de eventos
+	BufferSize int
+	Dialer     *websocket.Dialer
+}
+
+// Client mantiene una conexión con pusher-service. Los eventos duplicados por
+// reenvíos se descartan por su seq.
+//
+// La secuencia es propia de cada instancia de pusher-service y de cada
+// arranque (su stream): si al reconectarse se llega a otra instancia, el
+// servidor responde resync_required y el cliente sigue con la secuencia nueva.
+type Client struct {
+	url     string
+	options Options
+	events  chan Event
+	errs    chan error
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mutex   sync.Mutex
+	conn    *websocket.Conn
+	lastSeq uint64
+	stream  string
+	resume  bool
+}
+
+// Dial conecta con url (por ejemplo ws://localhost:8080/ws) y mantiene la
+// conexión hasta Close. Devuelve error si el primer intento falla.
+func Dial(ctx context.Context, rawURL string, options Options) (*Client, error) {
+	if options.MinBackoff <= 0 {
+		options.MinBackoff = 500 * time.Millisecond
+	}
+	if options.MaxBackoff < options.MinBackoff {
+		options.MaxBackoff = 30 * time.Second
+	}
+	if options.BufferSize <= 0 {
+		options.BufferSize = 64
+	}
+	if options.Dialer == nil {
+		options.Dialer = websocket.DefaultDialer
+	}
+
+	c := &Client{
+		url:     rawURL,
+		options: options,
+		events:  make(chan Event, options.BufferSize),
+		errs:    make(chan error, 1),
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
+	conn, err := c.connect(ctx)
+	if err != nil {
+		c.cancel()
+		return nil, err
+	}
+	c.wg.Add(1)
+	go c.run(conn)
+	return c, nil
+}
+
+// Events entrega los eventos recibidos. Se cierra al llamar a Close o cuando
+// el servidor rechaza el token.
+func (c *Client) Events() <-chan Event {
+	return c.events
+}
+
+// Err devuelve el motivo por el que se cerró el canal de eventos, si no fue Close
+func (c *Client) Err() <-chan error {
+	return c.errs
+}
+
+// Close cierra la conexión y el canal de eventos
+func (c *Client) Close() error {
+	c.cancel()
+	c.mutex.Lock()
+	if c.conn != nil {
+		c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		c.conn.Close()
+	}
+	c.mutex.Unlock()
+	c.wg.Wait()
+	return nil
+}
+
+// Subscribe añade filtros a la suscripción actual y la recuerda para las reconexiones
+func (c *Client) Subscribe(s Subscription) error {
+	c.mutex.Lock()
+	c.options.Subscription.EventTypes = append(c.options.Subscription.EventTypes, s.EventTypes...)
+	c.options.Subscription.FeedIDs = append(c.options.Subscription.FeedIDs, s.FeedIDs...)
+	c.options.Subscription.Keywords = append(c.options.Subscription.Keywords, s.Keywords...)
+	c.mutex.Unlock()
+	return c.write(command{Type: "subscribe", EventTypes: s.EventTypes, FeedIDs: s.FeedIDs, Keywords: s.Keywords})
+}
+
+// Unsubscribe quita filtros de la suscripción actual (todos si s está vacía)
+// y la recuerda para las reconexiones. Sin filtros el servidor no entrega
+// eventos hasta el siguiente Subscribe, salvo tras reconectarse, que vuelve a
+// recibirlos todos.
+func (c *Client) Unsubscribe(s Subscription) error {
+	c.mutex.Lock()
+	if len(s.EventTypes) == 0 && len(s.FeedIDs) == 0 && len(s.Keywords) == 0 {
+		c.options.Subscription = Subscription{}
+	} else {
+		c.options.Subscription.EventTypes = removeAll(c.options.Subscription.EventTypes, s.EventTypes)
+		c.options.Subscription.FeedIDs = removeAll(c.options.Subscription.FeedIDs, s.FeedIDs)
+		c.options.Subscription.Keywords = removeAll(c.options.Subscription.Keywords, s.Keywords)
+	}
+	c.mutex.Unlock()
+	return c.write(command{Type: "unsubscribe", EventTypes: s.EventTypes, FeedIDs: s.FeedIDs, Keywords: s.Keywords})
+}
+
+func removeAll(values, remove []string) []string {
+	kept := values[:0:0]
+	for _, v := range values {
+		found := false
+		for _, r := range remove {
+			if strings.EqualFold(v, r) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+func (c *Client) write(cmd command) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.conn == nil {
+		return errors.New("pusherclient: not connected")
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return c.conn.WriteJSON(cmd)
+}
+
+// connect abre el WebSocket pidiendo los eventos posteriores al último seq
+// visto y vuelve a enviar la suscripción
+func (c *Client) connect(ctx context.Context) (*websocket.Conn, error) {
+	u, err := url.Parse(c.url)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	c.mutex.Lock()
+	if c.resume {
+		q.Set("last_seq", strconv.FormatUint(c.lastSeq, 10))
+		q.Set("stream", c.stream)
+	}
+	// Los filtros van en la URL para que el servidor los aplique también a
+	// los eventos que reenvía al reconectarse
+	subscription := c.options.Subscription
+	c.mutex.Unlock()
+	setParam(q, "event_types", subscription.EventTypes)
+	setParam(q, "feed_ids", subscription.FeedIDs)
+	setParam(q, "keywords", subscription.Keywords)
+	if c.options.Ack {
+		q.Set("ack", "true")
+	}
+	u.RawQuery = q.Encode()
+
+	header := http.Header{}
+	if c.options.Token != "" {
+		header.Set("Authorization", "Bearer "+c.options.Token)
+	}
+	conn, _, err := c.options.Dialer.DialContext(ctx, u.String(), header)
+	if err != nil {
+		return nil, err
+	}
+
+	// El primer mensaje es welcome, o el cierre si el token no es válido
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	_, data, err := conn.ReadMessage()
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return nil, closeError(err)
+	}
+	var welcome envelope
+	if err := json.Unmarshal(data, &welcome); err != nil || welcome.Type != "welcome" {
+		conn.Close()
+		return nil, fmt.Errorf("pusherclient: unexpected first message %q", data)
+	}
+
+	c.mutex.Lock()
+	c.conn = conn
+	// En la primera conexión se parte del último seq del servidor
+	if !c.resume {
+		c.lastSeq = welcome.LastSeq
+		c.stream = welcome.Stream
+		c.resume = true
+	}
+	c.mutex.Unlock()
+	return conn, nil
+}
+
+func setParam(q url.Values, name string, values []string) {
+	if len(values) > 0 {
+		q.Set(name, strings.Join(values, ","))
+	}
+}
+
+// closeError traduce los códigos de cierre de autenticación a ErrUnauthorized
+func closeError(err error) error {
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		switch closeErr.Code {
+		case closeInvalidToken, closeTokenExpired, closeAuthRequired:
+			return fmt.Errorf("%w: %s", ErrUnauthorized, closeErr.Text)
+		}
+	}
+	return err
+}
+
+// run lee de la conexión y se reconecta con backoff exponencial hasta Close
+func (c *Client) run(conn *websocket.Conn) {
+	defer c.wg.Done()
+	defer close(c.events)
+
+	backoff := c.options.MinBackoff
+	for {
+		wait, err := c.read(conn)
+		if c.ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, ErrUnauthorized) {
+			c.errs <- err
+			return
+		}
+		if wait == 0 {
+			wait = backoff
+			backoff = nextBackoff(backoff, c.options.MaxBackoff)
+		}
+		log.Printf("pusherclient: connection lost (%v), reconnecting in %s", err, wait)
+
+		for {
+			select {
+			case <-c.ctx.Done():
+				return
+			case <-time.After(jitter(wait)):
+			}
+			conn, err = c.connect(c.ctx)
+			if err == nil {
+				backoff = c.options.MinBackoff
+				break
+			}
+			if c.ctx.Err() != nil {
+				return
+			}
+			if errors.Is(err, ErrUnauthorized) {
+				c.errs <- err
+				return
+			}
+			wait = backoff
+			backoff = nextBackoff(backoff, c.options.MaxBackoff)
+			log.Printf("pusherclient: reconnect failed (%v), retrying in %s", err, wait)
+		}
+	}
+}
+
+// nextBackoff duplica la espera sin pasar de max
+func nextBackoff(backoff, max time.Duration) time.Duration {
+	backoff *= 2
+	if backoff > max {
+		return max
+	}
+	return backoff
+}
+
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d)))
+}
+
+// read procesa los mensajes hasta que la conexión se cierra. Devuelve la
+// espera sugerida por el servidor (going_away) antes de reconectarse.
+func (c *Client) read(conn *websocket.Conn) (time.Duration, error) {
+	defer conn.Close()
+	var wait time.Duration
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if err := closeError(err); errors.Is(err, ErrUnauthorized) {
+				return 0, err
+			}
+			return wait, err
+		}
+
+		var env envelope
+		if err := json.Unmarshal(data, &env); err != nil {
+			log.Printf("pusherclient: invalid message: %v", err)
+			continue
+		}
+		switch env.Type {
+		case "subscribed", "unsubscribed", "pong", "resumed":
+			continue
+		case "error":
+			log.Printf("pusherclient: server error: %s", env.Error)
+			continue
+		case "going_away":
+			wait = time.Duration(env.ReconnectAfterMs) * time.Millisecond
+			continue
+		case "resync_required":
+			// Los eventos siguientes se numeran en el stream del servidor
+			c.mutex.Lock()
+			c.lastSeq = env.LastSeq
+			c.stream = env.Stream
+			c.mutex.Unlock()
+			if !c.emit(&ResyncRequired{LastSeq: env.LastSeq}) {
+				return 0, c.ctx.Err()
+			}
+			continue
+		}
+
+		if env.Seq > 0 {
+			c.mutex.Lock()
+			duplicate := env.Seq <= c.lastSeq
+			c.mutex.Unlock()
+			if duplicate {
+				c.ackSeq(env.Seq)
+				continue
+			}
+		}
+
+		event, err := decodeEvent(env.Type, data)
+		if err != nil {
+			log.Printf("pusherclient: invalid %s message: %v", env.Type, err)
+			continue
+		}
+		if !c.emit(event) {
+			return 0, c.ctx.Err()
+		}
+		if env.Seq > 0 {
+			c.mutex.Lock()
+			c.lastSeq = env.Seq
+			c.mutex.Unlock()
+			c.ackSeq(env.Seq)
+		}
+	}
+}
+
+// emit entrega el evento por el canal; devuelve false si se llamó a Close
+func (c *Client) emit(event Event) bool {
+	select {
+	case c.events <- event:
+		return true
+	case <-c.ctx.Done():
+		return false
+	}
+}
+
+func (c *Client) ackSeq(seq uint64) {
+	if !c.options.Ack {
+		return
+	}
+	if err := c.write(command{Type: "ack", Seqs: []uint64{seq}}); err != nil {
+		log.Printf("pusherclient: error acknowledging %d: %v", seq, err)
+	}
+}
+
+func decodeEvent(eventType string, data []byte) (Event, error) {
+	var event Event
+	switch eventType {
+	case "created_feed":
+		event = &CreatedFeedMessage{}
+	case "published_feed":
+		event = &PublishedFeedMessage{}
+	case "updated_feed":
+		event = &UpdatedFeedMessage{}
+	case "deleted_feed":
+		event = &DeletedFeedMessage{}
+	case "restored_feed":
+		event = &RestoredFeedMessage{}
+	case "saved_search_matched":
+		event = &SavedSearchMatchedMessage{}
+	default:
+		return &UnknownMessage{Type: eventType, Raw: append(json.RawMessage{}, data...)}, nil
+	}
+	if err := json.Unmarshal(data, event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
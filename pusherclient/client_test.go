@@ -0,0 +1,219 @@
+package pusherclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestDecodeEvent(t *testing.T) {
+	tests := []struct {
+		eventType string
+		data      string
+		want      Event
+	}{
+		{"created_feed", `{"seq":1,"type":"created_feed","id":"f1","title":"Go"}`, &CreatedFeedMessage{Seq: 1, Type: "created_feed", ID: "f1", Title: "Go"}},
+		{"published_feed", `{"seq":2,"type":"published_feed","id":"f1"}`, &PublishedFeedMessage{CreatedFeedMessage{Seq: 2, Type: "published_feed", ID: "f1"}}},
+		{"updated_feed", `{"type":"updated_feed","id":"f1","revision":3,"changed_fields":["title"]}`, &UpdatedFeedMessage{CreatedFeedMessage: CreatedFeedMessage{Type: "updated_feed", ID: "f1"}, Revision: 3, ChangedFields: []string{"title"}}},
+		{"deleted_feed", `{"type":"deleted_feed","id":"f1","title":"Go"}`, &DeletedFeedMessage{Type: "deleted_feed", ID: "f1", Title: "Go"}},
+		{"restored_feed", `{"type":"restored_feed","id":"f1"}`, &RestoredFeedMessage{CreatedFeedMessage{Type: "restored_feed", ID: "f1"}}},
+		{"saved_search_matched", `{"type":"saved_search_matched","saved_search_id":"s1","feed_id":"f1"}`, &SavedSearchMatchedMessage{Type: "saved_search_matched", SavedSearchID: "s1", FeedID: "f1"}},
+		{"something_new", `{"type":"something_new","x":1}`, &UnknownMessage{Type: "something_new", Raw: []byte(`{"type":"something_new","x":1}`)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.eventType, func(t *testing.T) {
+			event, err := decodeEvent(tt.eventType, []byte(tt.data))
+			if err != nil {
+				t.Fatalf("decodeEvent: %v", err)
+			}
+			if !reflect.DeepEqual(event, tt.want) {
+				t.Errorf("decodeEvent = %#v, want %#v", event, tt.want)
+			}
+			if event.EventType() != tt.eventType {
+				t.Errorf("EventType = %q, want %q", event.EventType(), tt.eventType)
+			}
+		})
+	}
+
+	if _, err := decodeEvent("created_feed", []byte(`{"id":1}`)); err == nil {
+		t.Error("decodeEvent accepted an id of the wrong type")
+	}
+}
+
+func TestNextBackoff(t *testing.T) {
+	tests := []struct {
+		backoff, max, want time.Duration
+	}{
+		{time.Second, 30 * time.Second, 2 * time.Second},
+		{20 * time.Second, 30 * time.Second, 30 * time.Second},
+		{30 * time.Second, 30 * time.Second, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := nextBackoff(tt.backoff, tt.max); got != tt.want {
+			t.Errorf("nextBackoff(%v, %v) = %v, want %v", tt.backoff, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestJitter(t *testing.T) {
+	if got := jitter(0); got != 0 {
+		t.Errorf("jitter(0) = %v, want 0", got)
+	}
+	for i := 0; i < 100; i++ {
+		if got := jitter(time.Second); got < 500*time.Millisecond || got >= 1500*time.Millisecond {
+			t.Fatalf("jitter(1s) = %v, want between 500ms and 1.5s", got)
+		}
+	}
+}
+
+// fakeServer imita el handshake de pusher-service: cada conexión recibe
+// welcome y después los mensajes de su guion, y se cierra al terminarlo
+type fakeServer struct {
+	t       *testing.T
+	mutex   sync.Mutex
+	scripts [][]string
+	queries []url.Values
+}
+
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	n := len(s.queries)
+	s.queries = append(s.queries, r.URL.Query())
+	s.mutex.Unlock()
+	if n >= len(s.scripts) {
+		http.Error(w, "no more connections", http.StatusServiceUnavailable)
+		return
+	}
+	socket, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		s.t.Errorf("Upgrade: %v", err)
+		return
+	}
+	defer socket.Close()
+	for _, message := range s.scripts[n] {
+		if strings.HasPrefix(message, "close:") {
+			socket.WriteMessage(websocket.CloseMessage, []byte(message[len("close:"):]))
+			return
+		}
+		if err := socket.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+			return
+		}
+	}
+	// Espera a que el cliente cierre la conexión
+	for {
+		if _, _, err := socket.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakeServer) query(i int) url.Values {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.queries[i]
+}
+
+func startFakeServer(t *testing.T, scripts ...[]string) (*fakeServer, string) {
+	t.Helper()
+	fake := &fakeServer{t: t, scripts: scripts}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+}
+
+func nextEvent(t *testing.T, client *Client) Event {
+	t.Helper()
+	select {
+	case event, ok := <-client.Events():
+		if !ok {
+			t.Fatal("events channel closed")
+		}
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for an event")
+		return nil
+	}
+}
+
+func TestResumeFromLastSeq(t *testing.T) {
+	normalClose := "close:" + string(websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	fake, wsURL := startFakeServer(t,
+		[]string{
+			`{"type":"welcome","last_seq":5,"stream":"s1"}`,
+			`{"type":"created_feed","seq":6,"id":"f6"}`,
+			`{"type":"going_away","reconnect_after_ms":10}`,
+			normalClose,
+		},
+		[]string{
+			`{"type":"welcome","last_seq":7,"stream":"s1"}`,
+			`{"type":"created_feed","seq":6,"id":"f6"}`,
+			`{"type":"created_feed","seq":7,"id":"f7"}`,
+		},
+	)
+	client, err := Dial(context.Background(), wsURL, Options{
+		Subscription: Subscription{FeedIDs: []string{"f6", "f7"}},
+		MinBackoff:   10 * time.Millisecond,
+		MaxBackoff:   20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer client.Close()
+
+	for _, want := range []string{"f6", "f7"} {
+		event, ok := nextEvent(t, client).(*CreatedFeedMessage)
+		if !ok || event.ID != want {
+			t.Fatalf("event = %+v, want created_feed %s", event, want)
+		}
+	}
+
+	if q := fake.query(0); q.Get("last_seq") != "" || q.Get("feed_ids") != "f6,f7" {
+		t.Errorf("first connection query = %v, want no last_seq and feed_ids=f6,f7", q)
+	}
+	if q := fake.query(1); q.Get("last_seq") != "6" || q.Get("stream") != "s1" || q.Get("feed_ids") != "f6,f7" {
+		t.Errorf("reconnection query = %v, want last_seq=6, stream=s1 and feed_ids=f6,f7", q)
+	}
+}
+
+func TestResyncRequired(t *testing.T) {
+	fake, wsURL := startFakeServer(t,
+		[]string{`{"type":"welcome","last_seq":5,"stream":"s1"}`, "close:"},
+		[]string{
+			`{"type":"welcome","last_seq":2,"stream":"s2"}`,
+			`{"type":"resync_required","last_seq":2,"stream":"s2"}`,
+			`{"type":"created_feed","seq":3,"id":"f3"}`,
+		},
+	)
+	client, err := Dial(context.Background(), wsURL, Options{MinBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer client.Close()
+
+	if resync, ok := nextEvent(t, client).(*ResyncRequired); !ok || resync.LastSeq != 2 {
+		t.Fatalf("first event = %+v, want resync_required at 2", resync)
+	}
+	// El seq 3 es menor que el 5 del stream anterior, pero es nuevo en s2
+	if event, ok := nextEvent(t, client).(*CreatedFeedMessage); !ok || event.ID != "f3" {
+		t.Fatalf("event = %+v, want created_feed f3", event)
+	}
+	if q := fake.query(1); q.Get("last_seq") != "5" || q.Get("stream") != "s1" {
+		t.Errorf("reconnection query = %v, want last_seq=5 and stream=s1", q)
+	}
+}
+
+func TestDialUnauthorized(t *testing.T) {
+	_, wsURL := startFakeServer(t, []string{"close:" + string(websocket.FormatCloseMessage(closeInvalidToken, "invalid token"))})
+	if _, err := Dial(context.Background(), wsURL, Options{Token: "bad"}); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Dial = %v, want %v", err, ErrUnauthorized)
+	}
+}
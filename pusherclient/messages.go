@@ -0,0 +1,123 @@
+package pusherclient
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Event es un mensaje recibido de pusher-service
+type Event interface {
+	EventType() string
+}
+
+// CreatedFeedMessage se recibe cuando se crea un feed
+type CreatedFeedMessage struct {
+	Seq         uint64     `json:"seq"`
+	Type        string     `json:"type"`
+	ID          string     `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Author      string     `json:"author"`
+	URL         string     `json:"url"`
+	Tags        []string   `json:"tags"`
+	Language    string     `json:"language"`
+	Status      string     `json:"status"`
+	PublishedAt *time.Time `json:"published_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func (m *CreatedFeedMessage) EventType() string { return "created_feed" }
+
+// PublishedFeedMessage se recibe cuando se publica un borrador o llega la
+// hora de un feed programado. Los feeds publicados al crearse solo llegan
+// como CreatedFeedMessage.
+type PublishedFeedMessage struct {
+	CreatedFeedMessage
+}
+
+func (m *PublishedFeedMessage) EventType() string { return "published_feed" }
+
+// UpdatedFeedMessage se recibe cuando cambia el contenido de un feed
+// publicado, incluso al restaurar una revisión anterior
+type UpdatedFeedMessage struct {
+	CreatedFeedMessage
+	Revision      int      `json:"revision"`
+	ChangedFields []string `json:"changed_fields"`
+}
+
+func (m *UpdatedFeedMessage) EventType() string { return "updated_feed" }
+
+// DeletedFeedMessage se recibe cuando un feed publicado se mueve a la papelera
+type DeletedFeedMessage struct {
+	Seq       uint64    `json:"seq"`
+	Type      string    `json:"type"`
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+func (m *DeletedFeedMessage) EventType() string { return "deleted_feed" }
+
+// RestoredFeedMessage se recibe cuando un feed publicado sale de la papelera
+type RestoredFeedMessage struct {
+	CreatedFeedMessage
+}
+
+func (m *RestoredFeedMessage) EventType() string { return "restored_feed" }
+
+// SavedSearchMatchedMessage se recibe cuando un feed nuevo coincide con una
+// búsqueda guardada del usuario autenticado
+type SavedSearchMatchedMessage struct {
+	Seq           uint64    `json:"seq"`
+	Type          string    `json:"type"`
+	SavedSearchID string    `json:"saved_search_id"`
+	Query         string    `json:"query"`
+	FeedID        string    `json:"feed_id"`
+	FeedTitle     string    `json:"feed_title"`
+	MatchedAt     time.Time `json:"matched_at"`
+}
+
+func (m *SavedSearchMatchedMessage) EventType() string { return "saved_search_matched" }
+
+// ResyncRequired avisa de que se perdieron eventos que el servidor ya no
+// puede reenviar; el consumidor debe recargar su estado (por ejemplo con
+// GET /feeds) antes de seguir procesando eventos.
+type ResyncRequired struct {
+	LastSeq uint64
+}
+
+func (m *ResyncRequired) EventType() string { return "resync_required" }
+
+// UnknownMessage es un mensaje con un tipo que este paquete no conoce
+type UnknownMessage struct {
+	Type string
+	Raw  json.RawMessage
+}
+
+func (m *UnknownMessage) EventType() string { return m.Type }
+
+// Subscription son los filtros que se envían con el comando subscribe
+type Subscription struct {
+	EventTypes []string `json:"event_types,omitempty"`
+	FeedIDs    []string `json:"feed_ids,omitempty"`
+	Keywords   []string `json:"keywords,omitempty"`
+}
+
+type command struct {
+	Type       string   `json:"type"`
+	RequestID  string   `json:"request_id,omitempty"`
+	EventTypes []string `json:"event_types,omitempty"`
+	FeedIDs    []string `json:"feed_ids,omitempty"`
+	Keywords   []string `json:"keywords,omitempty"`
+	Seqs       []uint64 `json:"seqs,omitempty"`
+}
+
+// envelope tiene los campos comunes a todos los mensajes del servidor
+type envelope struct {
+	Type             string `json:"type"`
+	Seq              uint64 `json:"seq"`
+	LastSeq          uint64 `json:"last_seq"`
+	Stream           string `json:"stream"`
+	Error            string `json:"error"`
+	ReconnectAfterMs int64  `json:"reconnect_after_ms"`
+}
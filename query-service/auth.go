@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"platzi.com/go/cqrs/auth"
+	"platzi.com/go/cqrs/problem"
+)
+
+type userKey struct{}
+
+// requireUser only lets through requests with a valid HS256 token in the
+// Authorization: Bearer header and stores its subject for userFromContext
+func requireUser(key []byte, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h := r.Header.Get("Authorization")
+		if !strings.HasPrefix(h, "Bearer ") {
+			unauthorized(w, r, "A bearer token is required")
+			return
+		}
+		claims, err := auth.Verify(strings.TrimSpace(strings.TrimPrefix(h, "Bearer ")), key, time.Now())
+		if errors.Is(err, auth.ErrTokenExpired) {
+			unauthorized(w, r, "The token has expired")
+			return
+		}
+		if err != nil {
+			unauthorized(w, r, "The token is not valid")
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), userKey{}, claims.Subject)))
+	}
+}
+
+// userFromContext returns the subject of the token checked by requireUser
+func userFromContext(ctx context.Context) string {
+	user, _ := ctx.Value(userKey{}).(string)
+	return user
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request, detail string) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	problem.Error(w, r, http.StatusUnauthorized, detail)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"platzi.com/go/cqrs/models"
+	"platzi.com/go/cqrs/problem"
+	"platzi.com/go/cqrs/repository"
+)
+
+// Export formats for /feeds/export
+const (
+	formatNDJSON = "ndjson"
+	formatCSV    = "csv"
+)
+
+// exportFlushEvery is how many rows are written between flushes to the client
+const exportFlushEvery = 100
+
+// parseFeedFilter reads the 'since' and 'until' (RFC 3339) and 'tags'
+// (comma-separated) query parameters shared by /feeds, /feeds/export and
+// /search. It responds 400 and returns false if they are invalid.
+func parseFeedFilter(w http.ResponseWriter, r *http.Request) (models.FeedFilter, bool) {
+	// Drafts, scheduled and archived feeds are never exposed
+	filter := models.FeedFilter{Status: models.FeedStatusPublished}
+	var errs []problem.FieldError
+	for _, param := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		value := r.URL.Query().Get(param.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			errs = append(errs, problem.FieldError{Field: param.name, Message: "must be an RFC 3339 timestamp"})
+			continue
+		}
+		*param.dst = t
+	}
+	for _, tag := range strings.Split(r.URL.Query().Get("tags"), ",") {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+			filter.Tags = append(filter.Tags, tag)
+		}
+	}
+	if len(errs) > 0 {
+		p := problem.New(http.StatusBadRequest, "The request has invalid query parameters")
+		p.Errors = errs
+		p.Write(w, r)
+		return filter, false
+	}
+	return filter, true
+}
+
+// negotiateExportFormat picks NDJSON or CSV from the 'format' query parameter
+// or the Accept header; NDJSON is the default
+func negotiateExportFormat(r *http.Request) (string, error) {
+	switch format := r.URL.Query().Get("format"); format {
+	case "":
+	case formatNDJSON, formatCSV:
+		return format, nil
+	default:
+		return "", fmt.Errorf("must be one of ndjson or csv")
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "application/x-ndjson":
+			return formatNDJSON, nil
+		case "text/csv":
+			return formatCSV, nil
+		}
+	}
+	return formatNDJSON, nil
+}
+
+// exportFeedsHandler streams every feed matching the filters as NDJSON or
+// CSV straight from a database cursor, without loading them in memory. The
+// export stops when the client disconnects.
+func exportFeedsHandler(w http.ResponseWriter, r *http.Request) {
+	format, err := negotiateExportFormat(r)
+	if err != nil {
+		invalidParam(w, r, "format", err.Error())
+		return
+	}
+	filter, ok := parseFeedFilter(w, r)
+	if !ok {
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	var (
+		rows        int
+		csvWriter   *csv.Writer
+		jsonEncoder *json.Encoder
+	)
+	// Headers are sent with the first row, so errors before it can still be
+	// reported as a problem response
+	start := func() {
+		if format == formatCSV {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", `attachment; filename="feeds.csv"`)
+			csvWriter = csv.NewWriter(w)
+			csvWriter.Write([]string{"id", "title", "description", "author", "url", "tags", "body", "language", "status", "published_at", "created_at"})
+		} else {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.Header().Set("Content-Disposition", `attachment; filename="feeds.ndjson"`)
+			jsonEncoder = json.NewEncoder(w)
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	flush := func() error {
+		if csvWriter != nil {
+			csvWriter.Flush()
+			if err := csvWriter.Error(); err != nil {
+				return err
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+
+	err = repository.StreamFeeds(r.Context(), filter, func(feed *models.Feed) error {
+		if rows == 0 {
+			start()
+		}
+		rows++
+		var err error
+		if csvWriter != nil {
+			// Tags share a single column, separated by "|"
+			err = csvWriter.Write([]string{
+				feed.ID, feed.Title, feed.Description, feed.Author, feed.URL,
+				strings.Join(feed.Tags, "|"), feed.Body, feed.Language, feed.Status,
+				feed.PublicationTime().UTC().Format(time.RFC3339Nano),
+				feed.CreatedAt.UTC().Format(time.RFC3339Nano),
+			})
+		} else {
+			err = jsonEncoder.Encode(feed)
+		}
+		if err != nil {
+			return err
+		}
+		if rows%exportFlushEvery == 0 {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		if r.Context().Err() != nil {
+			log.Printf("Feed export cancelled by the client after %d rows", rows)
+			return
+		}
+		log.Printf("Error exporting feeds after %d rows: %v", rows, err)
+		if rows == 0 {
+			problem.Error(w, r, http.StatusInternalServerError, "Failed to export feeds")
+		}
+		// Once rows were sent the status can no longer change; the client
+		// sees a truncated body
+		return
+	}
+	if rows == 0 {
+		start()
+	}
+	if err := flush(); err != nil {
+		log.Printf("Error flushing feed export: %v", err)
+	}
+}
@@ -4,12 +4,18 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
 	"time"
 
+	"github.com/gorilla/mux"
 	"platzi.com/go/cqrs/events"
 	"platzi.com/go/cqrs/models"
+	"platzi.com/go/cqrs/problem"
 	"platzi.com/go/cqrs/repository"
 	"platzi.com/go/cqrs/search"
 )
@@ -18,39 +24,134 @@ func rootHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Root handler called")
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"message": "Query Service Running", "endpoints": ["/feeds", "/search", "/health"]}`))
+	w.Write([]byte(`{"message": "Query Service Running", "endpoints": ["/feeds", "/feeds/export", "/feeds/trash", "/search", "/search/suggest", "/health"]}`))
 }
 
 func onCreatedFeed(m events.CreatedFeedMessage) {
 	log.Printf("Received CreatedFeed event: ID=%s, Title=%s", m.ID, m.Title)
-	feed := &models.Feed{
-		ID:          m.ID,
-		Title:       m.Title,
-		Description: m.Description,
-		CreatedAt:   m.CreatedAt,
+	if m.Status != models.FeedStatusPublished {
+		log.Printf("Skipping %s feed: ID=%s", m.Status, m.ID)
+		return
 	}
+	indexPublishedFeed(m.Feed())
+}
+
+func onPublishedFeed(m events.PublishedFeedMessage) {
+	log.Printf("Received PublishedFeed event: ID=%s, Title=%s", m.ID, m.Title)
+	indexPublishedFeed(m.Feed())
+}
+
+// onUpdatedFeed reindexes a published feed whose content changed. Saved
+// searches are only notified of new feeds, not of edits.
+func onUpdatedFeed(m events.UpdatedFeedMessage) {
+	log.Printf("Received UpdatedFeed event: ID=%s, Revision=%d", m.ID, m.Revision)
+	if m.Status != models.FeedStatusPublished {
+		return
+	}
+	if err := search.IndexFeed(context.Background(), m.Feed()); err != nil {
+		log.Printf("Error reindexing feed %s: %v", m.ID, err)
+	}
+}
+
+// indexPublishedFeed makes feed searchable and notifies the saved searches
+// it matches. Only published feeds reach it.
+func indexPublishedFeed(feed *models.Feed) {
 	log.Printf("Indexing feed to Elasticsearch: ID=%s, Title=%s", feed.ID, feed.Title)
 	if err := search.IndexFeed(context.Background(), feed); err != nil {
 		log.Printf("Error indexing feed: %v", err)
 	} else {
 		log.Printf("Successfully indexed feed: ID=%s", feed.ID)
 	}
+	notifySavedSearchMatches(context.Background(), feed)
 }
 
 func listFeedsHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	var err error
-	feeds, err := repository.ListFeeds(ctx)
+	format, err := negotiateFormat(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		invalidParam(w, r, "format", err.Error())
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(feeds); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	filter, ok := parseFeedFilter(w, r)
+	if !ok {
+		return
+	}
+	if format == formatJSON {
+		streamFeedsJSON(w, r, filter)
 		return
 	}
+
+	// RSS and Atom only list the newest feeds, so only those are kept
+	var newest newestFeeds
+	err = repository.StreamFeeds(ctx, filter, func(feed *models.Feed) error {
+		newest.add(feed)
+		return nil
+	})
+	if err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	doc := syndication{
+		ID:          "tag:" + tagAuthority + ":feeds",
+		Title:       "Feeds",
+		Description: "Latest feeds",
+		SelfURL:     requestURL(r),
+	}
+	if err := writeFeeds(w, r, format, doc, newest.list()); err != nil {
+		log.Printf("Error writing feeds: %v", err)
+	}
+}
+
+// streamFeedsJSON writes the feeds matching filter as a JSON array as they
+// are read from the database cursor, like exportFeedsHandler, so listing
+// every feed does not hold them all in memory. The array is not hashed, so
+// unlike RSS and Atom it has no ETag.
+func streamFeedsJSON(w http.ResponseWriter, r *http.Request, filter models.FeedFilter) {
+	flusher, _ := w.(http.Flusher)
+	rows := 0
+	err := repository.StreamFeeds(r.Context(), filter, func(feed *models.Feed) error {
+		data, err := json.Marshal(feed)
+		if err != nil {
+			return err
+		}
+		separator := ","
+		if rows == 0 {
+			// Headers are sent with the first row, so errors before it can
+			// still be reported as a problem response
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			separator = "["
+		}
+		rows++
+		if _, err := io.WriteString(w, separator); err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		if rows%exportFlushEvery == 0 && flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		if r.Context().Err() != nil {
+			log.Printf("Feed listing cancelled by the client after %d rows", rows)
+			return
+		}
+		log.Printf("Error listing feeds after %d rows: %v", rows, err)
+		if rows == 0 {
+			problem.Error(w, r, http.StatusInternalServerError, "Failed to list feeds")
+		}
+		// The status was already sent; the client sees an unterminated array
+		return
+	}
+	if rows == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, "[")
+	}
+	io.WriteString(w, "]\n")
 }
 
 func healthHandler(w http.ResponseWriter, r *http.Request) {
@@ -62,7 +163,7 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 	esRepo := search.GetSearchRepository()
 	if esRepo == nil {
 		log.Printf("Elasticsearch repository is nil")
-		http.Error(w, "Elasticsearch repository not initialized", http.StatusServiceUnavailable)
+		problem.Error(w, r, http.StatusServiceUnavailable, "Elasticsearch repository not initialized")
 		return
 	}
 
@@ -70,7 +171,7 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 	count, err := esRepo.Count(ctx)
 	if err != nil {
 		log.Printf("Error testing Elasticsearch connection: %v", err)
-		http.Error(w, fmt.Sprintf("Elasticsearch error: %v", err), http.StatusServiceUnavailable)
+		problem.Error(w, r, http.StatusServiceUnavailable, fmt.Sprintf("Elasticsearch error: %v", err))
 		return
 	}
 
@@ -82,11 +183,20 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 		"elasticsearch_count": count,
 		"timestamp":           time.Now().Format(time.RFC3339),
 	}
+	if failover, ok := esRepo.(*search.FailoverSearchRepository); ok && failover.Degraded() {
+		response["status"] = "degraded"
+	}
+	if checker, ok := esRepo.(search.MappingChecker); ok {
+		if err := checker.MappingError(); err != nil {
+			response["status"] = "degraded"
+			response["elasticsearch_mapping_error"] = err.Error()
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Error(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 }
@@ -95,11 +205,16 @@ func reindexHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	log.Printf("Reindex endpoint called")
 
-	// Get all feeds from PostgreSQL
-	feeds, err := repository.ListFeeds(ctx)
+	// Get all published feeds from PostgreSQL; drafts and scheduled feeds
+	// are indexed when they are published
+	var feeds []*models.Feed
+	err := repository.StreamFeeds(ctx, models.FeedFilter{Status: models.FeedStatusPublished}, func(feed *models.Feed) error {
+		feeds = append(feeds, feed)
+		return nil
+	})
 	if err != nil {
 		log.Printf("Error getting feeds from repository: %v", err)
-		http.Error(w, fmt.Sprintf("Error getting feeds: %v", err), http.StatusInternalServerError)
+		problem.Error(w, r, http.StatusInternalServerError, fmt.Sprintf("Error getting feeds: %v", err))
 		return
 	}
 
@@ -109,7 +224,7 @@ func reindexHandler(w http.ResponseWriter, r *http.Request) {
 	esRepo := search.GetSearchRepository()
 	if esRepo == nil {
 		log.Printf("Elasticsearch repository is nil in reindex")
-		http.Error(w, "Elasticsearch repository not initialized", http.StatusServiceUnavailable)
+		problem.Error(w, r, http.StatusServiceUnavailable, "Elasticsearch repository not initialized")
 		return
 	}
 
@@ -137,7 +252,7 @@ func reindexHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Error(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 }
@@ -151,7 +266,7 @@ func debugHandler(w http.ResponseWriter, r *http.Request) {
 	esRepo := search.GetSearchRepository()
 	if esRepo == nil {
 		log.Printf("Elasticsearch repository is nil in debug")
-		http.Error(w, "Elasticsearch repository not initialized", http.StatusServiceUnavailable)
+		problem.Error(w, r, http.StatusServiceUnavailable, "Elasticsearch repository not initialized")
 		return
 	}
 
@@ -159,7 +274,7 @@ func debugHandler(w http.ResponseWriter, r *http.Request) {
 	count, err := esRepo.Count(ctx)
 	if err != nil {
 		log.Printf("Error getting count in debug: %v", err)
-		http.Error(w, fmt.Sprintf("Count error: %v", err), http.StatusInternalServerError)
+		problem.Error(w, r, http.StatusInternalServerError, fmt.Sprintf("Count error: %v", err))
 		return
 	}
 
@@ -168,10 +283,10 @@ func debugHandler(w http.ResponseWriter, r *http.Request) {
 	// Try a simple search
 	testQuery := "go"
 	log.Printf("Debug: Testing search with query: %s", testQuery)
-	feeds, err := search.SearchFeeds(ctx, testQuery)
+	feeds, err := search.SearchFeeds(ctx, testQuery, models.FeedFilter{Status: models.FeedStatusPublished})
 	if err != nil {
 		log.Printf("Debug: Search error: %v", err)
-		http.Error(w, fmt.Sprintf("Search error: %v", err), http.StatusInternalServerError)
+		problem.Error(w, r, http.StatusInternalServerError, fmt.Sprintf("Search error: %v", err))
 		return
 	}
 
@@ -189,17 +304,39 @@ func debugHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Error(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 }
 
+// invalidParam responds 400 with a field error for the query parameter name
+func invalidParam(w http.ResponseWriter, r *http.Request, name, message string) {
+	p := problem.New(http.StatusBadRequest, "The request has invalid query parameters")
+	p.Errors = []problem.FieldError{{Field: name, Message: message}}
+	p.Write(w, r)
+}
+
+// setDegradedHeader flags responses answered by the fallback search backend
+func setDegradedHeader(w http.ResponseWriter, degraded *atomic.Bool) {
+	if degraded.Load() {
+		w.Header().Set("X-Search-Degraded", "true")
+	}
+}
+
 func searchFeedsHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	var err error
+	ctx, degraded := search.WithDegradedTracking(r.Context())
 	query := r.URL.Query().Get("q")
 	if len(query) == 0 {
-		http.Error(w, "query parameter 'q' is required", http.StatusBadRequest)
+		invalidParam(w, r, "q", "is required")
+		return
+	}
+	format, err := negotiateFormat(r)
+	if err != nil {
+		invalidParam(w, r, "format", err.Error())
+		return
+	}
+	filter, ok := parseFeedFilter(w, r)
+	if !ok {
 		return
 	}
 
@@ -209,7 +346,7 @@ func searchFeedsHandler(w http.ResponseWriter, r *http.Request) {
 	esRepo := search.GetSearchRepository()
 	if esRepo == nil {
 		log.Printf("Elasticsearch repository is nil in search handler")
-		http.Error(w, "Elasticsearch repository not initialized", http.StatusServiceUnavailable)
+		problem.Error(w, r, http.StatusServiceUnavailable, "Elasticsearch repository not initialized")
 		return
 	}
 
@@ -221,18 +358,99 @@ func searchFeedsHandler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Total documents in Elasticsearch: %d", count)
 	}
 
-	feeds, err := search.SearchFeeds(ctx, query)
+	feeds, err := search.SearchFeeds(ctx, query, filter)
 	if err != nil {
 		log.Printf("Error searching feeds: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Error(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	log.Printf("Search completed. Found %d feeds", len(feeds))
+	setDegradedHeader(w, degraded)
+	doc := syndication{
+		ID:          "tag:" + tagAuthority + ":search:" + url.QueryEscape(query),
+		Title:       fmt.Sprintf("Search results for %q", query),
+		Description: fmt.Sprintf("Feeds matching %q", query),
+		SelfURL:     requestURL(r),
+	}
+	if err := writeFeeds(w, r, format, doc, feeds); err != nil {
+		log.Printf("Error writing search results: %v", err)
+	}
+}
+
+const (
+	defaultResultLimit = 10
+	maxResultLimit     = 50
+)
+
+// parseLimit reads the optional 'limit' query parameter, capped at maxResultLimit
+func parseLimit(r *http.Request) (int, error) {
+	l := r.URL.Query().Get("limit")
+	if l == "" {
+		return defaultResultLimit, nil
+	}
+	n, err := strconv.Atoi(l)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("must be a positive integer")
+	}
+	if n > maxResultLimit {
+		n = maxResultLimit
+	}
+	return n, nil
+}
+
+func suggestFeedsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, degraded := search.WithDegradedTracking(r.Context())
+	prefix := r.URL.Query().Get("prefix")
+	if len(prefix) == 0 {
+		invalidParam(w, r, "prefix", "is required")
+		return
+	}
+
+	limit, err := parseLimit(r)
+	if err != nil {
+		invalidParam(w, r, "limit", err.Error())
+		return
+	}
+
+	suggestions, err := search.SuggestFeeds(ctx, prefix, limit)
+	if err != nil {
+		log.Printf("Error suggesting feeds: %v", err)
+		problem.Error(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	setDegradedHeader(w, degraded)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(suggestions); err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+}
+
+func relatedFeedsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, degraded := search.WithDegradedTracking(r.Context())
+	id := mux.Vars(r)["id"]
+
+	limit, err := parseLimit(r)
+	if err != nil {
+		invalidParam(w, r, "limit", err.Error())
+		return
+	}
+
+	feeds, err := search.RelatedFeeds(ctx, id, limit)
+	if err != nil {
+		log.Printf("Error finding feeds related to %s: %v", id, err)
+		problem.Error(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	setDegradedHeader(w, degraded)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(feeds); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Error(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 }
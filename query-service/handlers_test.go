@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"platzi.com/go/cqrs/models"
+	"platzi.com/go/cqrs/repository"
+)
+
+// StreamFeeds calls fn with the feeds of the fake repository, in order
+func (r *fakeRepository) StreamFeeds(ctx context.Context, filter models.FeedFilter, fn func(*models.Feed) error) error {
+	for _, feed := range r.feeds {
+		if err := fn(feed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func listFeeds(t *testing.T, feeds []*models.Feed, query string) *httptest.ResponseRecorder {
+	t.Helper()
+	repository.SetRepository(&fakeRepository{feeds: feeds})
+	w := httptest.NewRecorder()
+	listFeedsHandler(w, httptest.NewRequest(http.MethodGet, "/feeds"+query, nil))
+	return w
+}
+
+func testFeeds(n int) []*models.Feed {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	feeds := make([]*models.Feed, n)
+	for i := range feeds {
+		feeds[i] = &models.Feed{
+			ID:        fmt.Sprintf("feed-%03d", i),
+			Title:     fmt.Sprintf("Feed %d", i),
+			Status:    models.FeedStatusPublished,
+			CreatedAt: start.Add(time.Duration(i) * time.Minute),
+		}
+	}
+	return feeds
+}
+
+func TestListFeedsJSON(t *testing.T) {
+	for _, n := range []int{0, 1, 2*exportFlushEvery + 1} {
+		w := listFeeds(t, testFeeds(n), "")
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+			t.Fatalf("GET /feeds with %d feeds = %d %q", n, w.Code, w.Header().Get("Content-Type"))
+		}
+		var listed []*models.Feed
+		if err := json.Unmarshal(w.Body.Bytes(), &listed); err != nil {
+			t.Fatalf("GET /feeds with %d feeds returned invalid JSON: %v", n, err)
+		}
+		if listed == nil || len(listed) != n {
+			t.Errorf("GET /feeds listed %v feeds, want %d", len(listed), n)
+		}
+		for i, feed := range listed {
+			if want := fmt.Sprintf("feed-%03d", i); feed.ID != want {
+				t.Errorf("feed %d = %s, want %s", i, feed.ID, want)
+				break
+			}
+		}
+	}
+}
+
+func TestListFeedsRSSKeepsNewest(t *testing.T) {
+	feeds := testFeeds(5 * maxSyndicationEntries)
+	w := listFeeds(t, feeds, "?format=rss")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /feeds?format=rss = %d", w.Code)
+	}
+	var doc rssDocument
+	if err := xml.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid RSS: %v", err)
+	}
+	items := doc.Channel.Items
+	if len(items) != maxSyndicationEntries {
+		t.Fatalf("RSS has %d items, want %d", len(items), maxSyndicationEntries)
+	}
+	for i, item := range items {
+		want := entryID(feeds[len(feeds)-1-i])
+		if item.GUID.Value != want {
+			t.Fatalf("item %d = %s, want %s", i, item.GUID.Value, want)
+		}
+	}
+	if !strings.HasPrefix(w.Header().Get("ETag"), `"`) {
+		t.Errorf("RSS ETag = %q", w.Header().Get("ETag"))
+	}
+}
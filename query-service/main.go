@@ -5,11 +5,13 @@ import (
 	"log"
 
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/kelseyhightower/envconfig"
 	"platzi.com/go/cqrs/database"
 	"platzi.com/go/cqrs/events"
+	"platzi.com/go/cqrs/problem"
 	"platzi.com/go/cqrs/repository"
 	"platzi.com/go/cqrs/search"
 )
@@ -20,17 +22,39 @@ type Config struct {
 	PostgresPassword     string `envconfig:"POSTGRES_PASSWORD"`
 	NatsAddress          string `envconfig:"NATS_ADDRESS"`
 	ElasticsearchAddress string `envconfig:"ELASTICSEARCH_ADDRESS"`
+	SearchBackend        string `envconfig:"SEARCH_BACKEND" default:"elasticsearch"`
+	SearchIndexPath      string `envconfig:"SEARCH_INDEX_PATH" default:"/var/lib/query-service/index"`
+	// SearchPostgresFallback serves queries from Postgres full-text search while Elasticsearch is down
+	SearchPostgresFallback bool          `envconfig:"SEARCH_POSTGRES_FALLBACK" default:"true"`
+	SearchCircuitThreshold int           `envconfig:"SEARCH_CIRCUIT_THRESHOLD" default:"3"`
+	SearchCircuitCooldown  time.Duration `envconfig:"SEARCH_CIRCUIT_COOLDOWN" default:"30s"`
+	// JWTSecret verifies the HS256 tokens that identify the owner of saved searches
+	JWTSecret string `envconfig:"JWT_SECRET" required:"true"`
 }
 
-func newRouter() (router *mux.Router) {
+func newRouter(cfg Config) (router *mux.Router) {
+	key := []byte(cfg.JWTSecret)
 	router = mux.NewRouter()
+	router.NotFoundHandler = http.HandlerFunc(problem.NotFound)
+	router.MethodNotAllowedHandler = http.HandlerFunc(problem.MethodNotAllowed)
 	router.HandleFunc("/", rootHandler).Methods("GET")
 	router.HandleFunc("/feeds", listFeedsHandler).Methods("GET")
+	router.HandleFunc("/feeds/export", exportFeedsHandler).Methods("GET")
+	router.HandleFunc("/feeds/trash", listTrashHandler).Methods("GET")
+	router.HandleFunc("/feeds/{id}/related", relatedFeedsHandler).Methods("GET")
+	router.HandleFunc("/feeds/{id}/revisions", listFeedRevisionsHandler).Methods("GET")
+	router.HandleFunc("/feeds/{id}/revisions/{n:[0-9]+}", getFeedRevisionHandler).Methods("GET")
+	router.HandleFunc("/feeds/{id}/diff", feedDiffHandler).Methods("GET")
 	router.HandleFunc("/feeds-reindex", reindexHandler).Methods("POST")
 	router.HandleFunc("/feeds-reindex", reindexHandler).Methods("GET")
 	router.HandleFunc("/search", searchFeedsHandler).Methods("GET")
+	router.HandleFunc("/search/suggest", suggestFeedsHandler).Methods("GET")
 	router.HandleFunc("/health", healthHandler).Methods("GET")
 	router.HandleFunc("/debug", debugHandler).Methods("GET")
+	router.HandleFunc("/saved-searches", requireUser(key, createSavedSearchHandler)).Methods("POST")
+	router.HandleFunc("/saved-searches", requireUser(key, listSavedSearchesHandler)).Methods("GET")
+	router.HandleFunc("/saved-searches/{id}", requireUser(key, getSavedSearchHandler)).Methods("GET")
+	router.HandleFunc("/saved-searches/{id}", requireUser(key, deleteSavedSearchHandler)).Methods("DELETE")
 	router.HandleFunc("/reindex", reindexHandler).Methods("POST")
 	router.HandleFunc("/reindex", reindexHandler).Methods("GET")
 	return
@@ -50,11 +74,41 @@ func main() {
 	}
 	repository.SetRepository(repo)
 
-	es, err := search.NewElasticSearch(fmt.Sprintf("http://%s", cfg.ElasticsearchAddress))
-	if err != nil {
-		log.Fatalf("Failed to connect to Elasticsearch: %s", err)
+	switch cfg.SearchBackend {
+	case "elasticsearch":
+		es, err := search.NewElasticSearch(fmt.Sprintf("http://%s", cfg.ElasticsearchAddress))
+		if err != nil {
+			log.Fatalf("Failed to connect to Elasticsearch: %s", err)
+		}
+		if !cfg.SearchPostgresFallback {
+			search.SetSearchRepository(es)
+			search.SetPercolator(es)
+			break
+		}
+		pg, err := search.NewPostgresSearch(addr)
+		if err != nil {
+			log.Fatalf("Failed to open Postgres search fallback: %s", err)
+		}
+		failover := search.NewFailover(es, pg, cfg.SearchCircuitThreshold, cfg.SearchCircuitCooldown)
+		search.SetSearchRepository(failover)
+		search.SetPercolator(failover)
+	case "embedded":
+		embedded, err := search.NewEmbedded(cfg.SearchIndexPath)
+		if err != nil {
+			log.Fatalf("Failed to open embedded search index: %s", err)
+		}
+		search.SetSearchRepository(embedded)
+		search.SetPercolator(embedded)
+	case "postgres":
+		pg, err := search.NewPostgresSearch(addr)
+		if err != nil {
+			log.Fatalf("Failed to open Postgres search: %s", err)
+		}
+		search.SetSearchRepository(pg)
+		search.SetPercolator(pg)
+	default:
+		log.Fatalf("Unknown search backend: %s", cfg.SearchBackend)
 	}
-	search.SetSearchRepository(es)
 	defer search.Close()
 
 	// Initialize event store
@@ -68,13 +122,25 @@ func main() {
 		log.Fatalf("Failed to subscribe to CreatedFeed events: %s", err)
 	}
 	log.Printf("Successfully subscribed to CreatedFeed events")
+	if err := n.OnPublishedFeed(onPublishedFeed); err != nil {
+		log.Fatalf("Failed to subscribe to PublishedFeed events: %s", err)
+	}
+	if err := n.OnUpdatedFeed(onUpdatedFeed); err != nil {
+		log.Fatalf("Failed to subscribe to UpdatedFeed events: %s", err)
+	}
+	if err := n.OnDeletedFeed(onDeletedFeed); err != nil {
+		log.Fatalf("Failed to subscribe to DeletedFeed events: %s", err)
+	}
+	if err := n.OnRestoredFeed(onRestoredFeed); err != nil {
+		log.Fatalf("Failed to subscribe to RestoredFeed events: %s", err)
+	}
 	events.SetEventStore(n)
 	defer func() {
 		if err := events.Close(); err != nil {
 			log.Printf("Error closing event store: %s", err)
 		}
 	}()
-	router := newRouter()
+	router := newRouter(cfg)
 	if err := http.ListenAndServe(":8080", router); err != nil {
 		log.Fatalf("Failed to start server: %s", err)
 	}
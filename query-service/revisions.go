@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"platzi.com/go/cqrs/models"
+	"platzi.com/go/cqrs/problem"
+	"platzi.com/go/cqrs/repository"
+)
+
+// fieldChange is the value of a field before and after a change
+type fieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+type revisionDiff struct {
+	FeedID  string        `json:"feed_id"`
+	From    int           `json:"from"`
+	To      int           `json:"to"`
+	Changes []fieldChange `json:"changes"`
+}
+
+// publishedFeedExists responds 404 and returns false unless the feed in the
+// route exists, is published and is not in the trash; drafts and their
+// history are not exposed
+func publishedFeedExists(w http.ResponseWriter, r *http.Request) bool {
+	id := mux.Vars(r)["id"]
+	feed, err := repository.GetFeed(r.Context(), id)
+	if err != nil {
+		log.Printf("Error getting feed %s: %v", id, err)
+		problem.Error(w, r, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if feed == nil || feed.Status != models.FeedStatusPublished || feed.DeletedAt != nil {
+		problem.Error(w, r, http.StatusNotFound, "Feed not found")
+		return false
+	}
+	return true
+}
+
+func listFeedRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	if !publishedFeedExists(w, r) {
+		return
+	}
+	revisions, err := repository.ListFeedRevisions(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		log.Printf("Error listing revisions: %v", err)
+		problem.Error(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, r, revisions)
+}
+
+func getFeedRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	if !publishedFeedExists(w, r) {
+		return
+	}
+	number, _ := strconv.Atoi(mux.Vars(r)["n"])
+	revision, ok := getRevision(w, r, number)
+	if !ok {
+		return
+	}
+	writeJSON(w, r, revision)
+}
+
+// feedDiffHandler compares two revisions field by field. 'to' defaults to
+// the latest revision and 'from' to the one before 'to'.
+func feedDiffHandler(w http.ResponseWriter, r *http.Request) {
+	if !publishedFeedExists(w, r) {
+		return
+	}
+	id := mux.Vars(r)["id"]
+
+	var from, to int
+	for _, param := range []struct {
+		name string
+		dst  *int
+	}{{"from", &from}, {"to", &to}} {
+		value := r.URL.Query().Get(param.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			invalidParam(w, r, param.name, "must be a positive integer")
+			return
+		}
+		*param.dst = n
+	}
+	if to == 0 {
+		revisions, err := repository.ListFeedRevisions(r.Context(), id)
+		if err != nil {
+			log.Printf("Error listing revisions: %v", err)
+			problem.Error(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if len(revisions) > 0 {
+			to = revisions[len(revisions)-1].Number
+		}
+	}
+	if from == 0 {
+		from = to - 1
+	}
+	if from <= 0 {
+		invalidParam(w, r, "from", "there is no revision before the first one")
+		return
+	}
+
+	fromRevision, ok := getRevision(w, r, from)
+	if !ok {
+		return
+	}
+	toRevision, ok := getRevision(w, r, to)
+	if !ok {
+		return
+	}
+	diff := revisionDiff{FeedID: id, From: from, To: to, Changes: []fieldChange{}}
+	for _, field := range toRevision.Content.ChangedFields(fromRevision.Content) {
+		diff.Changes = append(diff.Changes, fieldChange{
+			Field: field,
+			From:  fromRevision.Content.Field(field),
+			To:    toRevision.Content.Field(field),
+		})
+	}
+	writeJSON(w, r, diff)
+}
+
+// getRevision loads a revision of the feed in the route, responding 404 if
+// it does not exist
+func getRevision(w http.ResponseWriter, r *http.Request, number int) (*models.FeedRevision, bool) {
+	id := mux.Vars(r)["id"]
+	revision, err := repository.GetFeedRevision(r.Context(), id, number)
+	if err != nil {
+		log.Printf("Error getting revision %d of feed %s: %v", number, id, err)
+		problem.Error(w, r, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	if revision == nil {
+		problem.Error(w, r, http.StatusNotFound, "Revision not found")
+		return nil, false
+	}
+	return revision, true
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding response for %s: %v", r.URL.Path, err)
+	}
+}
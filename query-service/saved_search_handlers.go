@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/segmentio/ksuid"
+	"platzi.com/go/cqrs/events"
+	"platzi.com/go/cqrs/models"
+	"platzi.com/go/cqrs/problem"
+	"platzi.com/go/cqrs/repository"
+	"platzi.com/go/cqrs/search"
+)
+
+// createSavedSearchRequest is the body of POST /saved-searches. The owner is
+// the subject of the token; owner_id is optional and must match it.
+type createSavedSearchRequest struct {
+	OwnerID string `json:"owner_id"`
+	Query   string `json:"query"`
+}
+
+// Field limits, matching the VARCHAR(255) columns of saved_searches
+const (
+	maxOwnerIDLength        = 255
+	maxSavedQueryLength     = 255
+	maxSavedSearchBodyBytes = 16 << 10
+)
+
+// validate trims the fields and returns the validation errors
+func (req *createSavedSearchRequest) validate() []problem.FieldError {
+	req.OwnerID = strings.TrimSpace(req.OwnerID)
+	req.Query = strings.TrimSpace(req.Query)
+
+	var v problem.Validator
+	v.Required("owner_id", req.OwnerID)
+	v.MaxLength("owner_id", req.OwnerID, maxOwnerIDLength)
+	v.SingleLine("owner_id", req.OwnerID)
+	v.Required("query", req.Query)
+	v.MaxLength("query", req.Query, maxSavedQueryLength)
+	v.SingleLine("query", req.Query)
+	return v.Errors
+}
+
+func createSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	var req createSavedSearchRequest
+	if !problem.DecodeJSON(w, r, &req, maxSavedSearchBodyBytes) {
+		return
+	}
+	user := userFromContext(r.Context())
+	if owner := strings.TrimSpace(req.OwnerID); owner != "" && owner != user {
+		problem.Error(w, r, http.StatusForbidden, "owner_id must be the subject of the token")
+		return
+	}
+	req.OwnerID = user
+	if errs := req.validate(); len(errs) > 0 {
+		problem.Invalid(w, r, errs)
+		return
+	}
+
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, "Failed to generate saved search ID")
+		return
+	}
+	savedSearch := &models.SavedSearch{
+		ID:        id.String(),
+		OwnerID:   req.OwnerID,
+		Query:     req.Query,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	ctx := r.Context()
+	if err := repository.InsertSavedSearch(ctx, savedSearch); err != nil {
+		log.Printf("Error inserting saved search: %v", err)
+		problem.Error(w, r, http.StatusInternalServerError, "Failed to insert saved search")
+		return
+	}
+	if err := search.RegisterSavedSearch(ctx, savedSearch); err != nil {
+		log.Printf("Error registering saved search %s: %v", savedSearch.ID, err)
+		if err := repository.DeleteSavedSearch(ctx, savedSearch.ID); err != nil {
+			log.Printf("Error rolling back saved search %s: %v", savedSearch.ID, err)
+		}
+		problem.Error(w, r, http.StatusInternalServerError, "Failed to register saved search")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(savedSearch)
+}
+
+// listSavedSearchesHandler lists the saved searches of the user of the token.
+// ?owner_id= is optional and must be that user.
+func listSavedSearchesHandler(w http.ResponseWriter, r *http.Request) {
+	ownerID := userFromContext(r.Context())
+	if owner := r.URL.Query().Get("owner_id"); owner != "" && owner != ownerID {
+		problem.Error(w, r, http.StatusForbidden, "owner_id must be the subject of the token")
+		return
+	}
+	savedSearches, err := repository.ListSavedSearches(r.Context(), ownerID)
+	if err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(savedSearches)
+}
+
+// ownSavedSearch loads the saved search with id if it belongs to the user of
+// the token. Saved searches of other users are reported as not found, so
+// their IDs cannot be probed.
+func ownSavedSearch(w http.ResponseWriter, r *http.Request, id string) (*models.SavedSearch, bool) {
+	savedSearch, err := repository.GetSavedSearch(r.Context(), id)
+	if err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	if savedSearch == nil || savedSearch.OwnerID != userFromContext(r.Context()) {
+		problem.Error(w, r, http.StatusNotFound, "saved search not found")
+		return nil, false
+	}
+	return savedSearch, true
+}
+
+func getSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	savedSearch, ok := ownSavedSearch(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(savedSearch)
+}
+
+func deleteSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+	if _, ok := ownSavedSearch(w, r, id); !ok {
+		return
+	}
+	if err := search.UnregisterSavedSearch(ctx, id); err != nil {
+		log.Printf("Error unregistering saved search %s: %v", id, err)
+		problem.Error(w, r, http.StatusInternalServerError, "Failed to unregister saved search")
+		return
+	}
+	if err := repository.DeleteSavedSearch(ctx, id); err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// notifySavedSearchMatches percolates a newly indexed feed against the saved
+// searches and publishes a saved_search_matched event for every match.
+func notifySavedSearchMatches(ctx context.Context, feed *models.Feed) {
+	ids, err := search.PercolateFeed(ctx, feed)
+	if err != nil {
+		log.Printf("Error percolating feed %s: %v", feed.ID, err)
+		return
+	}
+	for _, id := range ids {
+		savedSearch, err := repository.GetSavedSearch(ctx, id)
+		if err != nil {
+			log.Printf("Error loading saved search %s: %v", id, err)
+			continue
+		}
+		if savedSearch == nil {
+			log.Printf("Saved search %s matched but no longer exists", id)
+			continue
+		}
+		msg := events.SavedSearchMatchedMessage{
+			SavedSearchID: savedSearch.ID,
+			OwnerID:       savedSearch.OwnerID,
+			Query:         savedSearch.Query,
+			FeedID:        feed.ID,
+			FeedTitle:     feed.Title,
+			MatchedAt:     time.Now().UTC(),
+		}
+		if err := events.PublishSavedSearchMatched(ctx, msg); err != nil {
+			log.Printf("Error publishing saved_search_matched for %s: %v", id, err)
+		}
+	}
+}
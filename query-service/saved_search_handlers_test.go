@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"platzi.com/go/cqrs/auth"
+	"platzi.com/go/cqrs/models"
+	"platzi.com/go/cqrs/repository"
+	"platzi.com/go/cqrs/search"
+)
+
+const testSecret = "test-secret"
+
+// fakeRepository keeps feeds and saved searches in memory. The embedded
+// Repository is nil, so any other method panics if a handler calls it.
+type fakeRepository struct {
+	repository.Repository
+	mutex         sync.Mutex
+	feeds         []*models.Feed
+	savedSearches map[string]*models.SavedSearch
+}
+
+func (r *fakeRepository) InsertSavedSearch(ctx context.Context, savedSearch *models.SavedSearch) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.savedSearches[savedSearch.ID] = savedSearch
+	return nil
+}
+
+func (r *fakeRepository) GetSavedSearch(ctx context.Context, id string) (*models.SavedSearch, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.savedSearches[id], nil
+}
+
+func (r *fakeRepository) ListSavedSearches(ctx context.Context, ownerID string) ([]*models.SavedSearch, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	savedSearches := []*models.SavedSearch{}
+	for _, savedSearch := range r.savedSearches {
+		if savedSearch.OwnerID == ownerID {
+			savedSearches = append(savedSearches, savedSearch)
+		}
+	}
+	return savedSearches, nil
+}
+
+func (r *fakeRepository) DeleteSavedSearch(ctx context.Context, id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.savedSearches, id)
+	return nil
+}
+
+// nopPercolator accepts every saved search and matches nothing
+type nopPercolator struct{}
+
+func (nopPercolator) RegisterSavedSearch(ctx context.Context, savedSearch *models.SavedSearch) error {
+	return nil
+}
+
+func (nopPercolator) UnregisterSavedSearch(ctx context.Context, id string) error {
+	return nil
+}
+
+func (nopPercolator) PercolateFeed(ctx context.Context, feed *models.Feed) ([]string, error) {
+	return []string{}, nil
+}
+
+func startSavedSearchServer(t *testing.T) (*fakeRepository, *httptest.Server) {
+	t.Helper()
+	repo := &fakeRepository{savedSearches: map[string]*models.SavedSearch{
+		"alice-search": {ID: "alice-search", OwnerID: "alice", Query: "golang"},
+	}}
+	repository.SetRepository(repo)
+	search.SetPercolator(nopPercolator{})
+	server := httptest.NewServer(newRouter(Config{JWTSecret: testSecret}))
+	t.Cleanup(server.Close)
+	return repo, server
+}
+
+func testRequest(t *testing.T, method, url, user, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != "" {
+		token, err := auth.Sign(auth.Claims{Subject: user}, []byte(testSecret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestSavedSearchesRequireToken(t *testing.T) {
+	_, server := startSavedSearchServer(t)
+	tests := []struct {
+		method, path, body string
+	}{
+		{http.MethodPost, "/saved-searches", `{"query": "golang"}`},
+		{http.MethodGet, "/saved-searches", ""},
+		{http.MethodGet, "/saved-searches/alice-search", ""},
+		{http.MethodDelete, "/saved-searches/alice-search", ""},
+	}
+	for _, tt := range tests {
+		resp := testRequest(t, tt.method, server.URL+tt.path, "", tt.body)
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s %s without token = %d, want 401", tt.method, tt.path, resp.StatusCode)
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/saved-searches", nil)
+	req.Header.Set("Authorization", "Bearer not-a-token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GET /saved-searches with an invalid token = %d, want 401", resp.StatusCode)
+	}
+}
+
+func TestCreateSavedSearchOwner(t *testing.T) {
+	repo, server := startSavedSearchServer(t)
+
+	resp := testRequest(t, http.MethodPost, server.URL+"/saved-searches", "bob", `{"owner_id": "alice", "query": "golang"}`)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("POST for another owner = %d, want 403", resp.StatusCode)
+	}
+
+	resp = testRequest(t, http.MethodPost, server.URL+"/saved-searches", "bob", `{"query": "golang release"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST = %d, want 201", resp.StatusCode)
+	}
+	var created models.SavedSearch
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if created.OwnerID != "bob" || repo.savedSearches[created.ID] == nil {
+		t.Errorf("created %+v, want a saved search owned by bob", created)
+	}
+}
+
+func TestSavedSearchesOfOtherUsers(t *testing.T) {
+	repo, server := startSavedSearchServer(t)
+
+	resp := testRequest(t, http.MethodGet, server.URL+"/saved-searches?owner_id=alice", "bob", "")
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("GET ?owner_id=alice as bob = %d, want 403", resp.StatusCode)
+	}
+	resp = testRequest(t, http.MethodGet, server.URL+"/saved-searches", "bob", "")
+	var listed []*models.SavedSearch
+	if err := json.NewDecoder(resp.Body).Decode(&listed); err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 0 {
+		t.Errorf("GET as bob listed %d saved searches of alice", len(listed))
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		resp := testRequest(t, method, server.URL+"/saved-searches/alice-search", "bob", "")
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s of alice's saved search as bob = %d, want 404", method, resp.StatusCode)
+		}
+	}
+	if repo.savedSearches["alice-search"] == nil {
+		t.Fatal("bob deleted alice's saved search")
+	}
+
+	resp = testRequest(t, http.MethodGet, server.URL+"/saved-searches/alice-search", "alice", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET of its own saved search as alice = %d, want 200", resp.StatusCode)
+	}
+	resp = testRequest(t, http.MethodDelete, server.URL+"/saved-searches/alice-search", "alice", "")
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("DELETE of its own saved search as alice = %d, want 204", resp.StatusCode)
+	}
+}
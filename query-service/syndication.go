@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"platzi.com/go/cqrs/models"
+)
+
+// Response formats for /feeds and /search
+const (
+	formatJSON = "json"
+	formatRSS  = "rss"
+	formatAtom = "atom"
+)
+
+const (
+	rssContentType  = "application/rss+xml; charset=utf-8"
+	atomContentType = "application/atom+xml; charset=utf-8"
+
+	// maxSyndicationEntries keeps RSS and Atom documents small; readers only
+	// care about the most recent entries
+	maxSyndicationEntries = 50
+
+	// tagAuthority scopes the tag: URIs (RFC 4151) used as entry IDs, so IDs
+	// stay stable no matter which host the feed was fetched from
+	tagAuthority = "platzi.com,2024"
+)
+
+// negotiateFormat picks the response format from the 'format' query
+// parameter or, if absent, from the Accept header
+func negotiateFormat(r *http.Request) (string, error) {
+	switch format := r.URL.Query().Get("format"); format {
+	case "":
+	case formatJSON, formatRSS, formatAtom:
+		return format, nil
+	default:
+		return "", fmt.Errorf("must be one of json, rss or atom")
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "application/json":
+			return formatJSON, nil
+		case "application/rss+xml":
+			return formatRSS, nil
+		case "application/atom+xml":
+			return formatAtom, nil
+		}
+	}
+	return formatJSON, nil
+}
+
+// syndication describes the document a list of feeds is rendered into
+type syndication struct {
+	ID          string
+	Title       string
+	Description string
+	SelfURL     string
+}
+
+// writeFeeds renders feeds in the negotiated format with an ETag header,
+// answering 304 when the client's copy is current. There is no
+// Last-Modified: edits, trashing and restoring, and imports with an old
+// published_at change the list without a newer publication time, so only a
+// hash of the body tells whether it changed.
+func writeFeeds(w http.ResponseWriter, r *http.Request, format string, doc syndication, feeds []*models.Feed) error {
+	var (
+		body        []byte
+		contentType string
+		err         error
+	)
+	switch format {
+	case formatRSS:
+		contentType = rssContentType
+		body, err = renderRSS(doc, newestFirst(feeds))
+	case formatAtom:
+		contentType = atomContentType
+		body, err = renderAtom(doc, newestFirst(feeds))
+	default:
+		contentType = "application/json"
+		body, err = json.Marshal(feeds)
+		body = append(body, '\n')
+	}
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Vary", "Accept")
+	if notModified(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(body)
+	return err
+}
+
+// notModified applies If-None-Match. If-Modified-Since is ignored, see
+// writeFeeds.
+func notModified(r *http.Request, etag string) bool {
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func latest(feeds []*models.Feed) time.Time {
+	var t time.Time
+	for _, feed := range feeds {
+		if feed.PublicationTime().After(t) {
+			t = feed.PublicationTime()
+		}
+	}
+	return t
+}
+
+// newestFeeds keeps the maxSyndicationEntries most recent feeds of a stream
+// without holding the rest
+type newestFeeds struct {
+	feeds []*models.Feed
+}
+
+func (n *newestFeeds) add(feed *models.Feed) {
+	n.feeds = append(n.feeds, feed)
+	if len(n.feeds) >= 2*maxSyndicationEntries {
+		n.feeds = newestFirst(n.feeds)
+	}
+}
+
+// list returns the kept feeds, most recent first
+func (n *newestFeeds) list() []*models.Feed {
+	return newestFirst(n.feeds)
+}
+
+// newestFirst returns up to maxSyndicationEntries feeds, most recent first
+func newestFirst(feeds []*models.Feed) []*models.Feed {
+	sorted := append([]*models.Feed{}, feeds...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].PublicationTime().After(sorted[j].PublicationTime())
+	})
+	if len(sorted) > maxSyndicationEntries {
+		sorted = sorted[:maxSyndicationEntries]
+	}
+	return sorted
+}
+
+// entryID is the stable ID of a feed in RSS and Atom documents, derived from its KSUID
+func entryID(feed *models.Feed) string {
+	return "tag:" + tagAuthority + ":feed:" + feed.ID
+}
+
+// requestURL rebuilds the absolute URL the client used, behind nginx included
+func requestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
+
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	AtomLink      atomLink  `xml:"atom:link"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	GUID        rssGUID  `xml:"guid"`
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link,omitempty"`
+	Description string   `xml:"description"`
+	Categories  []string `xml:"category"`
+	PubDate     string   `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+func renderRSS(doc syndication, feeds []*models.Feed) ([]byte, error) {
+	channel := rssChannel{
+		Title:       doc.Title,
+		Link:        doc.SelfURL,
+		Description: doc.Description,
+		AtomLink:    atomLink{Href: doc.SelfURL, Rel: "self", Type: strings.Split(rssContentType, ";")[0]},
+		Items:       make([]rssItem, 0, len(feeds)),
+	}
+	if updated := latest(feeds); !updated.IsZero() {
+		channel.LastBuildDate = updated.UTC().Format(time.RFC1123Z)
+	}
+	for _, feed := range feeds {
+		channel.Items = append(channel.Items, rssItem{
+			GUID:        rssGUID{Value: entryID(feed)},
+			Title:       feed.Title,
+			Link:        feed.URL,
+			Description: feed.Description,
+			Categories:  feed.Tags,
+			PubDate:     feed.PublicationTime().UTC().Format(time.RFC1123Z),
+		})
+	}
+	return marshalXML(rssDocument{Version: "2.0", AtomNS: "http://www.w3.org/2005/Atom", Channel: channel})
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published"`
+	Author     *atomAuthor    `xml:"author,omitempty"`
+	Link       *atomLink      `xml:"link,omitempty"`
+	Categories []atomCategory `xml:"category"`
+	Summary    string         `xml:"summary,omitempty"`
+	Content    *atomContent   `xml:"content,omitempty"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// atomContent carries the markdown body as plain text
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+func renderAtom(doc syndication, feeds []*models.Feed) ([]byte, error) {
+	// Atom requires <updated>; an empty feed uses a fixed date so its ETag is stable
+	updated := latest(feeds)
+	if updated.IsZero() {
+		updated = time.Unix(0, 0)
+	}
+	feed := atomFeed{
+		ID:      doc.ID,
+		Title:   doc.Title,
+		Updated: updated.UTC().Format(time.RFC3339),
+		Link:    atomLink{Href: doc.SelfURL, Rel: "self", Type: strings.Split(atomContentType, ";")[0]},
+		Author:  atomAuthor{Name: "Query Service"},
+		Entries: make([]atomEntry, 0, len(feeds)),
+	}
+	for _, f := range feeds {
+		published := f.PublicationTime().UTC().Format(time.RFC3339)
+		entry := atomEntry{
+			ID:        entryID(f),
+			Title:     f.Title,
+			Updated:   published,
+			Published: published,
+			Summary:   f.Description,
+		}
+		if f.Author != "" {
+			entry.Author = &atomAuthor{Name: f.Author}
+		}
+		if f.URL != "" {
+			entry.Link = &atomLink{Href: f.URL, Rel: "alternate"}
+		}
+		for _, tag := range f.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+		if f.Body != "" {
+			entry.Content = &atomContent{Type: "text", Value: f.Body}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return marshalXML(feed)
+}
+
+func marshalXML(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
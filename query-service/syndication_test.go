@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"platzi.com/go/cqrs/models"
+)
+
+func TestWriteFeedsConditional(t *testing.T) {
+	published := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	feed := &models.Feed{ID: "feed", Title: "Go 1.22", PublishedAt: &published, CreatedAt: published}
+	doc := syndication{ID: "tag:test", Title: "Feeds", SelfURL: "http://example.com/feeds"}
+
+	get := func(header http.Header, feeds ...*models.Feed) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, "/feeds?format=atom", nil)
+		r.Header = header
+		w := httptest.NewRecorder()
+		if err := writeFeeds(w, r, formatAtom, doc, feeds); err != nil {
+			t.Fatalf("writeFeeds: %v", err)
+		}
+		return w
+	}
+
+	first := get(http.Header{}, feed)
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("GET = %d with ETag %q, want 200 with an ETag", first.Code, etag)
+	}
+	if lm := first.Header().Get("Last-Modified"); lm != "" {
+		t.Errorf("Last-Modified = %q, want none", lm)
+	}
+
+	if w := get(http.Header{"If-None-Match": {etag}}, feed); w.Code != http.StatusNotModified {
+		t.Errorf("GET with the current ETag = %d, want 304", w.Code)
+	}
+
+	// An edit keeps the publication time but must not look unchanged
+	edited := *feed
+	edited.Title = "Go 1.22 released"
+	since := published.Add(time.Hour).Format(http.TimeFormat)
+	if w := get(http.Header{"If-Modified-Since": {since}}, &edited); w.Code != http.StatusOK {
+		t.Errorf("GET of an edited feed with If-Modified-Since = %d, want 200", w.Code)
+	}
+	if w := get(http.Header{"If-None-Match": {etag}}, &edited); w.Code != http.StatusOK {
+		t.Errorf("GET of an edited feed with the old ETag = %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"platzi.com/go/cqrs/events"
+	"platzi.com/go/cqrs/models"
+	"platzi.com/go/cqrs/problem"
+	"platzi.com/go/cqrs/repository"
+	"platzi.com/go/cqrs/search"
+)
+
+// listTrashHandler lists the feeds in the trash, whatever their status, so
+// editors can find the ones to restore before they are purged
+func listTrashHandler(w http.ResponseWriter, r *http.Request) {
+	feeds, err := repository.ListTrashedFeeds(r.Context())
+	if err != nil {
+		log.Printf("Error listing trashed feeds: %v", err)
+		problem.Error(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, r, feeds)
+}
+
+// onDeletedFeed removes a trashed feed from the search index
+func onDeletedFeed(m events.DeletedFeedMessage) {
+	log.Printf("Received DeletedFeed event: ID=%s", m.ID)
+	if err := search.DeleteFeed(context.Background(), m.ID); err != nil {
+		log.Printf("Error removing feed %s from the index: %v", m.ID, err)
+	}
+}
+
+// onRestoredFeed indexes a feed taken out of the trash again if it is
+// published. Saved searches already matched it when it was first published.
+func onRestoredFeed(m events.RestoredFeedMessage) {
+	log.Printf("Received RestoredFeed event: ID=%s", m.ID)
+	if m.Status != models.FeedStatusPublished {
+		return
+	}
+	if err := search.IndexFeed(context.Background(), m.Feed()); err != nil {
+		log.Printf("Error indexing restored feed %s: %v", m.ID, err)
+	}
+}
@@ -2,13 +2,37 @@ package repository
 
 import (
 	"context"
+	"time"
+
 	"platzi.com/go/cqrs/models"
 )
 
 type Repository interface {
 	Close()
 	InsertFeed(ctx context.Context, feed *models.Feed) error
+	InsertFeeds(ctx context.Context, feeds []*models.Feed) (map[string]string, error)
 	ListFeeds(ctx context.Context) ([]*models.Feed, error)
+	StreamFeeds(ctx context.Context, filter models.FeedFilter, fn func(*models.Feed) error) error
+	GetFeed(ctx context.Context, id string) (*models.Feed, error)
+	FindFeedsBySourceKey(ctx context.Context, keys []string) (map[string]string, error)
+	ScheduleFeed(ctx context.Context, id string, publishAt time.Time) (*models.Feed, error)
+	PublishDueFeeds(ctx context.Context, now time.Time, limit int) (int, error)
+	RelayFeedEvents(ctx context.Context, limit int, fn func([]*models.FeedEvent) error) (int, error)
+	UpdateFeed(ctx context.Context, id, author string, updatedAt time.Time, update func(*models.Feed) error) (*models.Feed, *models.FeedRevision, error)
+	TrashFeed(ctx context.Context, id string, deletedAt time.Time) (*models.Feed, error)
+	RestoreFeed(ctx context.Context, id string) (*models.Feed, error)
+	ListTrashedFeeds(ctx context.Context) ([]*models.Feed, error)
+	PurgeTrashedFeeds(ctx context.Context, before time.Time) (int64, error)
+	ListFeedRevisions(ctx context.Context, feedID string) ([]*models.FeedRevision, error)
+	GetFeedRevision(ctx context.Context, feedID string, number int) (*models.FeedRevision, error)
+	InsertSavedSearch(ctx context.Context, savedSearch *models.SavedSearch) error
+	GetSavedSearch(ctx context.Context, id string) (*models.SavedSearch, error)
+	ListSavedSearches(ctx context.Context, ownerID string) ([]*models.SavedSearch, error)
+	DeleteSavedSearch(ctx context.Context, id string) error
+	ReserveIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) (*models.IdempotencyKey, error)
+	CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, contentType string, body []byte) error
+	DeleteIdempotencyKey(ctx context.Context, key string) error
+	PurgeExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error)
 }
 
 var repository Repository
@@ -25,6 +49,94 @@ func InsertFeed(ctx context.Context, feed *models.Feed) error {
 	return repository.InsertFeed(ctx, feed)
 }
 
+func InsertFeeds(ctx context.Context, feeds []*models.Feed) (map[string]string, error) {
+	return repository.InsertFeeds(ctx, feeds)
+}
+
 func ListFeeds(ctx context.Context) ([]*models.Feed, error) {
 	return repository.ListFeeds(ctx)
-}  
\ No newline at end of file
+}  
+
+func StreamFeeds(ctx context.Context, filter models.FeedFilter, fn func(*models.Feed) error) error {
+	return repository.StreamFeeds(ctx, filter, fn)
+}
+
+func GetFeed(ctx context.Context, id string) (*models.Feed, error) {
+	return repository.GetFeed(ctx, id)
+}
+
+func FindFeedsBySourceKey(ctx context.Context, keys []string) (map[string]string, error) {
+	return repository.FindFeedsBySourceKey(ctx, keys)
+}
+
+func ScheduleFeed(ctx context.Context, id string, publishAt time.Time) (*models.Feed, error) {
+	return repository.ScheduleFeed(ctx, id, publishAt)
+}
+
+func PublishDueFeeds(ctx context.Context, now time.Time, limit int) (int, error) {
+	return repository.PublishDueFeeds(ctx, now, limit)
+}
+
+func RelayFeedEvents(ctx context.Context, limit int, fn func([]*models.FeedEvent) error) (int, error) {
+	return repository.RelayFeedEvents(ctx, limit, fn)
+}
+
+func UpdateFeed(ctx context.Context, id, author string, updatedAt time.Time, update func(*models.Feed) error) (*models.Feed, *models.FeedRevision, error) {
+	return repository.UpdateFeed(ctx, id, author, updatedAt, update)
+}
+
+func TrashFeed(ctx context.Context, id string, deletedAt time.Time) (*models.Feed, error) {
+	return repository.TrashFeed(ctx, id, deletedAt)
+}
+
+func RestoreFeed(ctx context.Context, id string) (*models.Feed, error) {
+	return repository.RestoreFeed(ctx, id)
+}
+
+func ListTrashedFeeds(ctx context.Context) ([]*models.Feed, error) {
+	return repository.ListTrashedFeeds(ctx)
+}
+
+func PurgeTrashedFeeds(ctx context.Context, before time.Time) (int64, error) {
+	return repository.PurgeTrashedFeeds(ctx, before)
+}
+
+func ListFeedRevisions(ctx context.Context, feedID string) ([]*models.FeedRevision, error) {
+	return repository.ListFeedRevisions(ctx, feedID)
+}
+
+func GetFeedRevision(ctx context.Context, feedID string, number int) (*models.FeedRevision, error) {
+	return repository.GetFeedRevision(ctx, feedID, number)
+}
+
+func InsertSavedSearch(ctx context.Context, savedSearch *models.SavedSearch) error {
+	return repository.InsertSavedSearch(ctx, savedSearch)
+}
+
+func GetSavedSearch(ctx context.Context, id string) (*models.SavedSearch, error) {
+	return repository.GetSavedSearch(ctx, id)
+}
+
+func ListSavedSearches(ctx context.Context, ownerID string) ([]*models.SavedSearch, error) {
+	return repository.ListSavedSearches(ctx, ownerID)
+}
+
+func DeleteSavedSearch(ctx context.Context, id string) error {
+	return repository.DeleteSavedSearch(ctx, id)
+}
+
+func ReserveIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) (*models.IdempotencyKey, error) {
+	return repository.ReserveIdempotencyKey(ctx, key)
+}
+
+func CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, contentType string, body []byte) error {
+	return repository.CompleteIdempotencyKey(ctx, key, statusCode, contentType, body)
+}
+
+func DeleteIdempotencyKey(ctx context.Context, key string) error {
+	return repository.DeleteIdempotencyKey(ctx, key)
+}
+
+func PurgeExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error) {
+	return repository.PurgeExpiredIdempotencyKeys(ctx, now)
+}
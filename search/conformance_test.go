@@ -0,0 +1,343 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"platzi.com/go/cqrs/models"
+)
+
+// The conformance suite runs the same cases against every backend.
+// Elasticsearch only runs when SEARCH_TEST_ELASTICSEARCH_ADDRESS points at a
+// disposable cluster, e.g. localhost:9200, and Postgres when
+// SEARCH_TEST_POSTGRES_URL points at a disposable database with
+// database/up.sql applied; the cases use random terms so documents left by
+// other runs do not interfere.
+
+type conformanceBackend interface {
+	SearchRepository
+	Percolator
+}
+
+func TestEmbeddedConformance(t *testing.T) {
+	runConformance(t, func(t *testing.T) conformanceBackend {
+		r, err := NewEmbedded(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewEmbedded: %v", err)
+		}
+		t.Cleanup(r.Close)
+		return r
+	})
+}
+
+func TestElasticSearchConformance(t *testing.T) {
+	address := os.Getenv("SEARCH_TEST_ELASTICSEARCH_ADDRESS")
+	if address == "" {
+		t.Skip("SEARCH_TEST_ELASTICSEARCH_ADDRESS not set")
+	}
+	runConformance(t, func(t *testing.T) conformanceBackend {
+		r, err := NewElasticSearch("http://" + address)
+		if err != nil {
+			t.Fatalf("NewElasticSearch: %v", err)
+		}
+		if err := r.MappingError(); err != nil {
+			t.Fatalf("indices not prepared: %v", err)
+		}
+		t.Cleanup(r.Close)
+		return r
+	})
+}
+
+func TestPostgresConformance(t *testing.T) {
+	url := os.Getenv("SEARCH_TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("SEARCH_TEST_POSTGRES_URL not set")
+	}
+	runConformance(t, func(t *testing.T) conformanceBackend {
+		r, err := NewPostgresSearch(url)
+		if err != nil {
+			t.Fatalf("NewPostgresSearch: %v", err)
+		}
+		t.Cleanup(r.Close)
+		return postgresConformance{r}
+	})
+}
+
+// postgresConformance writes feeds and saved searches to the tables the
+// Postgres backend reads, which feed-service and the saved-search handlers
+// maintain in production
+type postgresConformance struct {
+	*PostgresSearchRepository
+}
+
+func (r postgresConformance) IndexFeed(ctx context.Context, feed *models.Feed) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO feeds (id, title, description, tags, body, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (id) DO UPDATE SET title = EXCLUDED.title, description = EXCLUDED.description,
+			tags = EXCLUDED.tags, body = EXCLUDED.body, status = EXCLUDED.status`,
+		feed.ID, feed.Title, feed.Description, pq.Array(append([]string{}, feed.Tags...)), feed.Body, feed.Status, feed.CreatedAt)
+	return err
+}
+
+func (r postgresConformance) DeleteFeed(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM feeds WHERE id = $1", id)
+	return err
+}
+
+func (r postgresConformance) RegisterSavedSearch(ctx context.Context, savedSearch *models.SavedSearch) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO saved_searches (id, owner_id, query) VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO UPDATE SET owner_id = EXCLUDED.owner_id, query = EXCLUDED.query`,
+		savedSearch.ID, savedSearch.OwnerID, savedSearch.Query)
+	return err
+}
+
+func (r postgresConformance) UnregisterSavedSearch(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM saved_searches WHERE id = $1", id)
+	return err
+}
+
+// randomWord returns a lowercase word unlikely to appear in any other document
+func randomWord() string {
+	letters := make([]byte, 10)
+	for i := range letters {
+		letters[i] = byte('a' + rand.Intn(26))
+	}
+	return string(letters)
+}
+
+func conformanceFeed(id, title, description string, tags ...string) *models.Feed {
+	return &models.Feed{
+		ID:          id,
+		Title:       title,
+		Description: description,
+		Tags:        tags,
+		Status:      models.FeedStatusPublished,
+		CreatedAt:   time.Now().UTC().Truncate(time.Millisecond),
+	}
+}
+
+// indexFeeds indexes the feeds and removes them again when the test ends
+func indexFeeds(t *testing.T, r conformanceBackend, feeds ...*models.Feed) {
+	t.Helper()
+	for _, feed := range feeds {
+		if err := r.IndexFeed(context.Background(), feed); err != nil {
+			t.Fatalf("IndexFeed: %v", err)
+		}
+		id := feed.ID
+		t.Cleanup(func() { r.DeleteFeed(context.Background(), id) })
+	}
+}
+
+func feedIDs(feeds []*models.Feed) map[string]bool {
+	ids := make(map[string]bool, len(feeds))
+	for _, feed := range feeds {
+		ids[feed.ID] = true
+	}
+	return ids
+}
+
+func runConformance(t *testing.T, open func(t *testing.T) conformanceBackend) {
+	ctx := context.Background()
+
+	t.Run("IndexFeedAndCount", func(t *testing.T) {
+		r := open(t)
+		before, err := r.Count(ctx)
+		if err != nil {
+			t.Fatalf("Count: %v", err)
+		}
+		word := randomWord()
+		for i := 0; i < 3; i++ {
+			indexFeeds(t, r, conformanceFeed(fmt.Sprintf("%s-%d", word, i), word+" title", "description"))
+		}
+		// Indexing an existing ID replaces the document
+		indexFeeds(t, r, conformanceFeed(word+"-0", word+" updated", "description"))
+		after, err := r.Count(ctx)
+		if err != nil {
+			t.Fatalf("Count: %v", err)
+		}
+		if after-before != 3 {
+			t.Errorf("Count grew by %d, want 3", after-before)
+		}
+	})
+
+	t.Run("SearchFeeds", func(t *testing.T) {
+		r := open(t)
+		word, other := randomWord(), randomWord()
+		inTitle := conformanceFeed(word+"-title", word+" in the title", "nothing here")
+		inDescription := conformanceFeed(word+"-description", "nothing here", "the description says "+word)
+		unrelated := conformanceFeed(other, other, other)
+		indexFeeds(t, r, inTitle, inDescription, unrelated)
+
+		feeds, err := r.SearchFeeds(ctx, word, models.FeedFilter{})
+		if err != nil {
+			t.Fatalf("SearchFeeds: %v", err)
+		}
+		ids := feedIDs(feeds)
+		if len(ids) != 2 || !ids[inTitle.ID] || !ids[inDescription.ID] {
+			t.Errorf("SearchFeeds(%q) = %v, want %s and %s", word, ids, inTitle.ID, inDescription.ID)
+		}
+		for _, feed := range feeds {
+			if feed.ID == inTitle.ID && (feed.Title != inTitle.Title || feed.Description != inTitle.Description) {
+				t.Errorf("SearchFeeds returned %+v, want the indexed fields", feed)
+			}
+		}
+	})
+
+	t.Run("SearchFeedsFuzzy", func(t *testing.T) {
+		r := open(t)
+		if _, ok := r.(postgresConformance); ok {
+			t.Skip("Postgres full-text search does not match typos")
+		}
+		word := randomWord()
+		feed := conformanceFeed(word, word, "")
+		indexFeeds(t, r, feed)
+		typo := word[:4] + word[5:]
+		feeds, err := r.SearchFeeds(ctx, typo, models.FeedFilter{})
+		if err != nil {
+			t.Fatalf("SearchFeeds: %v", err)
+		}
+		if !feedIDs(feeds)[feed.ID] {
+			t.Errorf("SearchFeeds(%q) did not find %q", typo, word)
+		}
+	})
+
+	t.Run("SearchFeedsFilter", func(t *testing.T) {
+		r := open(t)
+		word := randomWord()
+		tagged := conformanceFeed(word+"-tagged", word, "", "go", "release")
+		untagged := conformanceFeed(word+"-untagged", word, "", "go")
+		indexFeeds(t, r, tagged, untagged)
+		feeds, err := r.SearchFeeds(ctx, word, models.FeedFilter{Tags: []string{"go", "release"}})
+		if err != nil {
+			t.Fatalf("SearchFeeds: %v", err)
+		}
+		if ids := feedIDs(feeds); len(ids) != 1 || !ids[tagged.ID] {
+			t.Errorf("SearchFeeds with tags = %v, want only %s", ids, tagged.ID)
+		}
+		feeds, err = r.SearchFeeds(ctx, word, models.FeedFilter{Status: models.FeedStatusDraft})
+		if err != nil {
+			t.Fatalf("SearchFeeds: %v", err)
+		}
+		if len(feeds) != 0 {
+			t.Errorf("SearchFeeds with status draft = %v, want none", feedIDs(feeds))
+		}
+	})
+
+	t.Run("DeleteFeed", func(t *testing.T) {
+		r := open(t)
+		word := randomWord()
+		feed := conformanceFeed(word, word, "")
+		indexFeeds(t, r, feed)
+		before, err := r.Count(ctx)
+		if err != nil {
+			t.Fatalf("Count: %v", err)
+		}
+		if err := r.DeleteFeed(ctx, feed.ID); err != nil {
+			t.Fatalf("DeleteFeed: %v", err)
+		}
+		feeds, err := r.SearchFeeds(ctx, word, models.FeedFilter{})
+		if err != nil {
+			t.Fatalf("SearchFeeds: %v", err)
+		}
+		if len(feeds) != 0 {
+			t.Errorf("SearchFeeds after DeleteFeed = %v, want none", feedIDs(feeds))
+		}
+		after, err := r.Count(ctx)
+		if err != nil {
+			t.Fatalf("Count: %v", err)
+		}
+		if before-after != 1 {
+			t.Errorf("Count shrank by %d, want 1", before-after)
+		}
+		// Deleting a missing feed is not an error
+		if err := r.DeleteFeed(ctx, feed.ID); err != nil {
+			t.Errorf("DeleteFeed of a missing feed: %v", err)
+		}
+	})
+
+	t.Run("SuggestFeeds", func(t *testing.T) {
+		r := open(t)
+		word := randomWord()
+		feed := conformanceFeed(word, word+" suggestions", "")
+		indexFeeds(t, r, feed)
+		suggestions, err := r.SuggestFeeds(ctx, word[:6], 5)
+		if err != nil {
+			t.Fatalf("SuggestFeeds: %v", err)
+		}
+		if len(suggestions) != 1 || suggestions[0].ID != feed.ID || suggestions[0].Title != feed.Title {
+			t.Errorf("SuggestFeeds(%q) = %+v, want %s", word[:6], suggestions, feed.ID)
+		}
+	})
+
+	t.Run("PercolateFeed", func(t *testing.T) {
+		r := open(t)
+		word, other := randomWord(), randomWord()
+		both := &models.SavedSearch{ID: word + "-both", OwnerID: "owner", Query: word + " " + other}
+		single := &models.SavedSearch{ID: word + "-single", OwnerID: "owner", Query: word}
+		for _, savedSearch := range []*models.SavedSearch{both, single} {
+			if err := r.RegisterSavedSearch(ctx, savedSearch); err != nil {
+				t.Fatalf("RegisterSavedSearch: %v", err)
+			}
+		}
+
+		ids, err := r.PercolateFeed(ctx, conformanceFeed("percolated", word+" alone", ""))
+		if err != nil {
+			t.Fatalf("PercolateFeed: %v", err)
+		}
+		if len(ids) != 1 || ids[0] != single.ID {
+			t.Errorf("PercolateFeed = %v, want [%s]", ids, single.ID)
+		}
+
+		if err := r.UnregisterSavedSearch(ctx, single.ID); err != nil {
+			t.Fatalf("UnregisterSavedSearch: %v", err)
+		}
+		ids, err = r.PercolateFeed(ctx, conformanceFeed("percolated", word, other))
+		if err != nil {
+			t.Fatalf("PercolateFeed: %v", err)
+		}
+		if len(ids) != 1 || ids[0] != both.ID {
+			t.Errorf("PercolateFeed = %v, want [%s]", ids, both.ID)
+		}
+		if err := r.UnregisterSavedSearch(ctx, both.ID); err != nil {
+			t.Fatalf("UnregisterSavedSearch: %v", err)
+		}
+	})
+
+	// Saved searches only match the title and description, whatever else
+	// the backend indexes
+	t.Run("PercolateFeedFields", func(t *testing.T) {
+		r := open(t)
+		word := randomWord()
+		savedSearch := &models.SavedSearch{ID: word, OwnerID: "owner", Query: word}
+		if err := r.RegisterSavedSearch(ctx, savedSearch); err != nil {
+			t.Fatalf("RegisterSavedSearch: %v", err)
+		}
+		defer r.UnregisterSavedSearch(ctx, savedSearch.ID)
+
+		tests := []struct {
+			name string
+			feed *models.Feed
+			want bool
+		}{
+			{"title", conformanceFeed("percolated", word, "description"), true},
+			{"description", conformanceFeed("percolated", "title", word), true},
+			{"body", &models.Feed{ID: "percolated", Title: "title", Description: "description", Body: word, Tags: []string{word}, Status: models.FeedStatusPublished}, false},
+		}
+		for _, tt := range tests {
+			ids, err := r.PercolateFeed(ctx, tt.feed)
+			if err != nil {
+				t.Fatalf("PercolateFeed: %v", err)
+			}
+			if matched := len(ids) == 1 && ids[0] == savedSearch.ID; matched != tt.want {
+				t.Errorf("PercolateFeed with the term in the %s = %v, want match %v", tt.name, ids, tt.want)
+			}
+		}
+	})
+}
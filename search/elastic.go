@@ -7,15 +7,28 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"reflect"
+	"sync"
+	"time"
 
 	elastic "github.com/elastic/go-elasticsearch/v7"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
 	"platzi.com/go/cqrs/models"
 )
 
 type ElasticSearchRepository struct {
 	client *elastic.Client
+	mutex  *sync.RWMutex
+	done   chan struct{}
+	// mappingErr is why the indices do not have their mappings yet; nil once
+	// they are prepared
+	mappingErr error
 }
 
+// prepareIndicesRetry is how long to wait before preparing the indices
+// again when Elasticsearch is unreachable or rejects their mappings
+const prepareIndicesRetry = 30 * time.Second
+
 func NewElasticSearch(url string) (*ElasticSearchRepository, error) {
 	client, err := elastic.NewClient(elastic.Config{
 		Addresses: []string{url},
@@ -33,17 +46,348 @@ func NewElasticSearch(url string) (*ElasticSearchRepository, error) {
 		log.Printf("Successfully connected to ElasticSearch: %s", resp.String())
 	}
 
-	return &ElasticSearchRepository{client: client}, nil
+	repo := &ElasticSearchRepository{
+		client: client,
+		mutex:  &sync.RWMutex{},
+		done:   make(chan struct{}),
+	}
+	if err := repo.ensureIndex(context.Background()); err != nil {
+		log.Printf("Error preparing search indices, retrying every %s: %s", prepareIndicesRetry, err)
+		repo.mappingErr = err
+		go repo.retryEnsureIndex()
+	}
+
+	return repo, nil
+}
+
+// retryEnsureIndex prepares the indices until it succeeds or the repository is closed
+func (r *ElasticSearchRepository) retryEnsureIndex() {
+	ticker := time.NewTicker(prepareIndicesRetry)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		}
+		err := r.ensureIndex(context.Background())
+		r.mutex.Lock()
+		r.mappingErr = err
+		r.mutex.Unlock()
+		if err == nil {
+			log.Printf("Search indices prepared")
+			return
+		}
+		log.Printf("Error preparing search indices: %s", err)
+	}
+}
+
+// MappingChecker is implemented by the backends that keep Elasticsearch
+// indices, so /health can report indices left without their mappings
+type MappingChecker interface {
+	MappingError() error
+}
+
+// MappingError returns why the indices do not have their mappings, or nil
+// once they do. Writes are rejected meanwhile, otherwise Elasticsearch would
+// create the indices with dynamic mappings.
+func (r *ElasticSearchRepository) MappingError() error {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if r.mappingErr != nil {
+		return fmt.Errorf("search indices not ready: %w", r.mappingErr)
+	}
+	return nil
+}
+
+// feedsIndexMapping adds an edge n-gram analyzed subfield to Title so that
+// prefix suggestions can be served without a full multi_match query.
+var feedsIndexMapping = map[string]interface{}{
+	"settings": map[string]interface{}{
+		"analysis": map[string]interface{}{
+			"filter": map[string]interface{}{
+				"autocomplete_filter": map[string]interface{}{
+					"type":     "edge_ngram",
+					"min_gram": 1,
+					"max_gram": 20,
+				},
+			},
+			"analyzer": map[string]interface{}{
+				"autocomplete": map[string]interface{}{
+					"type":      "custom",
+					"tokenizer": "standard",
+					"filter":    []string{"lowercase", "autocomplete_filter"},
+				},
+			},
+		},
+	},
+	"mappings": map[string]interface{}{
+		"properties": map[string]interface{}{
+			"ID": map[string]interface{}{
+				"type": "keyword",
+			},
+			"Title": map[string]interface{}{
+				"type": "text",
+				"fields": map[string]interface{}{
+					"autocomplete": map[string]interface{}{
+						"type":            "text",
+						"analyzer":        "autocomplete",
+						"search_analyzer": "standard",
+					},
+				},
+			},
+			"Description": map[string]interface{}{
+				"type": "text",
+			},
+			"Author": map[string]interface{}{
+				"type": "text",
+			},
+			"URL": map[string]interface{}{
+				"type": "keyword",
+			},
+			"Tags": map[string]interface{}{
+				"type": "keyword",
+			},
+			"Body": map[string]interface{}{
+				"type": "text",
+			},
+			"Language": map[string]interface{}{
+				"type": "keyword",
+			},
+			"Status": map[string]interface{}{
+				"type": "keyword",
+			},
+			"PublishAt": map[string]interface{}{
+				"type": "date",
+			},
+			"PublishedAt": map[string]interface{}{
+				"type": "date",
+			},
+			"CreatedAt": map[string]interface{}{
+				"type": "date",
+			},
+		},
+	},
+}
+
+// ensureIndex creates the feeds and saved-searches indices with their
+// mappings, or updates them when they already exist
+func (r *ElasticSearchRepository) ensureIndex(ctx context.Context) error {
+	if err := r.prepareIndex(ctx, "feeds", feedsIndexMapping); err != nil {
+		return err
+	}
+	return r.prepareIndex(ctx, "saved-searches", savedSearchesIndexMapping)
+}
+
+func (r *ElasticSearchRepository) prepareIndex(ctx context.Context, index string, mapping map[string]interface{}) error {
+	resp, err := r.client.Indices.Exists([]string{index}, r.client.Indices.Exists.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("error checking %s index: %w", index, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == 200 {
+		return r.updateIndex(ctx, index, mapping)
+	}
+
+	body, err := json.Marshal(mapping)
+	if err != nil {
+		return err
+	}
+	resp, err = r.client.Indices.Create(
+		index,
+		r.client.Indices.Create.WithBody(bytes.NewReader(body)),
+		r.client.Indices.Create.WithContext(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("error creating %s index: %w", index, err)
+	}
+	defer resp.Body.Close()
+	if resp.IsError() {
+		return fmt.Errorf("elasticsearch error: %s", resp.String())
+	}
+	log.Printf("Created %s index", index)
+	return nil
+}
+
+// updateIndex brings an existing index up to date with mapping: it adds the
+// missing analyzers and fields, and reindexes the documents in place when
+// the mapping changed so that new subfields such as Title.autocomplete cover
+// them too. A field whose type changed cannot be updated and is an error.
+func (r *ElasticSearchRepository) updateIndex(ctx context.Context, index string, mapping map[string]interface{}) error {
+	if settings, ok := mapping["settings"].(map[string]interface{}); ok {
+		if err := r.updateAnalysis(ctx, index, settings["analysis"].(map[string]interface{})); err != nil {
+			return err
+		}
+	}
+
+	before, err := r.getMapping(ctx, index)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(mapping["mappings"])
+	if err != nil {
+		return err
+	}
+	resp, err := r.client.Indices.PutMapping(
+		bytes.NewReader(body),
+		r.client.Indices.PutMapping.WithIndex(index),
+		r.client.Indices.PutMapping.WithContext(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("error updating %s mapping: %w", index, err)
+	}
+	defer resp.Body.Close()
+	if resp.IsError() {
+		return fmt.Errorf("elasticsearch error updating %s mapping: %s", index, resp.String())
+	}
+	after, err := r.getMapping(ctx, index)
+	if err != nil {
+		return err
+	}
+	if reflect.DeepEqual(before, after) {
+		return nil
+	}
+
+	resp, err = r.client.UpdateByQuery(
+		[]string{index},
+		r.client.UpdateByQuery.WithConflicts("proceed"),
+		r.client.UpdateByQuery.WithWaitForCompletion(false),
+		r.client.UpdateByQuery.WithContext(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("error reindexing %s: %w", index, err)
+	}
+	defer resp.Body.Close()
+	if resp.IsError() {
+		return fmt.Errorf("elasticsearch error reindexing %s: %s", index, resp.String())
+	}
+	log.Printf("Updated %s mapping, reindexing its documents in the background", index)
+	return nil
+}
+
+func (r *ElasticSearchRepository) getMapping(ctx context.Context, index string) (map[string]interface{}, error) {
+	resp, err := r.client.Indices.GetMapping(
+		r.client.Indices.GetMapping.WithIndex(index),
+		r.client.Indices.GetMapping.WithContext(ctx),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error getting %s mapping: %w", index, err)
+	}
+	defer resp.Body.Close()
+	if resp.IsError() {
+		return nil, fmt.Errorf("elasticsearch error: %s", resp.String())
+	}
+	var mapping map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&mapping); err != nil {
+		return nil, fmt.Errorf("error decoding %s mapping: %w", index, err)
+	}
+	return mapping, nil
+}
+
+// updateAnalysis adds the analyzers of analysis that the index lacks.
+// Analysis settings can only change on a closed index, so the index is
+// closed and reopened, which fails its reads for a moment.
+func (r *ElasticSearchRepository) updateAnalysis(ctx context.Context, index string, analysis map[string]interface{}) error {
+	resp, err := r.client.Indices.GetSettings(
+		r.client.Indices.GetSettings.WithIndex(index),
+		r.client.Indices.GetSettings.WithFlatSettings(true),
+		r.client.Indices.GetSettings.WithContext(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("error getting %s settings: %w", index, err)
+	}
+	defer resp.Body.Close()
+	if resp.IsError() {
+		return fmt.Errorf("elasticsearch error: %s", resp.String())
+	}
+	var indices map[string]struct {
+		Settings map[string]interface{} `json:"settings"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&indices); err != nil {
+		return fmt.Errorf("error decoding %s settings: %w", index, err)
+	}
+	missing := false
+	for _, current := range indices {
+		for name := range analysis["analyzer"].(map[string]interface{}) {
+			if _, ok := current.Settings["index.analysis.analyzer."+name+".type"]; !ok {
+				missing = true
+			}
+		}
+	}
+	if !missing {
+		return nil
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"analysis": analysis})
+	if err != nil {
+		return err
+	}
+	closeResp, err := r.client.Indices.Close([]string{index}, r.client.Indices.Close.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("error closing %s index: %w", index, err)
+	}
+	closeResp.Body.Close()
+	if closeResp.IsError() {
+		return fmt.Errorf("elasticsearch error closing %s: %s", index, closeResp.String())
+	}
+	putResp, putErr := r.client.Indices.PutSettings(
+		bytes.NewReader(body),
+		r.client.Indices.PutSettings.WithIndex(index),
+		r.client.Indices.PutSettings.WithContext(ctx),
+	)
+	// The index is reopened even if the settings were rejected
+	openResp, err := r.client.Indices.Open([]string{index}, r.client.Indices.Open.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("error opening %s index: %w", index, err)
+	}
+	openResp.Body.Close()
+	if openResp.IsError() {
+		return fmt.Errorf("elasticsearch error opening %s: %s", index, openResp.String())
+	}
+	if putErr != nil {
+		return fmt.Errorf("error updating %s settings: %w", index, putErr)
+	}
+	defer putResp.Body.Close()
+	if putResp.IsError() {
+		return fmt.Errorf("elasticsearch error updating %s settings: %s", index, putResp.String())
+	}
+	log.Printf("Added analyzers to %s index", index)
+	return nil
+}
+
+// savedSearchesIndexMapping stores each saved search as a percolator query
+// over the same fields the feeds index exposes.
+var savedSearchesIndexMapping = map[string]interface{}{
+	"mappings": map[string]interface{}{
+		"properties": map[string]interface{}{
+			"query": map[string]interface{}{
+				"type": "percolator",
+			},
+			"OwnerID": map[string]interface{}{
+				"type": "keyword",
+			},
+			"Title": map[string]interface{}{
+				"type": "text",
+			},
+			"Description": map[string]interface{}{
+				"type": "text",
+			},
+		},
+	},
 }
 
 func (r *ElasticSearchRepository) Close() {
-	// ElasticSearch client does not require explicit close
+	// ElasticSearch client does not require explicit close, only the retries
+	// preparing the indices are stopped
+	close(r.done)
 }
 
 func (r *ElasticSearchRepository) IndexFeed(ctx context.Context, feed *models.Feed) error {
+	if err := r.MappingError(); err != nil {
+		return err
+	}
 	log.Printf("IndexFeed called for feed ID: %s, Title: %s", feed.ID, feed.Title)
 	body, _ := json.Marshal(feed)
-	log.Printf("Feed JSON: %s", string(body))
 	resp, err := r.client.Index(
 		"feeds",
 		bytes.NewReader(body),
@@ -60,7 +404,25 @@ func (r *ElasticSearchRepository) IndexFeed(ctx context.Context, feed *models.Fe
 	return nil
 }
 
-func (r *ElasticSearchRepository) SearchFeeds(ctx context.Context, query string) (results []*models.Feed, err error) {
+// DeleteFeed removes a feed from the index; a missing document is not an error
+func (r *ElasticSearchRepository) DeleteFeed(ctx context.Context, id string) error {
+	resp, err := r.client.Delete(
+		"feeds",
+		id,
+		r.client.Delete.WithContext(ctx),
+		r.client.Delete.WithRefresh("wait_for"),
+	)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.IsError() && resp.StatusCode != 404 {
+		return fmt.Errorf("elasticsearch error: %s", resp.String())
+	}
+	return nil
+}
+
+func (r *ElasticSearchRepository) SearchFeeds(ctx context.Context, query string, filter models.FeedFilter) (results []*models.Feed, err error) {
 	log.Printf("Searching for: %s", query)
 
 	var buf bytes.Buffer
@@ -68,11 +430,16 @@ func (r *ElasticSearchRepository) SearchFeeds(ctx context.Context, query string)
 	//map[string]interface{} es la forma en que se representa un objeto JSON en Go
 	searchQuery := map[string]interface{}{
 		"query": map[string]interface{}{
-			"multi_match": map[string]interface{}{
-				"query":            query,
-				"fields":           []string{"Title", "Description"},
-				"fuzziness":        3,
-				"cutoff_frequency": 0.0001,
+			"bool": map[string]interface{}{
+				"must": map[string]interface{}{
+					"multi_match": map[string]interface{}{
+						"query":            query,
+						"fields":           []string{"Title", "Description", "Body^0.5"},
+						"fuzziness":        3,
+						"cutoff_frequency": 0.0001,
+					},
+				},
+				"filter": feedFilterClauses(filter),
 			},
 		},
 	}
@@ -120,6 +487,36 @@ func (r *ElasticSearchRepository) SearchFeeds(ctx context.Context, query string)
 	return feeds, nil
 }
 
+// feedFilterClauses translates filter into bool filter clauses: one term per
+// tag, so a feed must have all of them, a term on Status and a range on
+// CreatedAt
+func feedFilterClauses(filter models.FeedFilter) []interface{} {
+	clauses := make([]interface{}, 0, len(filter.Tags)+2)
+	for _, tag := range filter.Tags {
+		clauses = append(clauses, map[string]interface{}{
+			"term": map[string]interface{}{"Tags": tag},
+		})
+	}
+	if filter.Status != "" {
+		clauses = append(clauses, map[string]interface{}{
+			"term": map[string]interface{}{"Status": filter.Status},
+		})
+	}
+	createdAt := map[string]interface{}{}
+	if !filter.Since.IsZero() {
+		createdAt["gte"] = filter.Since
+	}
+	if !filter.Until.IsZero() {
+		createdAt["lt"] = filter.Until
+	}
+	if len(createdAt) > 0 {
+		clauses = append(clauses, map[string]interface{}{
+			"range": map[string]interface{}{"CreatedAt": createdAt},
+		})
+	}
+	return clauses
+}
+
 func (r *ElasticSearchRepository) Count(ctx context.Context) (int64, error) {
 	resp, err := r.client.Count(
 		r.client.Count.WithIndex("feeds"),
@@ -146,3 +543,259 @@ func (r *ElasticSearchRepository) Count(ctx context.Context) (int64, error) {
 
 	return int64(count), nil
 }
+
+// SuggestFeeds returns up to n feed titles starting with the given prefix
+func (r *ElasticSearchRepository) SuggestFeeds(ctx context.Context, prefix string, n int) ([]*Suggestion, error) {
+	var buf bytes.Buffer
+	suggestQuery := map[string]interface{}{
+		"size":    n,
+		"_source": []string{"ID", "Title"},
+		"query": map[string]interface{}{
+			"match": map[string]interface{}{
+				"Title.autocomplete": map[string]interface{}{
+					"query":    prefix,
+					"operator": "and",
+				},
+			},
+		},
+	}
+	if err := json.NewEncoder(&buf).Encode(suggestQuery); err != nil {
+		return nil, err
+	}
+
+	res, err := r.client.Search(
+		r.client.Search.WithContext(ctx),
+		r.client.Search.WithIndex("feeds"),
+		r.client.Search.WithBody(&buf),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, errors.New(res.String())
+	}
+
+	var eRes struct {
+		Hits struct {
+			Hits []struct {
+				Source Suggestion `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&eRes); err != nil {
+		return nil, err
+	}
+
+	suggestions := make([]*Suggestion, 0, len(eRes.Hits.Hits))
+	for i := range eRes.Hits.Hits {
+		suggestions = append(suggestions, &eRes.Hits.Hits[i].Source)
+	}
+	return suggestions, nil
+}
+
+// RelatedFeeds returns up to n feeds similar to the one with the given id, excluding it
+func (r *ElasticSearchRepository) RelatedFeeds(ctx context.Context, id string, n int) ([]*models.Feed, error) {
+	var buf bytes.Buffer
+	relatedQuery := map[string]interface{}{
+		"size": n,
+		"query": map[string]interface{}{
+			"more_like_this": map[string]interface{}{
+				"fields": []string{"Title", "Description"},
+				"like": []map[string]interface{}{
+					{"_index": "feeds", "_id": id},
+				},
+				"min_term_freq": 1,
+				"min_doc_freq":  1,
+				"include":       false,
+			},
+		},
+	}
+	if err := json.NewEncoder(&buf).Encode(relatedQuery); err != nil {
+		return nil, err
+	}
+
+	res, err := r.client.Search(
+		r.client.Search.WithContext(ctx),
+		r.client.Search.WithIndex("feeds"),
+		r.client.Search.WithBody(&buf),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, errors.New(res.String())
+	}
+
+	var eRes struct {
+		Hits struct {
+			Hits []struct {
+				Source models.Feed `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&eRes); err != nil {
+		return nil, err
+	}
+
+	feeds := make([]*models.Feed, 0, len(eRes.Hits.Hits))
+	for i := range eRes.Hits.Hits {
+		if eRes.Hits.Hits[i].Source.ID == id {
+			continue
+		}
+		feeds = append(feeds, &eRes.Hits.Hits[i].Source)
+	}
+	return feeds, nil
+}
+
+// RegisterSavedSearch stores the saved search as a percolator query
+func (r *ElasticSearchRepository) RegisterSavedSearch(ctx context.Context, savedSearch *models.SavedSearch) error {
+	if err := r.MappingError(); err != nil {
+		return err
+	}
+	doc := map[string]interface{}{
+		"OwnerID": savedSearch.OwnerID,
+		"query": map[string]interface{}{
+			"multi_match": map[string]interface{}{
+				"query":    savedSearch.Query,
+				"fields":   []string{"Title", "Description"},
+				"operator": "and",
+			},
+		},
+	}
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	resp, err := r.client.Index(
+		"saved-searches",
+		bytes.NewReader(body),
+		r.client.Index.WithDocumentID(savedSearch.ID),
+		r.client.Index.WithContext(ctx),
+		r.client.Index.WithRefresh("wait_for"),
+	)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.IsError() {
+		return fmt.Errorf("elasticsearch error: %s", resp.String())
+	}
+	return nil
+}
+
+// UnregisterSavedSearch removes the percolator query of a saved search
+func (r *ElasticSearchRepository) UnregisterSavedSearch(ctx context.Context, id string) error {
+	resp, err := r.client.Delete(
+		"saved-searches",
+		id,
+		r.client.Delete.WithContext(ctx),
+		r.client.Delete.WithRefresh("wait_for"),
+	)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.IsError() && resp.StatusCode != 404 {
+		return fmt.Errorf("elasticsearch error: %s", resp.String())
+	}
+	return nil
+}
+
+// percolatePageSize is how many matches PercolateFeed reads per scroll page
+const percolatePageSize = 1000
+
+// percolateScroll is how long Elasticsearch keeps the percolation scroll
+// open between pages
+const percolateScroll = time.Minute
+
+// percolateResponse is a page of percolation matches
+type percolateResponse struct {
+	ScrollID string `json:"_scroll_id"`
+	Hits     struct {
+		Hits []struct {
+			ID string `json:"_id"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+// PercolateFeed returns the IDs of the saved searches matching the title or
+// description of the feed. The matches are read with a scroll, so there is
+// no limit on how many saved searches a feed can match.
+func (r *ElasticSearchRepository) PercolateFeed(ctx context.Context, feed *models.Feed) ([]string, error) {
+	var buf bytes.Buffer
+	percolateQuery := map[string]interface{}{
+		"_source": false,
+		"query": map[string]interface{}{
+			"percolate": map[string]interface{}{
+				"field": "query",
+				"document": map[string]interface{}{
+					"Title":       feed.Title,
+					"Description": feed.Description,
+				},
+			},
+		},
+	}
+	if err := json.NewEncoder(&buf).Encode(percolateQuery); err != nil {
+		return nil, err
+	}
+
+	res, err := r.client.Search(
+		r.client.Search.WithContext(ctx),
+		r.client.Search.WithIndex("saved-searches"),
+		r.client.Search.WithBody(&buf),
+		r.client.Search.WithSize(percolatePageSize),
+		r.client.Search.WithScroll(percolateScroll),
+	)
+	ids := make([]string, 0)
+	var scrollID string
+	defer func() {
+		if scrollID != "" {
+			r.clearScroll(scrollID)
+		}
+	}()
+	for {
+		if err != nil {
+			return nil, err
+		}
+		var page *percolateResponse
+		if page, err = decodePercolatePage(res); err != nil {
+			return nil, err
+		}
+		scrollID = page.ScrollID
+		for _, hit := range page.Hits.Hits {
+			ids = append(ids, hit.ID)
+		}
+		if len(page.Hits.Hits) < percolatePageSize || scrollID == "" {
+			return ids, nil
+		}
+		res, err = r.client.Scroll(
+			r.client.Scroll.WithContext(ctx),
+			r.client.Scroll.WithScrollID(scrollID),
+			r.client.Scroll.WithScroll(percolateScroll),
+		)
+	}
+}
+
+func decodePercolatePage(res *esapi.Response) (*percolateResponse, error) {
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, errors.New(res.String())
+	}
+	var page percolateResponse
+	if err := json.NewDecoder(res.Body).Decode(&page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// clearScroll frees a scroll before it expires
+func (r *ElasticSearchRepository) clearScroll(scrollID string) {
+	res, err := r.client.ClearScroll(r.client.ClearScroll.WithScrollID(scrollID))
+	if err != nil {
+		log.Printf("Error clearing scroll: %v", err)
+		return
+	}
+	res.Body.Close()
+}
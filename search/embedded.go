@@ -0,0 +1,559 @@
+package search
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"platzi.com/go/cqrs/models"
+)
+
+// EmbeddedSearchRepository is a pure Go search backend. Documents are kept in
+// an in-memory inverted index that is rebuilt on startup from an append-only
+// log stored under dir, so it needs no external service. The logs are
+// compacted on startup and whenever most of their entries are superseded.
+type EmbeddedSearchRepository struct {
+	mutex *sync.RWMutex
+	dir   string
+
+	feedsLog    *embeddedLog
+	searchesLog *embeddedLog
+
+	feeds map[string]*models.Feed
+	// postings maps a term to the IDs of the feeds containing it and the
+	// weighted number of occurrences (title terms count double)
+	postings map[string]map[string]float64
+	// savedSearches maps a saved search ID to the search and its analyzed
+	// query terms
+	savedSearches map[string]*embeddedSavedSearch
+}
+
+type embeddedSavedSearch struct {
+	savedSearch *models.SavedSearch
+	terms       []string
+}
+
+// embeddedLog is one of the append-only logs and the number of entries it holds
+type embeddedLog struct {
+	name    string
+	file    *os.File
+	entries int
+}
+
+type embeddedLogEntry struct {
+	Op          string              `json:"op"`
+	ID          string              `json:"id"`
+	Feed        *models.Feed        `json:"feed,omitempty"`
+	SavedSearch *models.SavedSearch `json:"saved_search,omitempty"`
+}
+
+const (
+	embeddedFeedsLog    = "feeds.log"
+	embeddedSearchesLog = "saved-searches.log"
+	// A log is compacted once it has at least compactMinEntries entries and
+	// more than compactRatio entries per live document
+	compactMinEntries = 1000
+	compactRatio      = 2
+	// Title terms weigh more than description terms, and body terms less
+	titleBoost = 2
+	bodyBoost  = 0.5
+)
+
+func NewEmbedded(dir string) (*EmbeddedSearchRepository, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating index directory: %w", err)
+	}
+	r := &EmbeddedSearchRepository{
+		mutex:         &sync.RWMutex{},
+		dir:           dir,
+		feeds:         make(map[string]*models.Feed),
+		postings:      make(map[string]map[string]float64),
+		savedSearches: make(map[string]*embeddedSavedSearch),
+	}
+
+	var err error
+	if r.feedsLog, err = r.replay(embeddedFeedsLog); err != nil {
+		return nil, err
+	}
+	if r.searchesLog, err = r.replay(embeddedSearchesLog); err != nil {
+		r.feedsLog.file.Close()
+		return nil, err
+	}
+	// A failed compaction leaves the previous log in place, so it only costs
+	// a longer replay on the next start
+	if r.feedsLog.entries > len(r.feeds) {
+		if err := r.compact(r.feedsLog, r.feedEntries()); err != nil {
+			log.Printf("Error compacting %s: %v", embeddedFeedsLog, err)
+		}
+	}
+	if r.searchesLog.entries > len(r.savedSearches) {
+		if err := r.compact(r.searchesLog, r.savedSearchEntries()); err != nil {
+			log.Printf("Error compacting %s: %v", embeddedSearchesLog, err)
+		}
+	}
+	log.Printf("Embedded search index loaded from %s: %d feeds, %d saved searches", dir, len(r.feeds), len(r.savedSearches))
+	return r, nil
+}
+
+// replay applies every entry of the named log and leaves it open for appends
+func (r *EmbeddedSearchRepository) replay(name string) (*embeddedLog, error) {
+	f, err := os.OpenFile(filepath.Join(r.dir, name), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", name, err)
+	}
+	l := &embeddedLog{name: name, file: f}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		l.entries++
+		var entry embeddedLogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A torn write at the end of the log only loses that entry
+			log.Printf("Skipping corrupt entry in %s: %v", name, err)
+			continue
+		}
+		r.apply(entry)
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("error reading %s: %w", name, err)
+	}
+	return l, nil
+}
+
+// feedEntries returns one index entry per feed, the compacted feeds log
+func (r *EmbeddedSearchRepository) feedEntries() []embeddedLogEntry {
+	entries := make([]embeddedLogEntry, 0, len(r.feeds))
+	for id, feed := range r.feeds {
+		entries = append(entries, embeddedLogEntry{Op: "index", ID: id, Feed: feed})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries
+}
+
+// savedSearchEntries returns one register entry per saved search, the
+// compacted saved searches log
+func (r *EmbeddedSearchRepository) savedSearchEntries() []embeddedLogEntry {
+	entries := make([]embeddedLogEntry, 0, len(r.savedSearches))
+	for id, s := range r.savedSearches {
+		entries = append(entries, embeddedLogEntry{Op: "register", ID: id, SavedSearch: s.savedSearch})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries
+}
+
+// compact replaces the log with entries. The new log is written to a
+// temporary file and renamed over the old one, so a crash leaves either of
+// them complete, and the temporary file stays open for the next appends.
+func (r *EmbeddedSearchRepository) compact(l *embeddedLog, entries []embeddedLogEntry) (err error) {
+	path := filepath.Join(r.dir, l.name)
+	tmp, err := os.CreateTemp(r.dir, l.name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	w := bufio.NewWriter(tmp)
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	if dir, err := os.Open(r.dir); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	log.Printf("Compacted %s from %d to %d entries", l.name, l.entries, len(entries))
+	l.file.Close()
+	l.file = tmp
+	l.entries = len(entries)
+	return nil
+}
+
+// maybeCompact compacts the log when most of its entries are superseded
+func (r *EmbeddedSearchRepository) maybeCompact(l *embeddedLog, live int, entries func() []embeddedLogEntry) {
+	if l.entries < compactMinEntries || l.entries <= compactRatio*live {
+		return
+	}
+	if err := r.compact(l, entries()); err != nil {
+		log.Printf("Error compacting %s: %v", l.name, err)
+	}
+}
+
+func (r *EmbeddedSearchRepository) apply(entry embeddedLogEntry) {
+	switch entry.Op {
+	case "index":
+		if entry.Feed != nil {
+			r.indexFeed(entry.Feed)
+		}
+	case "delete":
+		r.removeFeed(entry.ID)
+	case "register":
+		if entry.SavedSearch != nil {
+			r.savedSearches[entry.SavedSearch.ID] = &embeddedSavedSearch{
+				savedSearch: entry.SavedSearch,
+				terms:       analyze(entry.SavedSearch.Query),
+			}
+		}
+	case "unregister":
+		delete(r.savedSearches, entry.ID)
+	}
+}
+
+// appendLog persists the entry before it is applied in memory
+func (r *EmbeddedSearchRepository) appendLog(l *embeddedLog, entry embeddedLogEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing search log: %w", err)
+	}
+	l.entries++
+	return l.file.Sync()
+}
+
+func (r *EmbeddedSearchRepository) Close() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.feedsLog != nil {
+		r.feedsLog.file.Close()
+		r.feedsLog = nil
+	}
+	if r.searchesLog != nil {
+		r.searchesLog.file.Close()
+		r.searchesLog = nil
+	}
+}
+
+// analyze lowercases the text and splits it on anything that is not a letter or digit
+func analyze(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsNumber(c)
+	})
+}
+
+// feedTerms returns the weighted term frequencies of a feed
+func feedTerms(feed *models.Feed) map[string]float64 {
+	terms := make(map[string]float64)
+	for _, t := range analyze(feed.Title) {
+		terms[t] += titleBoost
+	}
+	for _, t := range analyze(feed.Description) {
+		terms[t]++
+	}
+	for _, t := range analyze(feed.Body) {
+		terms[t] += bodyBoost
+	}
+	return terms
+}
+
+func (r *EmbeddedSearchRepository) indexFeed(feed *models.Feed) {
+	r.removeFeed(feed.ID)
+	stored := *feed
+	r.feeds[feed.ID] = &stored
+	for term, weight := range feedTerms(feed) {
+		if r.postings[term] == nil {
+			r.postings[term] = make(map[string]float64)
+		}
+		r.postings[term][feed.ID] = weight
+	}
+}
+
+func (r *EmbeddedSearchRepository) removeFeed(id string) {
+	feed, ok := r.feeds[id]
+	if !ok {
+		return
+	}
+	for term := range feedTerms(feed) {
+		delete(r.postings[term], id)
+		if len(r.postings[term]) == 0 {
+			delete(r.postings, term)
+		}
+	}
+	delete(r.feeds, id)
+}
+
+func (r *EmbeddedSearchRepository) IndexFeed(ctx context.Context, feed *models.Feed) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err := r.appendLog(r.feedsLog, embeddedLogEntry{Op: "index", ID: feed.ID, Feed: feed}); err != nil {
+		return err
+	}
+	r.indexFeed(feed)
+	r.maybeCompact(r.feedsLog, len(r.feeds), r.feedEntries)
+	return nil
+}
+
+func (r *EmbeddedSearchRepository) DeleteFeed(ctx context.Context, id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	entry := embeddedLogEntry{Op: "delete", ID: id}
+	if err := r.appendLog(r.feedsLog, entry); err != nil {
+		return err
+	}
+	r.apply(entry)
+	r.maybeCompact(r.feedsLog, len(r.feeds), r.feedEntries)
+	return nil
+}
+
+// maxEdits mirrors Elasticsearch's AUTO fuzziness: exact match for short
+// terms, one edit up to five characters and two edits beyond that.
+func maxEdits(term string) int {
+	switch n := len([]rune(term)); {
+	case n <= 2:
+		return 0
+	case n <= 5:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// levenshtein returns the edit distance between a and b
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// expandTerm returns the indexed terms within the fuzzy distance of term,
+// weighted down by the number of edits needed to reach them.
+func (r *EmbeddedSearchRepository) expandTerm(term string) map[string]float64 {
+	expanded := make(map[string]float64)
+	if _, ok := r.postings[term]; ok {
+		expanded[term] = 1
+	}
+	edits := maxEdits(term)
+	if edits == 0 {
+		return expanded
+	}
+	for candidate := range r.postings {
+		if candidate == term {
+			continue
+		}
+		if d := len([]rune(candidate)) - len([]rune(term)); d > edits || -d > edits {
+			continue
+		}
+		if dist := levenshtein(term, candidate); dist <= edits {
+			expanded[candidate] = 1 / float64(1+dist)
+		}
+	}
+	return expanded
+}
+
+// scoreTerms accumulates a score per feed for any of the given terms
+func (r *EmbeddedSearchRepository) scoreTerms(terms []string) map[string]float64 {
+	scores := make(map[string]float64)
+	for _, term := range terms {
+		for candidate, factor := range r.expandTerm(term) {
+			for id, weight := range r.postings[candidate] {
+				scores[id] += weight * factor
+			}
+		}
+	}
+	return scores
+}
+
+// rankFeeds orders the scored feeds by descending score, newest first on ties
+func (r *EmbeddedSearchRepository) rankFeeds(scores map[string]float64, limit int) []*models.Feed {
+	feeds := make([]*models.Feed, 0, len(scores))
+	for id := range scores {
+		feed := *r.feeds[id]
+		feeds = append(feeds, &feed)
+	}
+	sort.Slice(feeds, func(i, j int) bool {
+		si, sj := scores[feeds[i].ID], scores[feeds[j].ID]
+		if si != sj {
+			return si > sj
+		}
+		return feeds[i].CreatedAt.After(feeds[j].CreatedAt)
+	})
+	if limit > 0 && len(feeds) > limit {
+		feeds = feeds[:limit]
+	}
+	return feeds
+}
+
+func (r *EmbeddedSearchRepository) SearchFeeds(ctx context.Context, query string, filter models.FeedFilter) ([]*models.Feed, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	scores := r.scoreTerms(analyze(query))
+	for id := range scores {
+		if !filter.Matches(r.feeds[id]) {
+			delete(scores, id)
+		}
+	}
+	return r.rankFeeds(scores, defaultSearchLimit), nil
+}
+
+func (r *EmbeddedSearchRepository) Count(ctx context.Context) (int64, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return int64(len(r.feeds)), nil
+}
+
+func (r *EmbeddedSearchRepository) SuggestFeeds(ctx context.Context, prefix string, n int) ([]*Suggestion, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	prefixes := analyze(prefix)
+	suggestions := make([]*Suggestion, 0)
+	if len(prefixes) == 0 {
+		return suggestions, nil
+	}
+
+	var matches []*models.Feed
+	for _, feed := range r.feeds {
+		if titleHasPrefixes(analyze(feed.Title), prefixes) {
+			matches = append(matches, feed)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if len(matches[i].Title) != len(matches[j].Title) {
+			return len(matches[i].Title) < len(matches[j].Title)
+		}
+		return matches[i].ID < matches[j].ID
+	})
+	for _, feed := range matches {
+		if len(suggestions) == n {
+			break
+		}
+		suggestions = append(suggestions, &Suggestion{ID: feed.ID, Title: feed.Title})
+	}
+	return suggestions, nil
+}
+
+// titleHasPrefixes reports whether every prefix starts some term of the title
+func titleHasPrefixes(terms, prefixes []string) bool {
+	for _, p := range prefixes {
+		found := false
+		for _, t := range terms {
+			if strings.HasPrefix(t, p) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *EmbeddedSearchRepository) RelatedFeeds(ctx context.Context, id string, n int) ([]*models.Feed, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	source, ok := r.feeds[id]
+	if !ok {
+		return []*models.Feed{}, nil
+	}
+	scores := make(map[string]float64)
+	for term, weight := range feedTerms(source) {
+		for other, otherWeight := range r.postings[term] {
+			if other != id {
+				scores[other] += weight * otherWeight
+			}
+		}
+	}
+	return r.rankFeeds(scores, n), nil
+}
+
+func (r *EmbeddedSearchRepository) RegisterSavedSearch(ctx context.Context, savedSearch *models.SavedSearch) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	entry := embeddedLogEntry{Op: "register", ID: savedSearch.ID, SavedSearch: savedSearch}
+	if err := r.appendLog(r.searchesLog, entry); err != nil {
+		return err
+	}
+	r.apply(entry)
+	r.maybeCompact(r.searchesLog, len(r.savedSearches), r.savedSearchEntries)
+	return nil
+}
+
+func (r *EmbeddedSearchRepository) UnregisterSavedSearch(ctx context.Context, id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	entry := embeddedLogEntry{Op: "unregister", ID: id}
+	if err := r.appendLog(r.searchesLog, entry); err != nil {
+		return err
+	}
+	r.apply(entry)
+	r.maybeCompact(r.searchesLog, len(r.savedSearches), r.savedSearchEntries)
+	return nil
+}
+
+// PercolateFeed matches the title and description of the feed against every
+// saved search requiring all of its terms, the same fields and "and"
+// semantics the Elasticsearch percolator uses.
+func (r *EmbeddedSearchRepository) PercolateFeed(ctx context.Context, feed *models.Feed) ([]string, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	terms := make(map[string]bool)
+	for _, t := range analyze(feed.Title + " " + feed.Description) {
+		terms[t] = true
+	}
+	ids := make([]string, 0)
+	for id, s := range r.savedSearches {
+		if len(s.terms) == 0 {
+			continue
+		}
+		matched := true
+		for _, t := range s.terms {
+			if _, ok := terms[t]; !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
@@ -0,0 +1,130 @@
+package search
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"platzi.com/go/cqrs/models"
+)
+
+func countLogEntries(t *testing.T, path string) int {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	defer f.Close()
+	n := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		n++
+	}
+	return n
+}
+
+func TestEmbeddedReopen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	r, err := NewEmbedded(dir)
+	if err != nil {
+		t.Fatalf("NewEmbedded: %v", err)
+	}
+	kept := conformanceFeed("kept", "golang release notes", "")
+	deleted := conformanceFeed("deleted", "golang deleted", "")
+	for _, feed := range []*models.Feed{kept, deleted} {
+		if err := r.IndexFeed(ctx, feed); err != nil {
+			t.Fatalf("IndexFeed: %v", err)
+		}
+	}
+	if err := r.DeleteFeed(ctx, deleted.ID); err != nil {
+		t.Fatalf("DeleteFeed: %v", err)
+	}
+	savedSearch := &models.SavedSearch{ID: "saved", OwnerID: "owner", Query: "golang release"}
+	if err := r.RegisterSavedSearch(ctx, savedSearch); err != nil {
+		t.Fatalf("RegisterSavedSearch: %v", err)
+	}
+	r.Close()
+
+	r, err = NewEmbedded(dir)
+	if err != nil {
+		t.Fatalf("NewEmbedded: %v", err)
+	}
+	defer r.Close()
+	feeds, err := r.SearchFeeds(ctx, "golang", models.FeedFilter{})
+	if err != nil {
+		t.Fatalf("SearchFeeds: %v", err)
+	}
+	if ids := feedIDs(feeds); len(ids) != 1 || !ids[kept.ID] {
+		t.Errorf("SearchFeeds after reopening = %v, want only %s", ids, kept.ID)
+	}
+	ids, err := r.PercolateFeed(ctx, kept)
+	if err != nil {
+		t.Fatalf("PercolateFeed: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != savedSearch.ID {
+		t.Errorf("PercolateFeed after reopening = %v, want [%s]", ids, savedSearch.ID)
+	}
+	// Reopening compacted the delete away
+	if n := countLogEntries(t, filepath.Join(dir, embeddedFeedsLog)); n != 1 {
+		t.Errorf("%s has %d entries after reopening, want 1", embeddedFeedsLog, n)
+	}
+}
+
+func TestEmbeddedCompaction(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	r, err := NewEmbedded(dir)
+	if err != nil {
+		t.Fatalf("NewEmbedded: %v", err)
+	}
+	defer r.Close()
+
+	// Updating the same few feeds over and over only supersedes entries
+	const live = 10
+	for i := 0; i < compactMinEntries*2; i++ {
+		feed := conformanceFeed(fmt.Sprintf("feed-%d", i%live), fmt.Sprintf("title %d", i), "")
+		if err := r.IndexFeed(ctx, feed); err != nil {
+			t.Fatalf("IndexFeed: %v", err)
+		}
+	}
+	if n := countLogEntries(t, filepath.Join(dir, embeddedFeedsLog)); n >= compactMinEntries {
+		t.Errorf("%s has %d entries, want it compacted below %d", embeddedFeedsLog, n, compactMinEntries)
+	}
+	count, err := r.Count(ctx)
+	if err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	if count != live {
+		t.Errorf("Count = %d, want %d", count, live)
+	}
+
+	// Writes after a compaction still reach the log
+	if err := r.IndexFeed(ctx, conformanceFeed("after", "written after compacting", "")); err != nil {
+		t.Fatalf("IndexFeed: %v", err)
+	}
+	r.Close()
+	r, err = NewEmbedded(dir)
+	if err != nil {
+		t.Fatalf("NewEmbedded: %v", err)
+	}
+	defer r.Close()
+	feeds, err := r.SearchFeeds(ctx, "compacting", models.FeedFilter{})
+	if err != nil {
+		t.Fatalf("SearchFeeds: %v", err)
+	}
+	if ids := feedIDs(feeds); !ids["after"] {
+		t.Errorf("SearchFeeds after reopening = %v, want after", ids)
+	}
+	if entries, err := os.ReadDir(dir); err == nil {
+		for _, entry := range entries {
+			if filepath.Ext(entry.Name()) == ".tmp" {
+				t.Errorf("temporary file %s left behind", entry.Name())
+			}
+		}
+	}
+}
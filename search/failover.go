@@ -0,0 +1,263 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"platzi.com/go/cqrs/models"
+)
+
+// circuitBreaker opens after a number of consecutive failures and lets a
+// single trial call through once the cooldown has elapsed.
+type circuitBreaker struct {
+	mutex     *sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openedAt  time.Time
+	trial     bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		mutex:     &sync.Mutex{},
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// allow reports whether the protected backend may be called
+func (b *circuitBreaker) allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.trial || time.Since(b.openedAt) < b.cooldown {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+func (b *circuitBreaker) success() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.failures >= b.threshold {
+		log.Printf("Search circuit closed")
+	}
+	b.failures = 0
+	b.trial = false
+}
+
+func (b *circuitBreaker) failure() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.failures++
+	b.trial = false
+	if b.failures >= b.threshold {
+		if b.failures == b.threshold {
+			log.Printf("Search circuit opened after %d consecutive failures", b.failures)
+		}
+		b.openedAt = time.Now()
+	}
+}
+
+// release ends a trial call without recording its outcome, for calls that
+// were cancelled by the caller rather than failed by the backend
+func (b *circuitBreaker) release() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.trial = false
+}
+
+// record counts the result of a call to the protected backend. Errors caused
+// by the cancellation of ctx say nothing about the backend and only release
+// the trial.
+func (b *circuitBreaker) record(ctx context.Context, err error) {
+	switch {
+	case err == nil:
+		b.success()
+	case ctx.Err() != nil:
+		b.release()
+	default:
+		b.failure()
+	}
+}
+
+func (b *circuitBreaker) isOpen() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.failures >= b.threshold
+}
+
+type degradedKey struct{}
+
+// WithDegradedTracking returns a context that records whether any search
+// call made with it was answered by the fallback backend.
+func WithDegradedTracking(ctx context.Context) (context.Context, *atomic.Bool) {
+	degraded := &atomic.Bool{}
+	return context.WithValue(ctx, degradedKey{}, degraded), degraded
+}
+
+func markDegraded(ctx context.Context) {
+	if degraded, ok := ctx.Value(degradedKey{}).(*atomic.Bool); ok {
+		degraded.Store(true)
+	}
+}
+
+// ErrCircuitOpen is returned by writes to the primary backend while its
+// circuit is open
+var ErrCircuitOpen = errors.New("search circuit is open")
+
+// Backend is a search backend that also percolates saved searches
+type Backend interface {
+	SearchRepository
+	Percolator
+}
+
+// FailoverSearchRepository sends queries and percolations to the primary
+// backend and routes them to the fallback while the primary's circuit is open
+// or when a call to it fails. Feeds and saved searches are only written to
+// the primary, and not even tried while the circuit is open.
+type FailoverSearchRepository struct {
+	primary  Backend
+	fallback Backend
+	breaker  *circuitBreaker
+}
+
+func NewFailover(primary, fallback Backend, threshold int, cooldown time.Duration) *FailoverSearchRepository {
+	return &FailoverSearchRepository{
+		primary:  primary,
+		fallback: fallback,
+		breaker:  newCircuitBreaker(threshold, cooldown),
+	}
+}
+
+// Degraded reports whether queries are currently served by the fallback
+func (r *FailoverSearchRepository) Degraded() bool {
+	return r.breaker.isOpen()
+}
+
+// MappingError reports the primary's mapping error when it keeps Elasticsearch indices
+func (r *FailoverSearchRepository) MappingError() error {
+	if checker, ok := r.primary.(MappingChecker); ok {
+		return checker.MappingError()
+	}
+	return nil
+}
+
+func (r *FailoverSearchRepository) Close() {
+	r.primary.Close()
+	r.fallback.Close()
+}
+
+// run calls the primary when the circuit allows it and the fallback otherwise
+func (r *FailoverSearchRepository) run(ctx context.Context, primary, fallback func() error) error {
+	if r.breaker.allow() {
+		err := primary()
+		r.breaker.record(ctx, err)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		log.Printf("Primary search backend failed, using fallback: %v", err)
+	}
+	markDegraded(ctx)
+	return fallback()
+}
+
+// write calls the primary when the circuit allows it and fails fast with
+// ErrCircuitOpen otherwise
+func (r *FailoverSearchRepository) write(ctx context.Context, primary func() error) error {
+	if !r.breaker.allow() {
+		return ErrCircuitOpen
+	}
+	err := primary()
+	r.breaker.record(ctx, err)
+	return err
+}
+
+func (r *FailoverSearchRepository) IndexFeed(ctx context.Context, feed *models.Feed) error {
+	return r.write(ctx, func() error {
+		return r.primary.IndexFeed(ctx, feed)
+	})
+}
+
+func (r *FailoverSearchRepository) DeleteFeed(ctx context.Context, id string) error {
+	return r.write(ctx, func() error {
+		return r.primary.DeleteFeed(ctx, id)
+	})
+}
+
+func (r *FailoverSearchRepository) SearchFeeds(ctx context.Context, query string, filter models.FeedFilter) (feeds []*models.Feed, err error) {
+	err = r.run(ctx, func() (err error) {
+		feeds, err = r.primary.SearchFeeds(ctx, query, filter)
+		return err
+	}, func() (err error) {
+		feeds, err = r.fallback.SearchFeeds(ctx, query, filter)
+		return err
+	})
+	return feeds, err
+}
+
+func (r *FailoverSearchRepository) Count(ctx context.Context) (count int64, err error) {
+	err = r.run(ctx, func() (err error) {
+		count, err = r.primary.Count(ctx)
+		return err
+	}, func() (err error) {
+		count, err = r.fallback.Count(ctx)
+		return err
+	})
+	return count, err
+}
+
+func (r *FailoverSearchRepository) SuggestFeeds(ctx context.Context, prefix string, n int) (suggestions []*Suggestion, err error) {
+	err = r.run(ctx, func() (err error) {
+		suggestions, err = r.primary.SuggestFeeds(ctx, prefix, n)
+		return err
+	}, func() (err error) {
+		suggestions, err = r.fallback.SuggestFeeds(ctx, prefix, n)
+		return err
+	})
+	return suggestions, err
+}
+
+func (r *FailoverSearchRepository) RelatedFeeds(ctx context.Context, id string, n int) (feeds []*models.Feed, err error) {
+	err = r.run(ctx, func() (err error) {
+		feeds, err = r.primary.RelatedFeeds(ctx, id, n)
+		return err
+	}, func() (err error) {
+		feeds, err = r.fallback.RelatedFeeds(ctx, id, n)
+		return err
+	})
+	return feeds, err
+}
+
+func (r *FailoverSearchRepository) RegisterSavedSearch(ctx context.Context, savedSearch *models.SavedSearch) error {
+	return r.write(ctx, func() error {
+		return r.primary.RegisterSavedSearch(ctx, savedSearch)
+	})
+}
+
+func (r *FailoverSearchRepository) UnregisterSavedSearch(ctx context.Context, id string) error {
+	return r.write(ctx, func() error {
+		return r.primary.UnregisterSavedSearch(ctx, id)
+	})
+}
+
+// PercolateFeed percolates in the fallback while the primary is down, so
+// saved-search alerts keep working
+func (r *FailoverSearchRepository) PercolateFeed(ctx context.Context, feed *models.Feed) (ids []string, err error) {
+	err = r.run(ctx, func() (err error) {
+		ids, err = r.primary.PercolateFeed(ctx, feed)
+		return err
+	}, func() (err error) {
+		ids, err = r.fallback.PercolateFeed(ctx, feed)
+		return err
+	})
+	return ids, err
+}
@@ -0,0 +1,148 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"platzi.com/go/cqrs/models"
+)
+
+// fakeBackend is a SearchRepository whose calls fail with err, or block
+// until the context is cancelled when block is set
+type fakeBackend struct {
+	err   error
+	block bool
+	calls int
+}
+
+func (b *fakeBackend) call(ctx context.Context) error {
+	b.calls++
+	if b.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return b.err
+}
+
+func (b *fakeBackend) Close() {}
+
+func (b *fakeBackend) IndexFeed(ctx context.Context, feed *models.Feed) error {
+	return b.call(ctx)
+}
+
+func (b *fakeBackend) DeleteFeed(ctx context.Context, id string) error {
+	return b.call(ctx)
+}
+
+func (b *fakeBackend) SearchFeeds(ctx context.Context, query string, filter models.FeedFilter) ([]*models.Feed, error) {
+	return []*models.Feed{}, b.call(ctx)
+}
+
+func (b *fakeBackend) Count(ctx context.Context) (int64, error) {
+	return 0, b.call(ctx)
+}
+
+func (b *fakeBackend) SuggestFeeds(ctx context.Context, prefix string, n int) ([]*Suggestion, error) {
+	return []*Suggestion{}, b.call(ctx)
+}
+
+func (b *fakeBackend) RelatedFeeds(ctx context.Context, id string, n int) ([]*models.Feed, error) {
+	return []*models.Feed{}, b.call(ctx)
+}
+
+func (b *fakeBackend) RegisterSavedSearch(ctx context.Context, savedSearch *models.SavedSearch) error {
+	return b.call(ctx)
+}
+
+func (b *fakeBackend) UnregisterSavedSearch(ctx context.Context, id string) error {
+	return b.call(ctx)
+}
+
+func (b *fakeBackend) PercolateFeed(ctx context.Context, feed *models.Feed) ([]string, error) {
+	return []string{}, b.call(ctx)
+}
+
+func TestFailoverCancelledTrial(t *testing.T) {
+	primary := &fakeBackend{err: errors.New("down")}
+	fallback := &fakeBackend{}
+	r := NewFailover(primary, fallback, 1, 0)
+	ctx := context.Background()
+
+	if _, err := r.Count(ctx); err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	if !r.Degraded() {
+		t.Fatal("circuit did not open after a failure")
+	}
+
+	// The trial call is cancelled by the client, which says nothing about
+	// the primary, so the next call must get to try it again
+	primary.err, primary.block = nil, true
+	cancelled, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := r.Count(cancelled); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Count with a cancelled context = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	primary.block = false
+	calls := primary.calls
+	if _, err := r.Count(ctx); err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	if primary.calls != calls+1 {
+		t.Fatal("primary was not tried after a cancelled trial")
+	}
+	if r.Degraded() {
+		t.Error("circuit did not close after a successful trial")
+	}
+}
+
+func TestFailoverWritesWhileOpen(t *testing.T) {
+	primary := &fakeBackend{err: errors.New("down")}
+	r := NewFailover(primary, &fakeBackend{}, 2, time.Hour)
+	ctx := context.Background()
+	feed := conformanceFeed("feed", "title", "description")
+
+	for i := 0; i < 2; i++ {
+		if err := r.IndexFeed(ctx, feed); err == nil {
+			t.Fatal("IndexFeed succeeded with the primary down")
+		}
+	}
+	calls := primary.calls
+	if err := r.IndexFeed(ctx, feed); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("IndexFeed with the circuit open = %v, want %v", err, ErrCircuitOpen)
+	}
+	if err := r.DeleteFeed(ctx, feed.ID); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("DeleteFeed with the circuit open = %v, want %v", err, ErrCircuitOpen)
+	}
+	if err := r.RegisterSavedSearch(ctx, &models.SavedSearch{ID: "saved"}); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("RegisterSavedSearch with the circuit open = %v, want %v", err, ErrCircuitOpen)
+	}
+	if primary.calls != calls {
+		t.Errorf("primary got %d calls with the circuit open, want none", primary.calls-calls)
+	}
+}
+
+func TestFailoverPercolatesInFallback(t *testing.T) {
+	primary := &fakeBackend{err: errors.New("down")}
+	fallback := &fakeBackend{}
+	r := NewFailover(primary, fallback, 1, time.Hour)
+	ctx, degraded := WithDegradedTracking(context.Background())
+
+	for i := 0; i < 2; i++ {
+		if _, err := r.PercolateFeed(ctx, conformanceFeed("feed", "title", "")); err != nil {
+			t.Fatalf("PercolateFeed: %v", err)
+		}
+	}
+	if fallback.calls != 2 {
+		t.Errorf("fallback percolated %d times, want 2", fallback.calls)
+	}
+	if primary.calls != 1 {
+		t.Errorf("primary percolated %d times with the circuit open, want 1", primary.calls)
+	}
+	if !degraded.Load() {
+		t.Error("percolation in the fallback was not marked as degraded")
+	}
+}
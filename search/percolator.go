@@ -0,0 +1,32 @@
+package search
+
+import (
+	"context"
+
+	"platzi.com/go/cqrs/models"
+)
+
+// Percolator stores saved searches as queries and finds which of them match a feed
+type Percolator interface {
+	RegisterSavedSearch(ctx context.Context, savedSearch *models.SavedSearch) error
+	UnregisterSavedSearch(ctx context.Context, id string) error
+	PercolateFeed(ctx context.Context, feed *models.Feed) ([]string, error)
+}
+
+var percolator Percolator
+
+func SetPercolator(p Percolator) {
+	percolator = p
+}
+
+func RegisterSavedSearch(ctx context.Context, savedSearch *models.SavedSearch) error {
+	return percolator.RegisterSavedSearch(ctx, savedSearch)
+}
+
+func UnregisterSavedSearch(ctx context.Context, id string) error {
+	return percolator.UnregisterSavedSearch(ctx, id)
+}
+
+func PercolateFeed(ctx context.Context, feed *models.Feed) ([]string, error) {
+	return percolator.PercolateFeed(ctx, feed)
+}
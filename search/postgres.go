@@ -0,0 +1,193 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"platzi.com/go/cqrs/models"
+)
+
+// PostgresSearchRepository answers search queries from the search_vector
+// column of the feeds table. Postgres is the source of truth for feeds, so
+// indexing is a no-op: the column is maintained by a trigger. The other
+// backends only index published feeds, so suggestions, related feeds and the
+// count skip the rest here too. Feeds in the trash are never returned.
+//
+// It is also a Percolator over the saved_searches table, which is likewise
+// the source of truth, so registering a saved search is a no-op too.
+type PostgresSearchRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresSearch(url string) (*PostgresSearchRepository, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, err
+	}
+	return &PostgresSearchRepository{db}, nil
+}
+
+func (r *PostgresSearchRepository) Close() {
+	r.db.Close()
+}
+
+func (r *PostgresSearchRepository) IndexFeed(ctx context.Context, feed *models.Feed) error {
+	return nil
+}
+
+func (r *PostgresSearchRepository) DeleteFeed(ctx context.Context, id string) error {
+	return nil
+}
+
+// anyTermsQuery builds a to_tsquery expression matching any of the terms,
+// like the default "or" operator of the Elasticsearch multi_match query.
+// analyze only keeps letters and digits, so the terms need no escaping.
+func anyTermsQuery(text string) string {
+	return strings.Join(analyze(text), " | ")
+}
+
+// feedColumns are the columns scanned by queryFeeds
+const feedColumns = "id, title, description, author, url, tags, body, language, status, publish_at, published_at, created_at, deleted_at"
+
+// queryFeeds runs a ranked full-text query and scans the resulting feeds
+func (r *PostgresSearchRepository) queryFeeds(ctx context.Context, query string, args ...interface{}) ([]*models.Feed, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	feeds := make([]*models.Feed, 0)
+	for rows.Next() {
+		feed := &models.Feed{}
+		err := rows.Scan(&feed.ID, &feed.Title, &feed.Description, &feed.Author, &feed.URL, pq.Array(&feed.Tags), &feed.Body, &feed.Language, &feed.Status, &feed.PublishAt, &feed.PublishedAt, &feed.CreatedAt, &feed.DeletedAt)
+		if err != nil {
+			return nil, err
+		}
+		feeds = append(feeds, feed)
+	}
+	return feeds, rows.Err()
+}
+
+func (r *PostgresSearchRepository) SearchFeeds(ctx context.Context, query string, filter models.FeedFilter) ([]*models.Feed, error) {
+	tsquery := anyTermsQuery(query)
+	if tsquery == "" {
+		return []*models.Feed{}, nil
+	}
+	args := []interface{}{tsquery, defaultSearchLimit}
+	where := "search_vector @@ q AND deleted_at IS NULL"
+	if !filter.Since.IsZero() {
+		args = append(args, filter.Since)
+		where += fmt.Sprintf(" AND created_at >= $%d", len(args))
+	}
+	if !filter.Until.IsZero() {
+		args = append(args, filter.Until)
+		where += fmt.Sprintf(" AND created_at < $%d", len(args))
+	}
+	if len(filter.Tags) > 0 {
+		args = append(args, pq.Array(filter.Tags))
+		where += fmt.Sprintf(" AND tags @> $%d", len(args))
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		where += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+	return r.queryFeeds(ctx, `
+		SELECT `+feedColumns+`
+		FROM feeds, to_tsquery('simple', $1) q
+		WHERE `+where+`
+		ORDER BY ts_rank(search_vector, q) DESC, created_at DESC
+		LIMIT $2`, args...)
+}
+
+func (r *PostgresSearchRepository) Count(ctx context.Context) (int64, error) {
+	var count int64
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM feeds WHERE status = 'published' AND deleted_at IS NULL").Scan(&count)
+	return count, err
+}
+
+func (r *PostgresSearchRepository) SuggestFeeds(ctx context.Context, prefix string, n int) ([]*Suggestion, error) {
+	terms := analyze(prefix)
+	suggestions := make([]*Suggestion, 0)
+	if len(terms) == 0 {
+		return suggestions, nil
+	}
+	for i, t := range terms {
+		terms[i] = t + ":*"
+	}
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, title
+		FROM feeds
+		WHERE to_tsvector('simple', title) @@ to_tsquery('simple', $1) AND status = 'published' AND deleted_at IS NULL
+		ORDER BY length(title), id
+		LIMIT $2`, strings.Join(terms, " & "), n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		s := &Suggestion{}
+		if err := rows.Scan(&s.ID, &s.Title); err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, s)
+	}
+	return suggestions, rows.Err()
+}
+
+func (r *PostgresSearchRepository) RelatedFeeds(ctx context.Context, id string, n int) ([]*models.Feed, error) {
+	var title, description string
+	err := r.db.QueryRowContext(ctx, "SELECT title, description FROM feeds WHERE id = $1 AND status = 'published' AND deleted_at IS NULL", id).Scan(&title, &description)
+	if err == sql.ErrNoRows {
+		return []*models.Feed{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	tsquery := anyTermsQuery(title + " " + description)
+	if tsquery == "" {
+		return []*models.Feed{}, nil
+	}
+	return r.queryFeeds(ctx, `
+		SELECT `+feedColumns+`
+		FROM feeds, to_tsquery('simple', $1) q
+		WHERE search_vector @@ q AND id <> $2 AND status = 'published' AND deleted_at IS NULL
+		ORDER BY ts_rank(search_vector, q) DESC, created_at DESC
+		LIMIT $3`, tsquery, id, n)
+}
+
+func (r *PostgresSearchRepository) RegisterSavedSearch(ctx context.Context, savedSearch *models.SavedSearch) error {
+	return nil
+}
+
+func (r *PostgresSearchRepository) UnregisterSavedSearch(ctx context.Context, id string) error {
+	return nil
+}
+
+// PercolateFeed returns the saved searches whose terms all appear in the
+// title or description of the feed, the fields and "and" semantics of the
+// Elasticsearch percolator.
+func (r *PostgresSearchRepository) PercolateFeed(ctx context.Context, feed *models.Feed) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id
+		FROM saved_searches
+		WHERE to_tsvector('simple', $1 || ' ' || $2) @@ plainto_tsquery('simple', query)
+		ORDER BY id`, feed.Title, feed.Description)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
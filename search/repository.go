@@ -9,8 +9,21 @@ import (
 type SearchRepository interface {
 	Close()
 	IndexFeed(ctx context.Context, feed *models.Feed) error
-	SearchFeeds(ctx context.Context, query string) ([]*models.Feed, error)
+	DeleteFeed(ctx context.Context, id string) error
+	SearchFeeds(ctx context.Context, query string, filter models.FeedFilter) ([]*models.Feed, error)
 	Count(ctx context.Context) (int64, error)
+	SuggestFeeds(ctx context.Context, prefix string, n int) ([]*Suggestion, error)
+	RelatedFeeds(ctx context.Context, id string, n int) ([]*models.Feed, error)
+}
+
+// defaultSearchLimit is the number of hits SearchFeeds returns, the default
+// size of an Elasticsearch query, so every backend answers with as many
+const defaultSearchLimit = 10
+
+// Suggestion is a lightweight autocomplete hit for a feed title
+type Suggestion struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
 }
 
 var repo SearchRepository
@@ -31,6 +44,18 @@ func IndexFeed(ctx context.Context, feed *models.Feed) error {
 	return repo.IndexFeed(ctx, feed)
 }
 
-func SearchFeeds(ctx context.Context, query string) ([]*models.Feed, error) {
-	return repo.SearchFeeds(ctx, query)
+func DeleteFeed(ctx context.Context, id string) error {
+	return repo.DeleteFeed(ctx, id)
+}
+
+func SearchFeeds(ctx context.Context, query string, filter models.FeedFilter) ([]*models.Feed, error) {
+	return repo.SearchFeeds(ctx, query, filter)
+}
+
+func SuggestFeeds(ctx context.Context, prefix string, n int) ([]*Suggestion, error) {
+	return repo.SuggestFeeds(ctx, prefix, n)
+}
+
+func RelatedFeeds(ctx context.Context, id string, n int) ([]*models.Feed, error) {
+	return repo.RelatedFeeds(ctx, id, n)
 }